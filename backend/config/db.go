@@ -80,5 +80,7 @@ func MigrateDatabase() error {
 		&models.Solution{},
 		&models.ContestInvitation{},
 		&models.AdminInvite{},
+		&models.JudgeJob{},
+		&models.LLMUsage{},
 	)
 }
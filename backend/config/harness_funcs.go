@@ -0,0 +1,377 @@
+package config
+
+import (
+	"backend/models"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+var publicClassPattern = regexp.MustCompile(`public\s+class\s+\w+`)
+
+// harnessFuncs are available to harness templates in addition to the text/template builtins
+var harnessFuncs = template.FuncMap{
+	// renamePublicClass renames the public class, Java requires it to match the file name
+	"renamePublicClass": func(code string, name string) string {
+		return publicClassPattern.ReplaceAllString(code, "public class "+name)
+	},
+	"goMain":   goMain,
+	"rustMain": rustMain,
+
+	// Function-signature harnesses
+	"typeName":       typeName,
+	"javaFromJSON":   javaFromJSON,
+	"goImports":      goImports,
+	"imports":        importLines,
+	"withoutImports": withoutImportLines,
+	"matches": func(code string, pattern string) (bool, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(code), nil
+	},
+	"replaceAll": func(code string, pattern string, replacement string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(code, replacement), nil
+	},
+}
+
+// scalarTypeNames maps the scalar types of function signatures to the types of each language
+var scalarTypeNames = map[string]map[models.ValueType]string{
+	"java":   {models.TypeInt: "int", models.TypeLong: "long", models.TypeDouble: "double", models.TypeBool: "boolean", models.TypeString: "String"},
+	"csharp": {models.TypeInt: "int", models.TypeLong: "long", models.TypeDouble: "double", models.TypeBool: "bool", models.TypeString: "string"},
+	"cpp":    {models.TypeInt: "int", models.TypeLong: "long long", models.TypeDouble: "double", models.TypeBool: "bool", models.TypeString: "std::string"},
+	"go":     {models.TypeInt: "int", models.TypeLong: "int64", models.TypeDouble: "float64", models.TypeBool: "bool", models.TypeString: "string"},
+	"rust":   {models.TypeInt: "i32", models.TypeLong: "i64", models.TypeDouble: "f64", models.TypeBool: "bool", models.TypeString: "String"},
+}
+
+// typeName returns the name of a signature type in a language, e.g. std::vector<int> for int[] in cpp
+func typeName(language string, valueType models.ValueType) (string, error) {
+	name, ok := scalarTypeNames[language][valueType.Scalar()]
+	if !ok {
+		return "", fmt.Errorf("no %s type for %q", language, valueType)
+	}
+	for i := 0; i < valueType.Depth(); i++ {
+		switch language {
+		case "cpp":
+			name = "std::vector<" + name + ">"
+		case "rust":
+			name = "Vec<" + name + ">"
+		case "go":
+			name = "[]" + name
+		default:
+			name += "[]"
+		}
+	}
+	return name, nil
+}
+
+// javaFromJSON returns the Java expression that converts a value decoded by the harness's JSON parser to the type
+func javaFromJSON(valueType models.ValueType, expr string) (string, error) {
+	scalar, ok := map[models.ValueType]string{
+		models.TypeInt: "Int", models.TypeLong: "Long", models.TypeDouble: "Double", models.TypeBool: "Bool", models.TypeString: "Str",
+	}[valueType.Scalar()]
+	if !ok {
+		return "", fmt.Errorf("no Java type for %q", valueType)
+	}
+
+	switch valueType.Depth() {
+	case 0:
+		return fmt.Sprintf("__Json.to%s(%s)", scalar, expr), nil
+	case 1:
+		return fmt.Sprintf("__Json.to%sArray(%s)", scalar, expr), nil
+	default:
+		name, _ := typeName("java", valueType)
+		return fmt.Sprintf("__Json.list(%s).stream().map(__Json::to%sArray).toArray(%s::new)", expr, scalar, name), nil
+	}
+}
+
+// importLines returns the lines at the top level of the code that start with keyword, such as Java's imports or C#'s
+// using directives, which must precede the code the harness puts before the submission
+func importLines(code string, keyword string) string {
+	var lines []string
+	for _, line := range strings.Split(code, "\n") {
+		if strings.HasPrefix(line, keyword+" ") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withoutImportLines removes the lines returned by importLines and package declarations
+func withoutImportLines(code string, keyword string) string {
+	var lines []string
+	for _, line := range strings.Split(code, "\n") {
+		if !strings.HasPrefix(line, keyword+" ") && !strings.HasPrefix(line, "package ") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var goPackagePattern = regexp.MustCompile(`(?m)^\s*package\s+\w+`)
+
+// goMain turns Go code without a main function into a program that passes stdin to the entry point and prints
+// what it returns. The entry point may take no argument or the input as a string, and may return an error last.
+// Code that already has a main function, or that can't be parsed, is returned as is for the compiler to judge.
+func goMain(code string, entryPoint string) string {
+	if strings.TrimSpace(code) == "" {
+		return code
+	}
+	if !goPackagePattern.MatchString(code) {
+		code = "package main\n\n" + code
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", code, parser.SkipObjectResolution)
+	if err != nil {
+		return code
+	}
+
+	var functions []*ast.FuncDecl
+	for _, decl := range file.Decls {
+		if function, ok := decl.(*ast.FuncDecl); ok && function.Recv == nil {
+			if function.Name.Name == "main" {
+				return code
+			}
+			functions = append(functions, function)
+		}
+	}
+
+	entry := goEntryFunction(functions, entryPoint)
+	if entry == nil {
+		return code
+	}
+
+	var imports []string
+	var main strings.Builder
+	main.WriteString("\n\nfunc main() {\n")
+
+	args := ""
+	if entry.Type.Params.NumFields() == 1 {
+		imports = append(imports, "io", "os", "strings")
+		main.WriteString("\t__input, _ := __io.ReadAll(__os.Stdin)\n")
+		main.WriteString("\t__arg := __strings.TrimSuffix(__strings.TrimSuffix(string(__input), \"\\n\"), \"\\r\")\n")
+		args = "__arg"
+	}
+	call := fmt.Sprintf("%s(%s)", entry.Name.Name, args)
+
+	results := goResultTypes(entry)
+	returnsError := len(results) > 0 && results[len(results)-1] == "error"
+	switch {
+	case len(results) == 0:
+		fmt.Fprintf(&main, "\t%s\n", call)
+	case returnsError && len(results) <= 2:
+		if len(results) == 1 {
+			fmt.Fprintf(&main, "\t__err := %s\n", call)
+		} else {
+			fmt.Fprintf(&main, "\t__result, __err := %s\n", call)
+		}
+		main.WriteString("\tif __err != nil {\n\t\t__fmt.Fprintln(__os.Stderr, __err)\n\t\t__os.Exit(1)\n\t}\n")
+		if len(results) == 2 {
+			main.WriteString("\t__fmt.Println(__result)\n")
+		}
+		imports = append(imports, "fmt", "os")
+	default:
+		// Several results are printed on one line, separated by spaces
+		fmt.Fprintf(&main, "\t__fmt.Println(%s)\n", call)
+		imports = append(imports, "fmt")
+	}
+	main.WriteString("}\n")
+	return strings.TrimRight(goImports(code, imports...), "\n") + main.String()
+}
+
+// goImports adds package main to code without a package clause and imports the packages right after the clause.
+// The packages are imported as __ followed by their name, e.g. __json for encoding/json, so that they can't clash
+// with the imports of the submission.
+func goImports(code string, packages ...string) string {
+	if !goPackagePattern.MatchString(code) {
+		code = "package main\n\n" + code
+	}
+	if len(packages) == 0 {
+		return code
+	}
+
+	packages = slices.Clone(packages)
+	slices.Sort(packages)
+	packages = slices.Compact(packages)
+	imports := make([]string, len(packages))
+	for i, pkg := range packages {
+		imports[i] = fmt.Sprintf("__%s %q", path.Base(pkg), pkg)
+	}
+	importDecl := "\n\nimport (\n\t" + strings.Join(imports, "\n\t") + "\n)"
+
+	// The package clause may follow comments, so it is found by the parser rather than by the pattern
+	end := goPackagePattern.FindStringIndex(code)[1]
+	if file, err := parser.ParseFile(token.NewFileSet(), "main.go", code, parser.PackageClauseOnly); err == nil {
+		end = int(file.Name.End()) - 1
+	}
+	return code[:end] + importDecl + code[end:]
+}
+
+// goEntryFunction picks the function named entryPoint, or else the only function that can be called with the input
+func goEntryFunction(functions []*ast.FuncDecl, entryPoint string) *ast.FuncDecl {
+	var candidates []*ast.FuncDecl
+	for _, function := range functions {
+		if function.Type.TypeParams != nil || !goTakesInput(function) {
+			continue
+		}
+		if function.Name.Name == entryPoint {
+			return function
+		}
+		candidates = append(candidates, function)
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	return nil
+}
+
+// goTakesInput reports whether a function takes no parameter or a single string
+func goTakesInput(function *ast.FuncDecl) bool {
+	params := function.Type.Params.List
+	switch {
+	case len(params) == 0:
+		return true
+	case len(params) == 1 && len(params[0].Names) <= 1:
+		ident, ok := params[0].Type.(*ast.Ident)
+		return ok && ident.Name == "string"
+	}
+	return false
+}
+
+// goResultTypes returns the source of every result type of a function, one per result
+func goResultTypes(function *ast.FuncDecl) []string {
+	var types []string
+	if function.Type.Results == nil {
+		return nil
+	}
+	for _, field := range function.Type.Results.List {
+		name := goTypeName(field.Type)
+		for i := 0; i < max(len(field.Names), 1); i++ {
+			types = append(types, name)
+		}
+	}
+	return types
+}
+
+// goTypeName renders the identifiers the harness cares about, anything else is only told apart from them
+func goTypeName(expr ast.Expr) string {
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return fmt.Sprintf("%T", expr)
+}
+
+var (
+	rustMainPattern = regexp.MustCompile(`\bfn\s+main\s*\(`)
+	// Only functions at the start of a line count, methods of impl blocks are indented
+	rustFunctionPattern = regexp.MustCompile(`(?m)^(?:pub\s+)?fn\s+(\w+)\s*\(([^)]*)\)\s*(?:->\s*([^{]+?))?\s*(?:where\b[^{]*)?\{`)
+	rustParamPattern    = regexp.MustCompile(`^\s*(?:mut\s+)?\w+\s*:\s*(&\s*str|&\s*String|String)\s*,?\s*$`)
+)
+
+// rustMain turns Rust code without a main function into a program that passes stdin to the entry point and prints
+// what it returns. The entry point may take no argument or the input as &str or String, and may return a Result.
+// Code that already has a main function, or has no suitable entry point, is returned as is for the compiler to judge.
+func rustMain(code string, entryPoint string) string {
+	if strings.TrimSpace(code) == "" || rustMainPattern.MatchString(code) {
+		return code
+	}
+
+	var entry []string
+	var candidates [][]string
+	for _, match := range rustFunctionPattern.FindAllStringSubmatch(code, -1) {
+		if strings.TrimSpace(match[2]) != "" && !rustParamPattern.MatchString(match[2]) {
+			continue
+		}
+		if match[1] == entryPoint {
+			entry = match
+			break
+		}
+		candidates = append(candidates, match)
+	}
+	if entry == nil && len(candidates) == 1 {
+		entry = candidates[0]
+	}
+	if entry == nil {
+		return code
+	}
+
+	var main strings.Builder
+	main.WriteString("\n\nfn main() {\n")
+
+	args := ""
+	if param := rustParamPattern.FindStringSubmatch(entry[2]); param != nil {
+		main.WriteString("    let mut __input = String::new();\n")
+		main.WriteString("    std::io::Read::read_to_string(&mut std::io::stdin(), &mut __input).unwrap();\n")
+		main.WriteString("    let __arg = __input.strip_suffix('\\n').unwrap_or(&__input);\n")
+		main.WriteString("    let __arg = __arg.strip_suffix('\\r').unwrap_or(__arg);\n")
+		switch strings.ReplaceAll(param[1], " ", "") {
+		case "String":
+			args = "__arg.to_string()"
+		case "&String":
+			args = "&__arg.to_string()"
+		default:
+			args = "__arg"
+		}
+	}
+	call := fmt.Sprintf("%s(%s)", entry[1], args)
+
+	result := strings.TrimSpace(entry[3])
+	switch {
+	case result == "" || result == "()":
+		fmt.Fprintf(&main, "    %s;\n", call)
+	case strings.HasPrefix(result, "Result<"):
+		okType, _ := splitRustGenerics(strings.TrimSuffix(strings.TrimPrefix(result, "Result<"), ">"))
+		fmt.Fprintf(&main, "    match %s {\n", call)
+		if okType == "()" {
+			main.WriteString("        Ok(_) => {}\n")
+		} else {
+			fmt.Fprintf(&main, "        Ok(__result) => println!(\"%s\", __result),\n", rustFormat(okType))
+		}
+		main.WriteString("        Err(__err) => {\n            eprintln!(\"{:?}\", __err);\n            std::process::exit(1);\n        }\n    }\n")
+	default:
+		fmt.Fprintf(&main, "    println!(\"%s\", %s);\n", rustFormat(result), call)
+	}
+	main.WriteString("}\n")
+
+	return strings.TrimRight(code, "\n") + main.String()
+}
+
+// rustFormat returns the format string that prints a value of the type, Debug for the types without Display
+func rustFormat(typeName string) string {
+	typeName = strings.TrimSpace(typeName)
+	if strings.Contains(typeName, "<") || strings.HasPrefix(typeName, "(") || strings.HasPrefix(typeName, "[") ||
+		strings.HasPrefix(typeName, "&[") {
+		return "{:?}"
+	}
+	return "{}"
+}
+
+// splitRustGenerics splits the arguments of a generic type at its first top-level comma
+func splitRustGenerics(args string) (string, string) {
+	depth := 0
+	for i, r := range args {
+		switch r {
+		case '<', '(', '[':
+			depth++
+		case '>', ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				return strings.TrimSpace(args[:i]), strings.TrimSpace(args[i+1:])
+			}
+		}
+	}
+	return strings.TrimSpace(args), ""
+}
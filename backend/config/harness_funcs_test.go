@@ -0,0 +1,125 @@
+package config
+
+import (
+	"backend/models"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTypeName(t *testing.T) {
+	tests := []struct {
+		language  string
+		valueType models.ValueType
+		want      string
+	}{
+		{"cpp", "long", "long long"},
+		{"cpp", "int[][]", "std::vector<std::vector<int>>"},
+		{"rust", "string[]", "Vec<String>"},
+		{"go", "double[][]", "[][]float64"},
+		{"java", "bool[]", "boolean[]"},
+		{"csharp", "string", "string"},
+	}
+
+	for _, tt := range tests {
+		got, err := typeName(tt.language, tt.valueType)
+		if err != nil {
+			t.Errorf("typeName(%s, %s) error = %v", tt.language, tt.valueType, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("typeName(%s, %s) = %q, want %q", tt.language, tt.valueType, got, tt.want)
+		}
+	}
+
+	if _, err := typeName("cpp", "float"); err == nil {
+		t.Error("typeName(cpp, float) = nil error, want an unknown type")
+	}
+}
+
+func TestJavaFromJSON(t *testing.T) {
+	tests := []struct {
+		valueType models.ValueType
+		want      string
+	}{
+		{"long", "__Json.toLong(x)"},
+		{"string[]", "__Json.toStrArray(x)"},
+		{"int[][]", "__Json.list(x).stream().map(__Json::toIntArray).toArray(int[][]::new)"},
+	}
+
+	for _, tt := range tests {
+		got, err := javaFromJSON(tt.valueType, "x")
+		if err != nil || got != tt.want {
+			t.Errorf("javaFromJSON(%s) = %q, %v, want %q", tt.valueType, got, err, tt.want)
+		}
+	}
+}
+
+// TestWrapSignature generates the harness of every language that supports function-signature problems
+func TestWrapSignature(t *testing.T) {
+	for _, language := range Languages.List() {
+		t.Run(language.Name, func(t *testing.T) {
+			wrapped, err := language.WrapSignature("// solution", sampleSignature)
+			if language.SignatureHarness == "" {
+				if err == nil {
+					t.Error("WrapSignature() = nil error for a language without a signature harness")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WrapSignature() error = %v", err)
+			}
+			if !strings.Contains(wrapped, "// solution") || !strings.Contains(wrapped, sampleSignature.Name) {
+				t.Errorf("harness lacks the solution or the call of %s:\n%s", sampleSignature.Name, wrapped)
+			}
+		})
+	}
+}
+
+// TestSignatureHarnessRuns runs the harnesses of the interpreted languages, skipping those that aren't installed
+func TestSignatureHarnessRuns(t *testing.T) {
+	signature := &models.FunctionSignature{
+		Name:       "rowSums",
+		Parameters: []models.FunctionParameter{{Name: "grid", Type: "long[][]"}, {Name: "scale", Type: "long"}},
+		ReturnType: "long[]",
+	}
+	solutions := map[string]string{
+		"Python":     "def rowSums(grid, scale):\n    return [sum(row) * scale for row in grid]\n",
+		"JavaScript": "function rowSums(grid, scale) {\n    return grid.map(row => row.reduce((a, b) => a + b, 0) * scale);\n}\n",
+	}
+	const input = `[[[1, 2], [3], []], 1000000000]`
+	const want = `[3000000000,3000000000,0]`
+
+	for name, code := range solutions {
+		t.Run(name, func(t *testing.T) {
+			language, ok := Languages.Get(name)
+			if !ok {
+				t.Fatalf("%s is not in the registry", name)
+			}
+			if _, err := exec.LookPath(language.RunCommand[0]); err != nil {
+				t.Skipf("%s is not installed", language.RunCommand[0])
+			}
+
+			wrapped, err := language.WrapSignature(code, signature)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, language.FileName), []byte(wrapped), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(language.RunCommand[0], filepath.Join(dir, language.FileName))
+			cmd.Stdin = strings.NewReader(input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("harness failed: %v\n%s", err, output)
+			}
+			if got := strings.TrimSpace(string(output)); got != want {
+				t.Errorf("harness printed %s, want %s", got, want)
+			}
+		})
+	}
+}
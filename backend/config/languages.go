@@ -0,0 +1,337 @@
+package config
+
+import (
+	"backend/models"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+//go:embed languages.json harness
+var languageFiles embed.FS
+
+// Languages is the registry of supported programming languages. It holds the embedded languages.json until
+// InitLanguages replaces it with the file named by JUDGE_LANGUAGES_FILE.
+var Languages = mustLoadBuiltinLanguages()
+
+// Language describes how submissions in a programming language are built and run.
+// Commands may use {dir} for the workspace directory and {file} for the source file name,
+// an argument {flags} in the compile command is replaced with the compiler flags.
+type Language struct {
+	Name                 string            `json:"name"`
+	Extension            string            `json:"extension"` // Without the dot, unique over all languages
+	Image                string            `json:"image"`
+	FileName             string            `json:"fileName"` // Name of the source file in the workspace
+	CompileCommand       []string          `json:"compileCommand,omitempty"`
+	RunCommand           []string          `json:"runCommand"`
+	TimeMultiplier       float64           `json:"timeMultiplier"`                 // Applied to the time limits, contests can override it
+	ExtraMemoryMB        int               `json:"extraMemoryMB,omitempty"`        // Added to the memory limits, contests can override it
+	DefaultCompilerFlags []string          `json:"defaultCompilerFlags,omitempty"` // Used unless a contest chooses other flags
+	AllowedCompilerFlags []string          `json:"allowedCompilerFlags,omitempty"` // The flags contests may choose from
+	Harness              string            `json:"harness,omitempty"`              // Template wrapping the submitted code, see HarnessData
+	SignatureHarness     string            `json:"signatureHarness,omitempty"`     // Template wrapping code of function-signature problems
+	AlwaysWrap           bool              `json:"alwaysWrap,omitempty"`           // The harness is needed by any program, also checkers and interactors
+	ExtraFiles           map[string]string `json:"extraFiles,omitempty"`           // Files written next to the source file, by name
+
+	harness          *template.Template
+	signatureHarness *template.Template
+	extraFiles       map[string]string
+	usesEntryPoint   bool
+}
+
+// HarnessData is passed to harness templates
+type HarnessData struct {
+	Code       string // The submitted code
+	EntryPoint string // The function to call, e.g. "main"
+	// Signature is only set for the signature harness. It reads the arguments as a JSON array from stdin,
+	// calls the function and prints the result as JSON.
+	Signature *models.FunctionSignature
+}
+
+// sampleSignature exercises every part of a signature harness when the registry is loaded
+var sampleSignature = &models.FunctionSignature{
+	Name: "solve",
+	Parameters: []models.FunctionParameter{
+		{Name: "grid", Type: "int[][]"},
+		{Name: "words", Type: "string[]"},
+		{Name: "limit", Type: "long"},
+		{Name: "flag", Type: "bool"},
+	},
+	ReturnType: "double[]",
+}
+
+// LanguageRegistry looks languages up by name or by source file extension
+type LanguageRegistry struct {
+	languages   []Language
+	byName      map[string]int
+	byExtension map[string]int
+}
+
+// mustLoadBuiltinLanguages loads the embedded registry, which only fails if languages.json in the source tree is broken
+func mustLoadBuiltinLanguages() *LanguageRegistry {
+	data, err := fs.ReadFile(languageFiles, "languages.json")
+	if err != nil {
+		panic(fmt.Sprintf("failed to read the built-in language registry: %v", err))
+	}
+	registry, err := LoadLanguages(data, languageFiles)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in language registry: %v", err))
+	}
+	return registry
+}
+
+// InitLanguages loads the registry named by JUDGE_LANGUAGES_FILE, if set, in place of the built-in one.
+// It has to run once the environment is loaded and before anything is judged.
+func InitLanguages() error {
+	path := os.Getenv("JUDGE_LANGUAGES_FILE")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read language registry: %w", err)
+	}
+	// Harnesses are looked up next to the file first, then among the built-in ones
+	registry, err := LoadLanguages(data, overlayFS{os.DirFS(filepath.Dir(path)), languageFiles})
+	if err != nil {
+		return fmt.Errorf("invalid language registry %s: %w", path, err)
+	}
+	Languages = registry
+	return nil
+}
+
+// LoadLanguages parses a registry, reading harness templates and extra files from files
+func LoadLanguages(data []byte, files fs.FS) (*LanguageRegistry, error) {
+	registry := &LanguageRegistry{
+		byName:      make(map[string]int),
+		byExtension: make(map[string]int),
+	}
+	if err := json.Unmarshal(data, &registry.languages); err != nil {
+		return nil, err
+	}
+
+	for i := range registry.languages {
+		language := &registry.languages[i]
+		if err := language.load(files); err != nil {
+			return nil, fmt.Errorf("language %q: %w", language.Name, err)
+		}
+
+		name := strings.ToLower(language.Name)
+		if _, ok := registry.byName[name]; ok {
+			return nil, fmt.Errorf("language %q is defined twice", language.Name)
+		}
+		if _, ok := registry.byExtension[language.Extension]; ok {
+			return nil, fmt.Errorf("extension %q is used by two languages", language.Extension)
+		}
+		registry.byName[name] = i
+		registry.byExtension[language.Extension] = i
+	}
+	return registry, nil
+}
+
+// load validates the language and reads the files it refers to
+func (l *Language) load(files fs.FS) error {
+	if l.Name == "" || l.Extension == "" || l.Image == "" || l.FileName == "" || len(l.RunCommand) == 0 {
+		return errors.New("name, extension, image, fileName and runCommand are required")
+	}
+	l.Extension = strings.TrimPrefix(l.Extension, ".")
+	if l.TimeMultiplier <= 0 {
+		l.TimeMultiplier = 1
+	}
+	if l.ExtraMemoryMB < 0 {
+		return errors.New("extraMemoryMB must not be negative")
+	}
+	if len(l.AllowedCompilerFlags) > 0 && !slices.Contains(l.CompileCommand, "{flags}") {
+		return errors.New("allowedCompilerFlags need {flags} in the compile command")
+	}
+	if err := l.CheckCompilerFlags(l.DefaultCompilerFlags); err != nil {
+		return fmt.Errorf("defaultCompilerFlags: %w", err)
+	}
+
+	var err error
+	if l.harness, err = loadHarness(files, l.Harness, HarnessData{}); err != nil {
+		return err
+	}
+	l.usesEntryPoint = l.harness != nil && strings.Contains(l.harness.Tree.Root.String(), ".EntryPoint")
+	if l.signatureHarness, err = loadHarness(files, l.SignatureHarness, HarnessData{Signature: sampleSignature}); err != nil {
+		return err
+	}
+
+	l.extraFiles = make(map[string]string)
+	for name, path := range l.ExtraFiles {
+		content, err := fs.ReadFile(files, path)
+		if err != nil {
+			return err
+		}
+		l.extraFiles[name] = string(content)
+	}
+	return nil
+}
+
+// loadHarness parses a harness template and runs it once with the sample data, nil if there is no template
+func loadHarness(files fs.FS, name string, sample HarnessData) (*template.Template, error) {
+	if name == "" {
+		return nil, nil
+	}
+	source, err := fs.ReadFile(files, name)
+	if err != nil {
+		return nil, err
+	}
+	harness, err := template.New(name).Funcs(harnessFuncs).Parse(string(source))
+	if err != nil {
+		return nil, err
+	}
+	// Templates mostly fail on fields that don't exist, which shows with any data
+	if err := harness.Execute(&strings.Builder{}, sample); err != nil {
+		return nil, err
+	}
+	return harness, nil
+}
+
+// Get returns the language with the given name, ignoring case
+func (r *LanguageRegistry) Get(name string) (Language, bool) {
+	i, ok := r.byName[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Language{}, false
+	}
+	return r.languages[i], true
+}
+
+// ByExtension returns the language of a source file extension such as "py" or ".py"
+func (r *LanguageRegistry) ByExtension(extension string) (Language, bool) {
+	i, ok := r.byExtension[strings.TrimPrefix(extension, ".")]
+	if !ok {
+		return Language{}, false
+	}
+	return r.languages[i], true
+}
+
+// List returns all languages in the order of the registry
+func (r *LanguageRegistry) List() []Language {
+	return append([]Language(nil), r.languages...)
+}
+
+// Names returns the names of all languages
+func (r *LanguageRegistry) Names() []string {
+	names := make([]string, len(r.languages))
+	for i, language := range r.languages {
+		names[i] = language.Name
+	}
+	return names
+}
+
+// UsesEntryPoint reports whether the harness calls the entry point passed to WrapCode. Without one, like for C++ or
+// Java, the program runs its own main and the entry point is ignored.
+func (l Language) UsesEntryPoint() bool {
+	return l.usesEntryPoint
+}
+
+// WrapCode applies the harness of the language to the submitted code. Languages without a harness run the code as is.
+func (l Language) WrapCode(code string, entryPoint string) string {
+	if l.harness == nil {
+		return code
+	}
+	var wrapped strings.Builder
+	if err := l.harness.Execute(&wrapped, HarnessData{Code: code, EntryPoint: entryPoint}); err != nil {
+		// Ruled out by load, the template already ran once
+		log.Printf("Failed to apply %s harness: %v", l.Name, err)
+		return code
+	}
+	return wrapped.String()
+}
+
+// SupportsSignatures reports whether the language has a harness for function-signature problems
+func (l Language) SupportsSignatures() bool {
+	return l.signatureHarness != nil
+}
+
+// WrapSignature generates the program that calls the function of a function-signature problem in the submitted code
+func (l Language) WrapSignature(code string, signature *models.FunctionSignature) (string, error) {
+	if l.signatureHarness == nil {
+		return "", fmt.Errorf("%s does not support function-signature problems", l.Name)
+	}
+	var wrapped strings.Builder
+	if err := l.signatureHarness.Execute(&wrapped, HarnessData{Code: code, EntryPoint: signature.Name, Signature: signature}); err != nil {
+		return "", fmt.Errorf("failed to generate %s harness: %w", l.Name, err)
+	}
+	return wrapped.String(), nil
+}
+
+// Files returns the extra files to write into the workspace, by name
+func (l Language) Files() map[string]string {
+	return l.extraFiles
+}
+
+// CheckCompilerFlags returns an error if any of the flags is not in the allowlist of the language
+func (l Language) CheckCompilerFlags(flags []string) error {
+	for _, flag := range flags {
+		if !slices.Contains(l.AllowedCompilerFlags, flag) {
+			return fmt.Errorf("compiler flag %q is not allowed for %s", flag, l.Name)
+		}
+	}
+	return nil
+}
+
+// CompilerFlags returns the flags to compile with, the default flags if none are chosen
+func (l Language) CompilerFlags(chosen []string) []string {
+	if len(chosen) == 0 {
+		return l.DefaultCompilerFlags
+	}
+	return chosen
+}
+
+// CompileArgs returns the compile command for a workspace, nil for interpreted languages.
+// Flags must have passed CheckCompilerFlags, no flags compiles with the default ones.
+func (l Language) CompileArgs(dir string, sourceFile string, flags []string) []string {
+	return expandCommand(l.CompileCommand, dir, sourceFile, l.CompilerFlags(flags))
+}
+
+// RunArgs returns the command that runs the (compiled) workspace
+func (l Language) RunArgs(dir string, sourceFile string) []string {
+	return expandCommand(l.RunCommand, dir, sourceFile, nil)
+}
+
+// expandCommand fills the placeholders of a compile or run command
+func expandCommand(command []string, dir string, sourceFile string, flags []string) []string {
+	if len(command) == 0 {
+		return nil
+	}
+	if dir == "" {
+		dir = "."
+	}
+	expanded := make([]string, 0, len(command)+len(flags))
+	for _, arg := range command {
+		if arg == "{flags}" {
+			expanded = append(expanded, flags...)
+			continue
+		}
+		if strings.Contains(arg, "{dir}") {
+			arg = filepath.Clean(strings.ReplaceAll(arg, "{dir}", dir))
+		}
+		expanded = append(expanded, strings.ReplaceAll(arg, "{file}", sourceFile))
+	}
+	return expanded
+}
+
+// overlayFS reads from the first file system that has the file
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	var err error
+	for _, files := range o {
+		var file fs.File
+		if file, err = files.Open(name); err == nil {
+			return file, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitLanguages(t *testing.T) {
+	builtin := Languages
+	t.Cleanup(func() { Languages = builtin })
+
+	dir := t.TempDir()
+	registry := `[{"name": "Lua", "extension": "lua", "image": "lua:5.4", "fileName": "main.lua",
+		"runCommand": ["lua", "{dir}/{file}"], "harness": "lua.tmpl"}]`
+	if err := os.WriteFile(filepath.Join(dir, "languages.json"), []byte(registry), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lua.tmpl"), []byte("{{.Code}}\n{{.EntryPoint}}()\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JUDGE_LANGUAGES_FILE", "")
+	if err := InitLanguages(); err != nil {
+		t.Fatalf("InitLanguages() without a file = %v", err)
+	}
+	if Languages != builtin {
+		t.Fatal("InitLanguages() without a file replaced the built-in registry")
+	}
+
+	t.Setenv("JUDGE_LANGUAGES_FILE", filepath.Join(dir, "languages.json"))
+	if err := InitLanguages(); err != nil {
+		t.Fatalf("InitLanguages() = %v", err)
+	}
+	if _, ok := Languages.Get("lua"); !ok {
+		t.Error("Lua is missing from the loaded registry")
+	}
+	if _, ok := Languages.Get("Python"); ok {
+		t.Error("the loaded registry still has the built-in languages")
+	}
+
+	t.Setenv("JUDGE_LANGUAGES_FILE", filepath.Join(dir, "missing.json"))
+	loaded := Languages
+	if err := InitLanguages(); err == nil {
+		t.Error("InitLanguages() with a missing file = nil, want an error")
+	}
+	if Languages != loaded {
+		t.Error("a failed InitLanguages() replaced the registry")
+	}
+}
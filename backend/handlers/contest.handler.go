@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"backend/config"
 	"backend/models"
 	"backend/services"
 	"backend/util"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
+	"strconv"
 	"strings"
 
 	"mime/multipart"
@@ -18,16 +22,19 @@ import (
 )
 
 type ContestHandler struct {
-	ContestService *services.ContestService
-	UserService    *services.UserService
+	ContestService  *services.ContestService
+	UserService     *services.UserService
+	LLMUsageService *services.LLMUsageService
 }
 
 func NewContestHandler(db *gorm.DB) *ContestHandler {
 	contestService := services.NewContestService(db)
 	userService := services.NewUserService(db)
+	llmUsageService := services.NewLLMUsageService(db)
 	return &ContestHandler{
-		ContestService: contestService,
-		UserService:    userService,
+		ContestService:  contestService,
+		UserService:     userService,
+		LLMUsageService: llmUsageService,
 	}
 }
 
@@ -42,8 +49,6 @@ func (h *ContestHandler) CreateContest(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not authorized to create a contest"})
 	}
 
-	const allowedLanguages = "python, java, javascript, c++, c#"
-
 	form, err := c.MultipartForm()
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Failed to parse form data"})
@@ -61,10 +66,30 @@ func (h *ContestHandler) CreateContest(c *fiber.Ctx) error {
 	}
 
 	language, err := getFormValue(form, "language")
-	if err != nil || !isValidLanguage(language, allowedLanguages) {
+	if err != nil || !isValidLanguage(language) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid language"})
 	}
 
+	// Allowed languages are optional, contests without them only accept language
+	allowedLanguages, err := parseLanguageList(form.Value["allowedLanguages"])
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(allowedLanguages) > 0 && !allowedLanguages.Contains(language) {
+		allowedLanguages = append(allowedLanguages, language)
+	}
+
+	// Time multipliers, extra memory and compiler flags by language, a JSON object
+	var languageSettings models.LanguageSettings
+	if raw, _ := getFormValue(form, "languageSettings"); strings.TrimSpace(raw) != "" {
+		if err := json.Unmarshal([]byte(raw), &languageSettings); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid languageSettings"})
+		}
+	}
+	if err := validateLanguageSettings(languageSettings); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	startDate, err := getFormValue(form, "startDate")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
@@ -84,6 +109,10 @@ func (h *ContestHandler) CreateContest(c *fiber.Ctx) error {
 	if contestStructure != "" && testFramework == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Test framework is required for structured contests"})
 	}
+	testFramework = strings.ToLower(strings.TrimSpace(testFramework))
+	if testFramework != "" && !models.TestFramework(testFramework).IsValid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Unsupported test framework %q, use jest, pytest, unittest, maven, gradle or go", testFramework)})
+	}
 
 	ownerID, err := getFormValue(form, "ownerId")
 	if err != nil {
@@ -111,6 +140,42 @@ func (h *ContestHandler) CreateContest(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invite-only contests must be private"})
 	}
 
+	// Checker settings are optional, the default keeps the legacy output comparison
+	checker, _ := getFormValue(form, "checker")
+	checkerLanguage, _ := getFormValue(form, "checkerLanguage")
+	absEpsilonStr, _ := getFormValue(form, "absEpsilon")
+	relEpsilonStr, _ := getFormValue(form, "relEpsilon")
+
+	absEpsilon, err := parseFloat(absEpsilonStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid absEpsilon"})
+	}
+	relEpsilon, err := parseFloat(relEpsilonStr)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid relEpsilon"})
+	}
+	if checkerLanguage != "" && !isValidLanguage(checkerLanguage) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid checker language"})
+	}
+
+	// Interactive contests run solutions against an interactor uploaded by the owner
+	interactiveStr, _ := getFormValue(form, "interactive")
+	interactorLanguage, _ := getFormValue(form, "interactorLanguage")
+	interactive := parseBool(interactiveStr, false)
+	if interactorLanguage != "" && !isValidLanguage(interactorLanguage) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid interactor language"})
+	}
+
+	// Function-signature problems declare the function solutions implement, a JSON object
+	signature, err := parseSignature(form)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// All-or-nothing contests stop judging a submission at its first failed test case
+	stopOnFirstFailureStr, _ := getFormValue(form, "stopOnFirstFailure")
+	stopOnFirstFailure := parseBool(stopOnFirstFailureStr, false)
+
 	log.Printf("DEBUG: isPublic=%v, inviteOnly=%v", isPublic, inviteOnly)
 
 	// Create a new Contest instance with the form data
@@ -127,6 +192,18 @@ func (h *ContestHandler) CreateContest(c *fiber.Ctx) error {
 		IsPublic:    isPublic,
 		InviteOnly:  inviteOnly,
 		EnableAICodeEntryIdentification: isAiEnabled,
+		CheckerLanguage: checkerLanguage,
+		Interactive: interactive,
+		InteractorLanguage: interactorLanguage,
+		StopOnFirstFailure: stopOnFirstFailure,
+		AllowedLanguages: allowedLanguages,
+		LanguageSettings: languageSettings,
+		Signature: signature,
+		CheckerConfig: models.CheckerConfig{
+			Checker:    models.CheckerType(checker),
+			AbsEpsilon: absEpsilon,
+			RelEpsilon: relEpsilon,
+		},
 	}
 
 	if contestStructure != "" {
@@ -156,11 +233,41 @@ func (h *ContestHandler) CreateContest(c *fiber.Ctx) error {
 		contest.TestFiles = &testFileData
 	}
 
+	if files, ok := form.File["checkerFile[0]"]; ok && len(files) > 0 {
+		checkerData, err := util.HandleTestFileUpload(files)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		contest.CheckerSource = &checkerData
+	}
+
+	if files, ok := form.File["interactorFile[0]"]; ok && len(files) > 0 {
+		interactorData, err := util.HandleTestFileUpload(files)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		contest.InteractorSource = &interactorData
+	}
+
+	if contest.Interactive && contest.InteractorSource == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Interactive contests require an interactor"})
+	}
+
+	if contest.Signature != nil {
+		if err := validateSignature(contest.Signature, contest.Languages(), contest.Interactive); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	// Validate contest data
 	if err := validateContest(contest); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if err := validateChecker(contest.CheckerConfig, contest.CheckerSource != nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	log.Printf("DEBUG: contest.IsPublic=%v, contest.InviteOnly=%v", contest.IsPublic, contest.InviteOnly)
 
 	// Create a context with a timeout
@@ -177,8 +284,10 @@ func (h *ContestHandler) CreateContest(c *fiber.Ctx) error {
 	return c.JSON(contest)
 }
 
-func isValidLanguage(language, allowedLanguages string) bool {
-	return strings.Contains(allowedLanguages, strings.ToLower(language))
+// isValidLanguage reports whether the language is in the language registry, ignoring case
+func isValidLanguage(language string) bool {
+	_, ok := config.Languages.Get(language)
+	return ok
 }
 
 func (h *ContestHandler) GetContests(c *fiber.Ctx) error {
@@ -265,6 +374,8 @@ func (h *ContestHandler) EditContest(c *fiber.Ctx) error {
 
 	contentType := c.Get("Content-Type")
 	var contestUpdate models.Contest
+	// Columns that are written even when empty, so that the owner can clear them. Other zero values leave the column alone.
+	var clearable []string
 
 	if strings.HasPrefix(contentType, "multipart/form-data") {
 		// Parse multipart form
@@ -279,6 +390,30 @@ func (h *ContestHandler) EditContest(c *fiber.Ctx) error {
 			return util.HandleError(c, "Invalid request body")
 		}
 
+		// Arrays arrive as JSON in form data
+		if values, ok := form.Value["allowedLanguages"]; ok {
+			allowedLanguages, err := parseLanguageList(values)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			}
+			contestUpdate.AllowedLanguages = allowedLanguages
+			clearable = append(clearable, "allowed_languages")
+		}
+		if _, ok := form.Value["languageSettings"]; ok {
+			contestUpdate.LanguageSettings = nil
+			if raw, _ := getFormValue(form, "languageSettings"); strings.TrimSpace(raw) != "" {
+				if err := json.Unmarshal([]byte(raw), &contestUpdate.LanguageSettings); err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid languageSettings"})
+				}
+			}
+			clearable = append(clearable, "language_settings")
+		}
+		signature, err := parseSignature(form)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		contestUpdate.Signature = signature
+
 		// Handle contestRules file upload (look for contestRules[0])
 		if files, ok := form.File["contestRules[0]"]; ok && len(files) > 0 {
 			pdfData, err := util.HandlePDFUpload(files)
@@ -287,11 +422,53 @@ func (h *ContestHandler) EditContest(c *fiber.Ctx) error {
 			}
 			contestUpdate.ContestRules = &pdfData
 		}
+
+		// Handle the custom checker program (look for checkerFile[0])
+		if files, ok := form.File["checkerFile[0]"]; ok && len(files) > 0 {
+			checkerData, err := util.HandleTestFileUpload(files)
+			if err != nil {
+				return util.HandleError(c, err.Error())
+			}
+			contestUpdate.CheckerSource = &checkerData
+		}
+
+		// Handle the interactor of interactive contests (look for interactorFile[0])
+		if files, ok := form.File["interactorFile[0]"]; ok && len(files) > 0 {
+			interactorData, err := util.HandleTestFileUpload(files)
+			if err != nil {
+				return util.HandleError(c, err.Error())
+			}
+			contestUpdate.InteractorSource = &interactorData
+		}
 	} else {
 		if err := c.BodyParser(&contestUpdate); err != nil {
 			fmt.Println("Error parsing request body:", err)
 			return util.HandleError(c, "Invalid request body")
 		}
+		// A JSON body only clears the lists it names, e.g. "allowedLanguages": []
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(c.Body(), &fields); err == nil {
+			if _, ok := fields["allowedLanguages"]; ok {
+				clearable = append(clearable, "allowed_languages")
+			}
+			if _, ok := fields["languageSettings"]; ok {
+				clearable = append(clearable, "language_settings")
+			}
+		}
+	}
+
+	if contestUpdate.Language != "" && !isValidLanguage(contestUpdate.Language) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid language"})
+	}
+
+	for _, language := range contestUpdate.AllowedLanguages {
+		if !isValidLanguage(language) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Invalid language: %s", language)})
+		}
+	}
+
+	if err := validateLanguageSettings(contestUpdate.LanguageSettings); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	// After parsing contestUpdate, add the check for inviteOnly && isPublic
@@ -323,7 +500,50 @@ func (h *ContestHandler) EditContest(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := h.ContestService.EditContest(ctx, id, &contestUpdate); err != nil {
+	// Like on creation, the language of the contest is always allowed, also when only one of them changes
+	language := existingContest.Language
+	if contestUpdate.Language != "" {
+		language = contestUpdate.Language
+	}
+	allowedLanguages := existingContest.AllowedLanguages
+	if slices.Contains(clearable, "allowed_languages") {
+		allowedLanguages = contestUpdate.AllowedLanguages
+	}
+	if len(allowedLanguages) > 0 && !allowedLanguages.Contains(language) {
+		allowedLanguages = append(slices.Clone(allowedLanguages), language)
+		contestUpdate.AllowedLanguages = allowedLanguages
+		if !slices.Contains(clearable, "allowed_languages") {
+			clearable = append(clearable, "allowed_languages")
+		}
+	}
+	updatedLanguages := (&models.Contest{Language: language, AllowedLanguages: allowedLanguages}).Languages()
+
+	hasCheckerProgram := contestUpdate.CheckerSource != nil || existingContest.CheckerSource != nil
+	if err := validateChecker(contestUpdate.CheckerConfig, hasCheckerProgram); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if contestUpdate.Interactive && contestUpdate.InteractorSource == nil && existingContest.InteractorSource == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Interactive contests require an interactor"})
+	}
+
+	// The signature must fit the languages, the interactive flag and the test cases the contest has after the update
+	signature := contestUpdate.Signature
+	if signature == nil {
+		signature = existingContest.Signature
+	}
+	if signature != nil {
+		if err := validateSignature(signature, updatedLanguages, contestUpdate.Interactive || existingContest.Interactive); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		for i, testCase := range existingContest.TestCases {
+			if err := validateSignatureTestCase(signature, testCase); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("test case %d: %v", i+1, err)})
+			}
+		}
+	}
+
+	if err := h.ContestService.EditContest(ctx, id, &contestUpdate, clearable...); err != nil {
 		log.Printf("Error updating contest: %v", err)
 		return util.HandleError(c, "Failed to update contest")
 	}
@@ -362,6 +582,16 @@ func (h *ContestHandler) AddTestCase(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := validateChecker(testCase.CheckerConfig, existingContest.CheckerSource != nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if existingContest.Signature != nil {
+		if err := validateSignatureTestCase(existingContest.Signature, testCase); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	if err := h.ContestService.AddTestCase(ctx, contestID, &testCase); err != nil {
 		log.Printf("Error adding test case: %v", err)
 		return util.HandleError(c, "Failed to add test case")
@@ -403,6 +633,16 @@ func (h *ContestHandler) UpdateTestCase(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := validateChecker(testCase.CheckerConfig, existingContest.CheckerSource != nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if existingContest.Signature != nil {
+		if err := validateSignatureTestCase(existingContest.Signature, testCase); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
 	if err := h.ContestService.UpdateTestCase(ctx, &testCase); err != nil {
 		log.Printf("Error updating test case: %v", err)
 		return util.HandleError(c, "Failed to update test case")
@@ -447,6 +687,45 @@ func (h *ContestHandler) DeleteTestCase(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Test case deleted successfully"})
 }
 
+// GetContestLLMUsage returns the usage and cost of the model calls made for a contest with its latest calls.
+// Only the contest owner can see it.
+func (h *ContestHandler) GetContestLLMUsage(c *fiber.Ctx) error {
+	contestID := c.Params("contestId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID := c.Locals("userID").(string)
+	existingContest, err := h.ContestService.FindContestByID(ctx, contestID, userID)
+	if err != nil {
+		if err.Error() == "access denied" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this contest",
+			})
+		}
+		return util.HandleError(c, "Failed to fetch contest")
+	}
+
+	if existingContest.OwnerID != userID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the contest owner can see the model usage",
+		})
+	}
+
+	summary, err := h.LLMUsageService.GetContestUsage(ctx, contestID)
+	if err != nil {
+		log.Printf("Error fetching model usage: %v", err)
+		return util.HandleError(c, "Failed to fetch model usage")
+	}
+	records, err := h.LLMUsageService.GetContestUsageRecords(ctx, contestID, util.LLM_USAGE_RECORDS_LIMIT)
+	if err != nil {
+		log.Printf("Error fetching model usage: %v", err)
+		return util.HandleError(c, "Failed to fetch model usage")
+	}
+
+	return c.JSON(fiber.Map{"summary": summary, "calls": records})
+}
+
 // GetUserOwnedContests gets all contests owned by a specific user
 func (h *ContestHandler) GetUserOwnedContests(c *fiber.Ctx) error {
 	userId := c.Params("userId")
@@ -514,6 +793,20 @@ func validateContest(contest *models.Contest) error {
 	return validate.Struct(contest)
 }
 
+// validateChecker makes sure the checker settings of a contest or test case can be used for judging
+func validateChecker(config models.CheckerConfig, hasCheckerProgram bool) error {
+	if !config.Checker.IsValid() {
+		return fmt.Errorf("invalid checker: %s", config.Checker)
+	}
+	if config.AbsEpsilon < 0 || config.RelEpsilon < 0 {
+		return fmt.Errorf("checker epsilons must not be negative")
+	}
+	if config.Checker == models.CheckerCustom && !hasCheckerProgram {
+		return fmt.Errorf("the custom checker requires a checker program")
+	}
+	return nil
+}
+
 // Add this helper function at the end of the file
 func getFormValue(form *multipart.Form, key string) (string, error) {
 	values, ok := form.Value[key]
@@ -534,3 +827,99 @@ func parseBool(str string, defaultVal bool) bool {
 	}
 	return defaultVal
 }
+
+// validateLanguageSettings checks the per-language settings of a contest against the language registry and the limits
+func validateLanguageSettings(settings models.LanguageSettings) error {
+	for name, setting := range settings {
+		language, ok := config.Languages.Get(name)
+		if !ok {
+			return fmt.Errorf("invalid language in languageSettings: %s", name)
+		}
+		if setting.TimeMultiplier < 0 || setting.TimeMultiplier > util.MAX_TIME_MULTIPLIER {
+			return fmt.Errorf("time multiplier of %s must be between 0 and %d", language.Name, util.MAX_TIME_MULTIPLIER)
+		}
+		if setting.ExtraMemoryMB != nil && (*setting.ExtraMemoryMB < 0 || *setting.ExtraMemoryMB > util.MAX_EXTRA_MEMORY) {
+			return fmt.Errorf("extra memory of %s must be between 0 and %d MB", language.Name, util.MAX_EXTRA_MEMORY)
+		}
+		if err := language.CheckCompilerFlags(setting.CompilerFlags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSignature parses the optional signature of a function-signature problem from its JSON form value
+func parseSignature(form *multipart.Form) (*models.FunctionSignature, error) {
+	raw, _ := getFormValue(form, "signature")
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var signature models.FunctionSignature
+	if err := json.Unmarshal([]byte(raw), &signature); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	return &signature, nil
+}
+
+// validateSignature makes sure a function-signature problem can be judged in every language of the contest
+func validateSignature(signature *models.FunctionSignature, languages models.LanguageList, interactive bool) error {
+	if err := signature.Validate(); err != nil {
+		return err
+	}
+	if interactive {
+		return fmt.Errorf("interactive contests cannot declare a function signature")
+	}
+	for _, name := range languages {
+		language, ok := config.Languages.Get(name)
+		if !ok || !language.SupportsSignatures() {
+			return fmt.Errorf("%s does not support function-signature problems", name)
+		}
+	}
+	return nil
+}
+
+// validateSignatureTestCase checks that a test case holds JSON arguments and a JSON result matching the signature
+func validateSignatureTestCase(signature *models.FunctionSignature, testCase models.TestCase) error {
+	if err := signature.CheckArguments(testCase.Input); err != nil {
+		return err
+	}
+	return signature.CheckResult(testCase.Output)
+}
+
+// parseLanguageList parses the form values of a language list, each a JSON array or comma separated names.
+// Every language must be in the registry, duplicates are dropped.
+func parseLanguageList(values []string) (models.LanguageList, error) {
+	var languages models.LanguageList
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		var names []string
+		if strings.HasPrefix(value, "[") {
+			if err := json.Unmarshal([]byte(value), &names); err != nil {
+				return nil, fmt.Errorf("invalid language list: %w", err)
+			}
+		} else {
+			names = strings.Split(value, ",")
+		}
+
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" || languages.Contains(name) {
+				continue
+			}
+			if !isValidLanguage(name) {
+				return nil, fmt.Errorf("invalid language: %s", name)
+			}
+			languages = append(languages, name)
+		}
+	}
+	return languages, nil
+}
+
+// parseFloat parses an optional float form value, an empty string is 0
+func parseFloat(str string) (float64, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(str, 64)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"backend/services"
+	"backend/util"
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type DependencyCacheHandler struct {
+	UserService *services.UserService
+}
+
+func NewDependencyCacheHandler(db *gorm.DB) *DependencyCacheHandler {
+	userService := services.NewUserService(db)
+	return &DependencyCacheHandler{
+		UserService: userService,
+	}
+}
+
+// requireAdmin answers with an error and returns false unless the user is an admin
+func (h *DependencyCacheHandler) requireAdmin(c *fiber.Ctx) bool {
+	userID := c.Locals("userID").(string)
+	user, err := h.UserService.FindUserByID(context.Background(), userID)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get user"})
+		return false
+	}
+
+	if !user.IsAdmin() {
+		c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not authorized to manage the dependency cache"})
+		return false
+	}
+	return true
+}
+
+// GetDependencyCache returns the size and number of entries of the dependency cache of repository submissions, admins only
+func (h *DependencyCacheHandler) GetDependencyCache(c *fiber.Ctx) error {
+	if !h.requireAdmin(c) {
+		return nil
+	}
+
+	cache := util.GetDependencyCache()
+	if cache == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "The dependency cache is disabled"})
+	}
+	return c.JSON(cache.Stats())
+}
+
+// PurgeDependencyCache removes every entry of the dependency cache that no submission is using, admins only
+func (h *DependencyCacheHandler) PurgeDependencyCache(c *fiber.Ctx) error {
+	if !h.requireAdmin(c) {
+		return nil
+	}
+
+	cache := util.GetDependencyCache()
+	if cache == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "The dependency cache is disabled"})
+	}
+
+	removed, freed, err := cache.Purge()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Failed to purge the dependency cache: " + err.Error(),
+			"removed":    removed,
+			"freedBytes": freed,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"removed":    removed,
+		"freedBytes": freed,
+		"cache":      cache.Stats(),
+	})
+}
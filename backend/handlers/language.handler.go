@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"backend/config"
+	"backend/services"
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type LanguageHandler struct {
+	UserService *services.UserService
+}
+
+func NewLanguageHandler(db *gorm.DB) *LanguageHandler {
+	userService := services.NewUserService(db)
+	return &LanguageHandler{
+		UserService: userService,
+	}
+}
+
+// ListLanguages returns the language registry with images, commands and harnesses, admins only
+func (h *LanguageHandler) ListLanguages(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	user, err := h.UserService.FindUserByID(context.Background(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get user"})
+	}
+
+	if !user.IsAdmin() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You are not authorized to view the language registry"})
+	}
+
+	return c.JSON(config.Languages.List())
+}
@@ -20,9 +20,28 @@ func NewLeaderboardHandler(db *gorm.DB) *LeaderboardHandler {
 }
 
 func (h *LeaderboardHandler) GetLeaderboard(c *fiber.Ctx) error {
-	leaderboard, err := h.LeaderboardService.GetLeaderboard(c.Context())
+	// ?language=Go ranks by the submissions in one language only
+	leaderboard, err := h.LeaderboardService.GetLeaderboard(c.Context(), c.Query("language"))
 	if err != nil {
 		return util.HandleError(c, "Failed to fetch leaderboard")
 	}
 	return c.JSON(leaderboard)
 }
+
+// GetContestStandings ranks the participants of a contest, optionally only by their submissions in ?language=
+func (h *LeaderboardHandler) GetContestStandings(c *fiber.Ctx) error {
+	standings, err := h.LeaderboardService.GetContestStandings(c.Context(), c.Params("contestId"), c.Query("language"))
+	if err != nil {
+		return util.HandleError(c, "Failed to fetch standings")
+	}
+	return c.JSON(standings)
+}
+
+// GetContestStats returns submission counts and scores of a contest by language
+func (h *LeaderboardHandler) GetContestStats(c *fiber.Ctx) error {
+	stats, err := h.LeaderboardService.GetContestStats(c.Context(), c.Params("contestId"))
+	if err != nil {
+		return util.HandleError(c, "Failed to fetch contest stats")
+	}
+	return c.JSON(stats)
+}
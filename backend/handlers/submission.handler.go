@@ -2,12 +2,13 @@ package handlers
 
 import (
 	"backend/models"
-	"backend/operations"
 	"backend/services"
 	"backend/util"
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -18,9 +19,10 @@ type SubmissionHandler struct {
 	SubmissionService *services.SubmissionService
 	ContestService    *services.ContestService
 	UserService       *services.UserService
+	JudgeService      *services.JudgeService
 }
 
-func NewSubmissionHandler(db *gorm.DB) *SubmissionHandler {
+func NewSubmissionHandler(db *gorm.DB, judgeService *services.JudgeService) *SubmissionHandler {
 	submissionService := services.NewSubmissionService(db)
 	userService := services.NewUserService(db)
 	contestService := services.NewContestService(db)
@@ -28,105 +30,54 @@ func NewSubmissionHandler(db *gorm.DB) *SubmissionHandler {
 		SubmissionService: submissionService,
 		UserService:       userService,
 		ContestService:    contestService,
+		JudgeService:      judgeService,
 	}
 }
 
+// CreateSubmission stores the submission as queued and hands it over to the judge workers.
+// The client receives the submission ID right away and can follow its status via GET /submission/:id.
 func (h *SubmissionHandler) CreateSubmission(c *fiber.Ctx) error {
 	submission := new(models.Submission)
 	if err := c.BodyParser(submission); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid payload"})
 	}
 
-	var timeout time.Duration
-	if submission.IsRepo {
-		timeout = 120 * time.Second // 120 seconds timeout for repository submissions
-	} else {
-		timeout = 60 * time.Second // 60 seconds for regular code submissions
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	contestID := c.Params("contestId")
-	submission.CreatedAt = time.Now().Format(time.RFC3339)
 
 	if submission.IsRepo {
-		return h.handleRepoSubmission(c, ctx, submission, contestID)
-	}
-
-	testCases, err := h.SubmissionService.GetContestTestCases(ctx, contestID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching test cases"})
-	}
-	return h.handleCodeSubmission(c, ctx, submission, contestID, testCases)
-}
-
-func (h *SubmissionHandler) handleRepoSubmission(c *fiber.Ctx, ctx context.Context, submission *models.Submission, contestID string) error {
-	testFiles, err := h.SubmissionService.GetContestTestFiles(ctx, contestID)
-	if err != nil {
-		return util.HandleError(c, "Error fetching test files")
-	}
-
-	// If no test files, return an error
-	if testFiles == nil {
-		return util.HandleError(c, "No test files available for this contest")
-	}
-
-	statusCode, _, score, passed, passedTestCases, totalTestCases, err := operations.RunRepoTestCases(submission.Code, testFiles, c.Locals("githubToken").(string))
-	if err != nil {
-		return util.HandleError(c, "Error cloning repository", fiber.Map{"message": err.Error()})
-	}
-
-	return h.finalizeSubmission(c, ctx, submission, contestID, statusCode, score, passed, passedTestCases, totalTestCases)
-}
-
-func (h *SubmissionHandler) handleCodeSubmission(c *fiber.Ctx, ctx context.Context, submission *models.Submission, contestID string, testCases []models.TestCase) error {
-	contest, err := h.ContestService.FindContestByID(ctx, contestID, submission.OwnerID)
-	if err != nil {
-		return util.HandleError(c, "Error fetching contest")
-	}
-
-	// Use the enhanced function with resource stats
-	statusCode, results, score, passed, passedTestCases, totalTestCases, execResults, err := operations.RunCodeTestCasesWithStats(submission.Language, submission.Code, testCases, contest.EnableAICodeEntryIdentification)
-	if err != nil {
-		return util.HandleError(c, "Error running test cases")
-	}
-
-	var testCaseResults []models.TestCaseResult
-	if err := json.Unmarshal(results, &testCaseResults); err != nil {
-		return util.HandleError(c, "Error parsing test case results")
-	}
-
-	// Add the execution results to the submission
-	submission.TestCasesResults = testCaseResults
-
-	// Find max CPU and memory usage
-	var maxCPUUsage float64
-	var maxMemoryUsage int64
+		testFiles, err := h.SubmissionService.GetContestTestFiles(ctx, contestID)
+		if err != nil {
+			return util.HandleError(c, "Error fetching test files")
+		}
 
-	for _, result := range execResults {
-		if result.CPUUsage > maxCPUUsage {
-			maxCPUUsage = result.CPUUsage
+		// If no test files, return an error
+		if testFiles == nil {
+			return util.HandleError(c, "No test files available for this contest")
 		}
-		if result.MemUsage > maxMemoryUsage {
-			maxMemoryUsage = result.MemUsage
+	} else {
+		// Code must be in one of the contest's languages, repositories are run by its test framework instead
+		allowedLanguages, err := h.SubmissionService.GetContestLanguages(ctx, contestID)
+		if err != nil {
+			return util.HandleError(c, "Error fetching contest")
+		}
+		if !allowedLanguages.Contains(submission.Language) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":            fmt.Sprintf("Language %q is not allowed in this contest", submission.Language),
+				"allowedLanguages": allowedLanguages,
+			})
 		}
 	}
 
-	submission.MaxCPUUsage = maxCPUUsage
-	submission.MaxMemoryUsage = int(maxMemoryUsage)
-
-	return h.finalizeSubmission(c, ctx, submission, contestID, statusCode, score, passed, passedTestCases, totalTestCases)
-}
-
-func (h *SubmissionHandler) finalizeSubmission(c *fiber.Ctx, ctx context.Context, submission *models.Submission, contestID string,
-	statusCode int, score int, passed bool, passedTestCases int, totalTestCases int) error {
-
-	fmt.Printf("Finalizing submission - ContestID: %s, UserID: %v, Score: %d, Passed: %v\n",
-		contestID, c.Locals("userID"), score, passed)
-
 	submission.ContestID = contestID
 	submission.OwnerID = c.Locals("userID").(string)
+	submission.Status = false
+	submission.Score = 0
+	submission.Verdict = ""
+	submission.TestCasesResults = nil
+	submission.CreatedAt = time.Now().Format(time.RFC3339)
 
 	// Get the user to set the owner name
 	user, err := h.UserService.FindUserByID(ctx, submission.OwnerID)
@@ -137,22 +88,13 @@ func (h *SubmissionHandler) finalizeSubmission(c *fiber.Ctx, ctx context.Context
 		submission.OwnerName = user.Name
 	}
 
-	submission.Status = passed
-	submission.Score = float64(score)
-	submission.CreatedAt = time.Now().Format(time.RFC3339)
-	submission.TotalTestCases = totalTestCases
-	submission.PassedTestCases = passedTestCases
-
-	fmt.Printf("Submission before save: %+v\n", submission)
-
-	// Use the context for database operation
-	record, err := h.SubmissionService.CreateSubmission(ctx, submission)
+	record, err := h.JudgeService.Submit(ctx, submission)
 	if err != nil {
-		fmt.Printf("Error in finalizeSubmission: %v\n", err)
+		fmt.Printf("Error in CreateSubmission: %v\n", err)
 		return util.HandleError(c, "Error saving submission")
 	}
 
-	return c.Status(statusCode).JSON(record)
+	return c.Status(fiber.StatusAccepted).JSON(record)
 }
 
 func (h *SubmissionHandler) GetSubmissionsByOwnerID(c *fiber.Ctx) error {
@@ -176,7 +118,13 @@ func (h *SubmissionHandler) GetSubmissionsByContestID(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	submissions, err := h.SubmissionService.GetSubmissionsByContestID(ctx, contestID)
+	// Graders can narrow the list down with ?verdict=WA
+	verdict := models.Verdict(strings.ToUpper(c.Query("verdict")))
+	if verdict != "" && !verdict.IsValid() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid verdict"})
+	}
+
+	submissions, err := h.SubmissionService.GetSubmissionsByContestID(ctx, contestID, verdict)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Error fetching submissions"})
 	}
@@ -210,3 +158,101 @@ func (h *SubmissionHandler) GetSubmissionByID(c *fiber.Ctx) error {
 		"submission": submission,
 	})
 }
+
+// StreamSubmissionEvents streams the judging progress of a submission as Server-Sent Events.
+// One "testcase" event is sent per finished public test case and a final "summary" event ends the stream.
+func (h *SubmissionHandler) StreamSubmissionEvents(c *fiber.Ctx) error {
+	contestID := c.Params("contestId")
+	submissionID := c.Params("submissionId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Subscribe before reading the submission so that no event can slip in between
+	history, events, unsubscribe := h.JudgeService.Events.Subscribe(submissionID)
+
+	submission, err := h.SubmissionService.FindSubmissionByID(ctx, submissionID)
+	if err != nil || submission.ContestID != contestID {
+		unsubscribe()
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Submission not found",
+		})
+	}
+
+	// Contest access alone is not enough, only the author and the contest owner may follow a submission
+	userID := c.Locals("userID").(string)
+	if submission.OwnerID != userID {
+		contest, err := h.ContestService.FindContestByID(ctx, contestID, userID)
+		if err != nil || contest.OwnerID != userID {
+			unsubscribe()
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have access to this submission",
+			})
+		}
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Disable proxy buffering
+
+	// Judging already finished, there is nothing left to stream
+	if submission.JudgeStatus == models.SubmissionStatusJudged || submission.JudgeStatus == models.SubmissionStatusFailed {
+		// The summary may have been published by another instance, drop whatever this one still holds
+		h.JudgeService.Events.Close(submissionID)
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			writeJudgeEvent(w, services.JudgeEvent{Type: services.JudgeEventSummary, Data: services.NewJudgeSummary(submission)})
+		})
+		return nil
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		if err := writeJudgeEvent(w, services.JudgeEvent{Type: services.JudgeEventStatus, Data: services.JudgeStatusUpdate{JudgeStatus: submission.JudgeStatus}}); err != nil {
+			return
+		}
+		for _, event := range history {
+			if err := writeJudgeEvent(w, event); err != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return // Summary was sent, the stream is over
+				}
+				if err := writeJudgeEvent(w, event); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				// Comment line keeps proxies from closing an idle connection and detects gone clients
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+// writeJudgeEvent writes a single SSE message and flushes it to the client
+func writeJudgeEvent(w *bufio.Writer, event services.JudgeEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"backend/config"
+	"backend/operations"
 	"backend/routes"
+	"backend/services"
 	"log"
+	"os"
+	"strconv"
 
 	"backend/util"
 
@@ -19,6 +23,11 @@ func main() {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
 
+	// The registry may come from JUDGE_LANGUAGES_FILE, which is only known once .env is loaded
+	if err := config.InitLanguages(); err != nil {
+		log.Fatalf("Failed to load languages: %v", err)
+	}
+
 	// Initialize PostgreSQL database with GORM
 	db, err := config.InitDatabase()
 	if err != nil {
@@ -33,6 +42,21 @@ func main() {
 	// Ensure admin users are set
 	util.EnsureAdminUsers(db)
 
+	// Model calls, e.g. to identify entry points, are recorded per contest
+	util.SetLLMUsageRecorder(services.NewLLMUsageService(db).RecordUsage)
+
+	// Start the judge workers that process queued submissions
+	judgeWorkers, err := strconv.Atoi(os.Getenv("JUDGE_WORKERS"))
+	if err != nil || judgeWorkers <= 0 {
+		judgeWorkers = 4
+	}
+	sandbox, err := operations.NewSandbox()
+	if err != nil {
+		log.Fatalf("Failed to initialize the judge sandbox: %v", err)
+	}
+	judgeService := services.NewJudgeService(db, judgeWorkers, sandbox)
+	judgeService.Start()
+
 	app := fiber.New()
 
 	app.Use(logger.New())
@@ -45,7 +69,7 @@ func main() {
 		AllowCredentials: false,
 	}))
 
-	routes.Setup(app, db)
+	routes.Setup(app, db, judgeService)
 
 	log.Println("Server starting on port 3001")
 	if err := app.Listen(":3001"); err != nil {
@@ -0,0 +1,31 @@
+package models
+
+// CheckerType selects how the output of a submission is compared with the expected output
+type CheckerType string
+
+const (
+	CheckerDefault         CheckerType = ""                 // Legacy comparison: collapses whitespace and ignores the case of short outputs
+	CheckerExact           CheckerType = "exact"            // Must match exactly, apart from trailing whitespace at the end of the output
+	CheckerTokens          CheckerType = "tokens"           // Whitespace separated tokens must match
+	CheckerCaseInsensitive CheckerType = "case_insensitive" // Whitespace separated tokens must match, ignoring case
+	CheckerFloat           CheckerType = "float"            // Numbers may differ by AbsEpsilon or RelEpsilon, other tokens must match
+	CheckerCustom          CheckerType = "custom"           // The contest's checker program decides
+	CheckerJSON            CheckerType = "json"             // Must be the same JSON value, numbers may differ like with CheckerFloat
+)
+
+// IsValid reports whether c is one of the known checkers
+func (c CheckerType) IsValid() bool {
+	switch c {
+	case CheckerDefault, CheckerExact, CheckerTokens, CheckerCaseInsensitive, CheckerFloat, CheckerCustom, CheckerJSON:
+		return true
+	}
+	return false
+}
+
+// CheckerConfig is set on a contest and can be overridden per test case.
+// A test case without a checker uses the one of its contest.
+type CheckerConfig struct {
+	Checker    CheckerType `json:"checker,omitempty" gorm:"type:varchar(50);column:checker"`
+	AbsEpsilon float64     `json:"absEpsilon,omitempty" gorm:"type:float;column:abs_epsilon"` // Only used by the float and JSON checkers
+	RelEpsilon float64     `json:"relEpsilon,omitempty" gorm:"type:float;column:rel_epsilon"` // Only used by the float and JSON checkers
+}
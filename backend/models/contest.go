@@ -5,13 +5,14 @@ import (
 )
 
 type TestCase struct {
-	ID          string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	ContestID   string `json:"-" gorm:"type:uuid;index"`
-	Input       string `json:"input" gorm:"type:text"`
-	Output      string `json:"output" gorm:"type:text"`
-	TimeLimit   int    `json:"timeLimit" gorm:"type:int"`
-	MemoryLimit int    `json:"memoryLimit" gorm:"type:int"`
-	Public      bool   `json:"public" gorm:"type:boolean"`
+	ID            string `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ContestID     string `json:"-" gorm:"type:uuid;index"`
+	Input         string `json:"input" gorm:"type:text"`
+	Output        string `json:"output" gorm:"type:text"`
+	TimeLimit     int    `json:"timeLimit" gorm:"type:int"`
+	MemoryLimit   int    `json:"memoryLimit" gorm:"type:int"`
+	Public        bool   `json:"public" gorm:"type:boolean"`
+	CheckerConfig `gorm:"embedded"`
 }
 
 type Contest struct {
@@ -33,4 +34,27 @@ type Contest struct {
 	IsPublic                        bool                `json:"isPublic" gorm:"type:boolean"`
 	InviteOnly                      bool                `json:"inviteOnly" gorm:"type:boolean"`
 	InvitedUsers                    []ContestInvitation `json:"invitedUsers,omitempty" gorm:"foreignKey:ContestID"`
+	CheckerSource                   *[]byte             `json:"-" gorm:"type:bytea;column:checker_source"`                                        // Program used by the custom checker, never sent to participants
+	CheckerLanguage                 string              `json:"checkerLanguage,omitempty" gorm:"type:varchar(100);column:checker_language"`       // Language of CheckerSource, e.g. C++
+	Interactive                     bool                `json:"interactive" gorm:"type:boolean;column:interactive"`                               // Solutions talk to InteractorSource instead of printing an answer
+	InteractorSource                *[]byte             `json:"-" gorm:"type:bytea;column:interactor_source"`                                     // Never sent to participants
+	InteractorLanguage              string              `json:"interactorLanguage,omitempty" gorm:"type:varchar(100);column:interactor_language"` // Language of InteractorSource, e.g. C++
+	StopOnFirstFailure              bool                `json:"stopOnFirstFailure" gorm:"type:boolean;column:stop_on_first_failure"`              // All-or-nothing scoring, remaining test cases are skipped after a failure
+	AllowedLanguages                LanguageList        `json:"allowedLanguages,omitempty" gorm:"type:jsonb;column:allowed_languages"`            // Empty allows only Language
+	LanguageSettings                LanguageSettings    `json:"languageSettings,omitempty" gorm:"type:jsonb;column:language_settings"`            // Time multipliers, extra memory and compiler flags by language
+	Signature                       *FunctionSignature  `json:"signature,omitempty" form:"-" gorm:"type:jsonb;column:signature"`                  // Set for function-signature problems, whose test cases hold JSON arguments and results
+	CheckerConfig                   `gorm:"embedded"`
+}
+
+// Languages returns the languages submissions may use, Language for contests that don't set AllowedLanguages
+func (c *Contest) Languages() LanguageList {
+	if len(c.AllowedLanguages) > 0 {
+		return c.AllowedLanguages
+	}
+	return LanguageList{c.Language}
+}
+
+// AllowsLanguage reports whether submissions in the language are accepted, ignoring case
+func (c *Contest) AllowsLanguage(language string) bool {
+	return c.Languages().Contains(language)
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+type JudgeJobStatus string
+
+const (
+	JudgeJobStatusPending JudgeJobStatus = "pending"
+	JudgeJobStatusLeased  JudgeJobStatus = "leased"
+	JudgeJobStatusDone    JudgeJobStatus = "done"
+	JudgeJobStatusDead    JudgeJobStatus = "dead" // Gave up after MaxAttempts
+)
+
+// JudgeJob is a durable queue entry for a submission that still has to be judged
+type JudgeJob struct {
+	ID             string         `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	SubmissionID   string         `json:"submissionId" gorm:"type:uuid;uniqueIndex;not null"`
+	Status         JudgeJobStatus `json:"status" gorm:"type:varchar(50);index;not null;default:'pending'"`
+	Attempts       int            `json:"attempts" gorm:"type:int;not null;default:0"`
+	MaxAttempts    int            `json:"maxAttempts" gorm:"type:int;not null;default:3"`
+	LeasedBy       string         `json:"leasedBy,omitempty" gorm:"type:varchar(255);column:leased_by"`  // Worker that currently holds the lease
+	LeaseExpiresAt *time.Time     `json:"leaseExpiresAt,omitempty" gorm:"column:lease_expires_at;index"` // After this the job can be taken over
+	AvailableAt    time.Time      `json:"availableAt" gorm:"column:available_at;index;not null"`         // Used to back off retries
+	LastError      string         `json:"lastError,omitempty" gorm:"type:text;column:last_error"`
+	CreatedAt      time.Time      `json:"createdAt" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time      `json:"updatedAt" gorm:"autoUpdateTime"`
+}
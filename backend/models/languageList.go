@@ -0,0 +1,44 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// LanguageList is a set of language names stored as a JSON array
+type LanguageList []string
+
+// Contains reports whether the list has the language, ignoring case
+func (l LanguageList) Contains(language string) bool {
+	language = strings.TrimSpace(language)
+	for _, allowed := range l {
+		if strings.EqualFold(allowed, language) {
+			return true
+		}
+	}
+	return false
+}
+
+// Value stores the list as JSON, an empty list as NULL
+func (l LanguageList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan reads the list from JSON
+func (l *LanguageList) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, l)
+	case string:
+		return json.Unmarshal([]byte(data), l)
+	}
+	return fmt.Errorf("cannot scan %T into LanguageList", value)
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// LanguageSetting adjusts the limits and the compiler of one language in a contest
+type LanguageSetting struct {
+	TimeMultiplier float64  `json:"timeMultiplier,omitempty"` // Applied to the time limit of every test case, 0 uses the language default
+	ExtraMemoryMB  *int     `json:"extraMemoryMB,omitempty"`  // Added to the memory limit of every test case, nil uses the language default
+	CompilerFlags  []string `json:"compilerFlags,omitempty"`  // Replace the default flags, from the allowlist of the language
+}
+
+// LanguageSettings holds the settings of a contest by language name, stored as a JSON object
+type LanguageSettings map[string]LanguageSetting
+
+// For returns the setting of a language, ignoring the case of its name
+func (s LanguageSettings) For(language string) (LanguageSetting, bool) {
+	language = strings.TrimSpace(language)
+	for name, setting := range s {
+		if strings.EqualFold(name, language) {
+			return setting, true
+		}
+	}
+	return LanguageSetting{}, false
+}
+
+// Value stores the settings as JSON, no settings as NULL
+func (s LanguageSettings) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(s)
+}
+
+// Scan reads the settings from JSON
+func (s *LanguageSettings) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, s)
+	case string:
+		return json.Unmarshal([]byte(data), s)
+	}
+	return fmt.Errorf("cannot scan %T into LanguageSettings", value)
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// LLMUsage records one call to the language model made for a contest, e.g. to identify the entry point of a submission
+type LLMUsage struct {
+	ID               string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
+	ContestID        string    `json:"contestId" gorm:"type:uuid;index;not null"`
+	Purpose          string    `json:"purpose" gorm:"type:varchar(100);not null"` // What the model was asked for, e.g. "entry_point"
+	Provider         string    `json:"provider" gorm:"type:varchar(100);not null"`
+	Model            string    `json:"model" gorm:"type:varchar(255);not null"`
+	PromptTokens     int       `json:"promptTokens" gorm:"type:int;column:prompt_tokens"`
+	CompletionTokens int       `json:"completionTokens" gorm:"type:int;column:completion_tokens"`
+	CostUSD          float64   `json:"costUsd" gorm:"type:double precision;column:cost_usd"` // From the token prices configured for the provider
+	DurationMs       int64     `json:"durationMs" gorm:"type:bigint;column:duration_ms"`     // Including retries
+	Attempts         int       `json:"attempts" gorm:"type:int"`
+	Error            string    `json:"error,omitempty" gorm:"type:text"` // Set if the call failed after all attempts
+	CreatedAt        time.Time `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+// LLMUsageSummary adds up the model calls of a contest
+type LLMUsageSummary struct {
+	ContestID        string  `json:"contestId"`
+	Calls            int64   `json:"calls"`
+	FailedCalls      int64   `json:"failedCalls"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	CostUSD          float64 `json:"costUsd"`
+}
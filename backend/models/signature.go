@@ -0,0 +1,226 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// ValueType is the type of a parameter or of the result of a function-signature problem.
+// Scalars can be nested in up to two levels of arrays, e.g. "int[]" or "string[][]".
+type ValueType string
+
+const (
+	TypeInt    ValueType = "int"    // 32-bit integer
+	TypeLong   ValueType = "long"   // 64-bit integer
+	TypeDouble ValueType = "double" // 64-bit floating point number
+	TypeBool   ValueType = "bool"
+	TypeString ValueType = "string"
+)
+
+// maxArrayDepth limits how deeply arrays can be nested
+const maxArrayDepth = 2
+
+// Element returns the type of the elements of an array type, or "" for scalars
+func (t ValueType) Element() ValueType {
+	if element, ok := strings.CutSuffix(string(t), "[]"); ok {
+		return ValueType(element)
+	}
+	return ""
+}
+
+// Scalar returns the scalar type at the bottom of an array type, the type itself for scalars
+func (t ValueType) Scalar() ValueType {
+	return ValueType(strings.TrimRight(string(t), "[]"))
+}
+
+// Depth returns how many levels of arrays the type has, 0 for scalars
+func (t ValueType) Depth() int {
+	return strings.Count(string(t), "[]")
+}
+
+// IsValid reports whether t is a scalar type in at most two levels of arrays
+func (t ValueType) IsValid() bool {
+	switch t.Scalar() {
+	case TypeInt, TypeLong, TypeDouble, TypeBool, TypeString:
+	default:
+		return false
+	}
+	return t.Depth() <= maxArrayDepth && string(t.Scalar())+strings.Repeat("[]", t.Depth()) == string(t)
+}
+
+// Check returns an error if the decoded JSON value doesn't have the type
+func (t ValueType) Check(value interface{}) error {
+	if element := t.Element(); element != "" {
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected %s, got %s", t, jsonKind(value))
+		}
+		for i, item := range items {
+			if err := element.Check(item); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		return nil
+	}
+
+	switch t {
+	case TypeInt, TypeLong:
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected %s, got %s", t, jsonKind(value))
+		}
+		bits := 64
+		if t == TypeInt {
+			bits = 32
+		}
+		if integer, err := number.Int64(); err != nil || integer < -1<<(bits-1) || integer > 1<<(bits-1)-1 {
+			return fmt.Errorf("%s is not a valid %s", number, t)
+		}
+	case TypeDouble:
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected %s, got %s", t, jsonKind(value))
+		}
+		if float, err := number.Float64(); err != nil || math.IsInf(float, 0) {
+			return fmt.Errorf("%s is not a valid %s", number, t)
+		}
+	case TypeBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected %s, got %s", t, jsonKind(value))
+		}
+	case TypeString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected %s, got %s", t, jsonKind(value))
+		}
+	}
+	return nil
+}
+
+// jsonKind names the kind of a decoded JSON value for error messages
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	}
+	return "an object"
+}
+
+// FunctionParameter is a named, typed parameter of a function signature
+type FunctionParameter struct {
+	Name string    `json:"name"`
+	Type ValueType `json:"type"`
+}
+
+// FunctionSignature declares the function that solutions of a function-signature problem implement.
+// Test cases of such a contest hold the arguments as a JSON array in Input and the expected result as JSON in Output.
+type FunctionSignature struct {
+	Name       string              `json:"name"`
+	Parameters []FunctionParameter `json:"parameters"`
+	ReturnType ValueType           `json:"returnType"`
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate returns an error if the signature can't be turned into a harness
+func (s *FunctionSignature) Validate() error {
+	if !identifierPattern.MatchString(s.Name) {
+		return fmt.Errorf("invalid function name: %q", s.Name)
+	}
+	names := make(map[string]bool)
+	for _, parameter := range s.Parameters {
+		if !identifierPattern.MatchString(parameter.Name) || strings.HasPrefix(parameter.Name, "__") {
+			return fmt.Errorf("invalid parameter name: %q", parameter.Name)
+		}
+		if names[parameter.Name] {
+			return fmt.Errorf("parameter %q is declared twice", parameter.Name)
+		}
+		names[parameter.Name] = true
+		if !parameter.Type.IsValid() {
+			return fmt.Errorf("invalid type of parameter %s: %q", parameter.Name, parameter.Type)
+		}
+	}
+	if !s.ReturnType.IsValid() {
+		return fmt.Errorf("invalid return type: %q", s.ReturnType)
+	}
+	return nil
+}
+
+// CheckArguments returns an error if input is not a JSON array of arguments matching the parameters
+func (s *FunctionSignature) CheckArguments(input string) error {
+	value, err := decodeJSON(input)
+	if err != nil {
+		return fmt.Errorf("arguments are not valid JSON: %w", err)
+	}
+	args, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("arguments must be a JSON array")
+	}
+	if len(args) != len(s.Parameters) {
+		return fmt.Errorf("expected %d arguments, got %d", len(s.Parameters), len(args))
+	}
+	for i, parameter := range s.Parameters {
+		if err := parameter.Type.Check(args[i]); err != nil {
+			return fmt.Errorf("argument %s: %w", parameter.Name, err)
+		}
+	}
+	return nil
+}
+
+// CheckResult returns an error if output is not a JSON value of the return type
+func (s *FunctionSignature) CheckResult(output string) error {
+	value, err := decodeJSON(output)
+	if err != nil {
+		return fmt.Errorf("result is not valid JSON: %w", err)
+	}
+	if err := s.ReturnType.Check(value); err != nil {
+		return fmt.Errorf("result: %w", err)
+	}
+	return nil
+}
+
+// decodeJSON decodes a single JSON value, keeping numbers as json.Number
+func decodeJSON(data string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+// Value stores the signature as JSON
+func (s *FunctionSignature) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return json.Marshal(s)
+}
+
+// Scan reads the signature from JSON
+func (s *FunctionSignature) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, s)
+	case string:
+		return json.Unmarshal([]byte(data), s)
+	}
+	return fmt.Errorf("cannot scan %T into FunctionSignature", value)
+}
@@ -5,4 +5,8 @@ type Solution struct {
 	Language string
 	Code     string
 	Input    string `json:"input,omitempty"` // Optional input for the solution
+	// CompilerFlags replace the default compiler flags of the language, empty compiles with the defaults
+	CompilerFlags []string `json:"compilerFlags,omitempty"`
+	// RawOutput skips the language-specific output formatting, e.g. for the JSON printed by signature harnesses
+	RawOutput bool `json:"-"`
 }
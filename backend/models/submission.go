@@ -1,5 +1,14 @@
 package models
 
+type SubmissionStatus string
+
+const (
+	SubmissionStatusQueued  SubmissionStatus = "queued"
+	SubmissionStatusRunning SubmissionStatus = "running"
+	SubmissionStatusJudged  SubmissionStatus = "judged"
+	SubmissionStatusFailed  SubmissionStatus = "failed"
+)
+
 type Submission struct {
 	ID               string           `json:"id,omitempty" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	ContestID        string           `json:"contestID" validate:"required" gorm:"type:uuid;column:contest_id;index;not null"`
@@ -7,6 +16,9 @@ type Submission struct {
 	OwnerName        string           `json:"ownerName,omitempty" gorm:"type:varchar(255);column:owner_name"`
 	Code             string           `json:"code" validate:"required" gorm:"type:text;not null"`
 	Status           bool             `json:"status" validate:"required" gorm:"type:boolean;not null"`
+	JudgeStatus      SubmissionStatus `json:"judgeStatus" gorm:"type:varchar(50);column:judge_status;not null;default:'judged'"`
+	JudgeError       string           `json:"judgeError,omitempty" gorm:"type:text;column:judge_error"` // Set when judging could not be completed
+	Verdict          Verdict          `json:"verdict,omitempty" gorm:"type:varchar(10);index"`          // Most severe test case verdict, see WorstVerdict
 	Score            float64          `json:"score" gorm:"type:float"`
 	CreatedAt        string           `json:"createdAt" validate:"required" gorm:"type:varchar(100);column:created_at;not null"`
 	Language         string           `json:"language" gorm:"type:varchar(100)"`
@@ -1,18 +1,75 @@
 package models
 
+// Verdict explains the outcome of a single test case or of a whole submission
+type Verdict string
+
+const (
+	VerdictAccepted            Verdict = "AC"
+	VerdictWrongAnswer         Verdict = "WA"
+	VerdictTimeLimitExceeded   Verdict = "TLE"
+	VerdictMemoryLimitExceeded Verdict = "MLE"
+	VerdictRuntimeError        Verdict = "RE"
+	VerdictCompilationError    Verdict = "CE"
+	VerdictOutputLimitExceeded Verdict = "OLE"
+)
+
+// verdictPrecedence lists verdicts from the most to the least severe.
+// The overall verdict of a submission is the most severe verdict of its test cases.
+var verdictPrecedence = []Verdict{
+	VerdictCompilationError,
+	VerdictRuntimeError,
+	VerdictMemoryLimitExceeded,
+	VerdictTimeLimitExceeded,
+	VerdictOutputLimitExceeded,
+	VerdictWrongAnswer,
+	VerdictAccepted,
+}
+
+// Severity returns a higher number for more severe verdicts, 0 for unknown ones
+func (v Verdict) Severity() int {
+	for i, verdict := range verdictPrecedence {
+		if verdict == v {
+			return len(verdictPrecedence) - i
+		}
+	}
+	return 0
+}
+
+// IsValid reports whether v is one of the known verdicts
+func (v Verdict) IsValid() bool {
+	return v.Severity() > 0
+}
+
+// WorstVerdict returns the most severe of the given verdicts, or AC if there are none
+func WorstVerdict(verdicts ...Verdict) Verdict {
+	worst := VerdictAccepted
+	for _, verdict := range verdicts {
+		if verdict.Severity() > worst.Severity() {
+			worst = verdict
+		}
+	}
+	return worst
+}
+
 type TestCaseResult struct {
 	ID               string  `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	SubmissionID     string  `json:"-" gorm:"type:uuid;index"`
-	TestCaseID       string  `json:"testCaseId" gorm:"type:uuid;column:test_case_id"`
+	TestCaseID       *string `json:"testCaseId" gorm:"type:uuid;column:test_case_id"` // nil for the specs of repository submissions
+	Name             *string `json:"name,omitempty" gorm:"type:text"`                 // Full name of the spec of a repository submission
+	FailureMessage   *string `json:"failureMessage,omitempty" gorm:"type:text;column:failure_message"`
 	Passed           bool    `json:"status" gorm:"type:boolean"`
-	SolutionOutput   *string `json:"solutionOutput" gorm:"type:text;column:solution_output"`
+	Verdict          Verdict `json:"verdict" gorm:"type:varchar(10);index"`
+	SolutionOutput   *string `json:"solutionOutput" gorm:"type:text;column:solution_output"` // stdout, the only stream that is compared
+	Stderr           *string `json:"stderr,omitempty" gorm:"type:text;column:stderr"`
 	ExpectedOutput   *string `json:"expectedOutput" gorm:"type:text;column:expected_output"`
 	Input            *string `json:"input" gorm:"type:text;column:input"`
 	MemoryUsage      int     `json:"memoryUsage" gorm:"type:int;column:memory_usage"`
 	Time             int     `json:"time" gorm:"type:int"`
 	Score            float64 `json:"score" gorm:"type:float"`
 	CPUUsage         float64 `json:"cpuUsage" gorm:"type:float;column:cpu_usage"`
-	MemoryUsageLimit int     `json:"memoryUsageLimit" gorm:"type:int;column:memory_usage_limit"`
-	TimeLimit        int     `json:"timeLimit" gorm:"type:int;column:time_limit"`
-	
+	MemoryUsageLimit int     `json:"memoryUsageLimit" gorm:"type:int;column:memory_usage_limit"` // Including ExtraMemoryMB
+	TimeLimit        int     `json:"timeLimit" gorm:"type:int;column:time_limit"`                // After applying TimeMultiplier
+	TimeMultiplier   float64 `json:"timeMultiplier" gorm:"type:float;column:time_multiplier"`
+	ExtraMemoryMB    int     `json:"extraMemoryMB" gorm:"type:int;column:extra_memory_mb"`
+	CompilerFlags    string  `json:"compilerFlags,omitempty" gorm:"type:varchar(255);column:compiler_flags"` // Space separated, as passed to the compiler
 }
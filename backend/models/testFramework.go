@@ -0,0 +1,33 @@
+package models
+
+import "strings"
+
+// TestFramework selects how the test file of a repository contest is run against submissions
+type TestFramework string
+
+const (
+	TestFrameworkJest     TestFramework = "jest"
+	TestFrameworkPytest   TestFramework = "pytest"
+	TestFrameworkUnittest TestFramework = "unittest" // Run by pytest, which also collects unittest test cases
+	TestFrameworkMaven    TestFramework = "maven"    // JUnit tests run by Maven Surefire
+	TestFrameworkGradle   TestFramework = "gradle"   // JUnit tests run by Gradle
+	TestFrameworkGoTest   TestFramework = "go"       // go test
+)
+
+// IsValid reports whether f is one of the known test frameworks
+func (f TestFramework) IsValid() bool {
+	switch f {
+	case TestFrameworkJest, TestFrameworkPytest, TestFrameworkUnittest, TestFrameworkMaven, TestFrameworkGradle, TestFrameworkGoTest:
+		return true
+	}
+	return false
+}
+
+// Framework returns the test framework of a repository contest, ignoring case. Contests from before test frameworks
+// were checked may have none, their tests always ran with Jest.
+func (c *Contest) Framework() TestFramework {
+	if c.TestFramework == nil || strings.TrimSpace(*c.TestFramework) == "" {
+		return TestFrameworkJest
+	}
+	return TestFramework(strings.ToLower(strings.TrimSpace(*c.TestFramework)))
+}
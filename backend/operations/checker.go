@@ -0,0 +1,356 @@
+package operations
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/util"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// outputChecker compares the output of a submission using the checker of the test case or, if it has none, of the contest
+type outputChecker struct {
+	contestConfig models.CheckerConfig
+	custom        *customChecker   // Only set when the contest or one of its test cases uses the custom checker
+	numberType    models.ValueType // Scalar return type of a function-signature problem, decides how JSON numbers compare
+}
+
+// newOutputChecker prepares the checkers used by the contest; the custom checker program is compiled once here.
+// Call Close when judging is done.
+func newOutputChecker(ctx context.Context, sandbox util.Sandbox, contest *models.Contest) (*outputChecker, error) {
+	checker := &outputChecker{contestConfig: contest.CheckerConfig}
+	// Results of function-signature problems are JSON, so compare them as such unless the contest chose a checker
+	if contest.Signature != nil && checker.contestConfig.Checker == models.CheckerDefault {
+		checker.contestConfig.Checker = models.CheckerJSON
+	}
+	if contest.Signature != nil {
+		checker.numberType = contest.Signature.ReturnType.Scalar()
+	}
+
+	usesCustom := contest.Checker == models.CheckerCustom
+	for _, testCase := range contest.TestCases {
+		if testCase.Checker == models.CheckerCustom {
+			usesCustom = true
+		}
+	}
+	if !usesCustom {
+		return checker, nil
+	}
+
+	if contest.CheckerSource == nil || len(*contest.CheckerSource) == 0 {
+		return nil, fmt.Errorf("contest uses a custom checker but no checker program was uploaded")
+	}
+
+	program, err := prepareJudgeProgram(ctx, sandbox, "checker", contest.CheckerLanguage, string(*contest.CheckerSource))
+	if err != nil {
+		return nil, err
+	}
+	checker.custom = &customChecker{program}
+	return checker, nil
+}
+
+// Close removes the workspace of the custom checker
+func (c *outputChecker) Close() {
+	if c.custom != nil {
+		c.custom.Close()
+	}
+}
+
+// Check reports whether actual is an accepted output for the test case. An error means the checker itself failed.
+func (c *outputChecker) Check(ctx context.Context, idx int, testCase models.TestCase, input, expected, actual string) (bool, error) {
+	config := c.contestConfig
+	if testCase.Checker != models.CheckerDefault {
+		config = testCase.CheckerConfig
+	}
+
+	switch config.Checker {
+	case models.CheckerExact:
+		return compareExact(expected, actual), nil
+	case models.CheckerTokens:
+		return compareTokens(expected, actual, false), nil
+	case models.CheckerCaseInsensitive:
+		return compareTokens(expected, actual, true), nil
+	case models.CheckerFloat:
+		return compareFloats(expected, actual, config.AbsEpsilon, config.RelEpsilon), nil
+	case models.CheckerJSON:
+		return compareJSON(expected, actual, c.numberType, config.AbsEpsilon, config.RelEpsilon), nil
+	case models.CheckerCustom:
+		return c.custom.Check(ctx, idx, input, expected, actual)
+	default:
+		return normalizeOutput(actual) == normalizeOutput(expected), nil
+	}
+}
+
+// compareExact ignores line ending style and trailing whitespace at the end of the output only
+func compareExact(expected, actual string) bool {
+	normalize := func(output string) string {
+		return strings.TrimRight(strings.ReplaceAll(output, "\r\n", "\n"), " \t\r\n")
+	}
+	return normalize(expected) == normalize(actual)
+}
+
+func compareTokens(expected, actual string, ignoreCase bool) bool {
+	expectedTokens := strings.Fields(expected)
+	actualTokens := strings.Fields(actual)
+	if len(expectedTokens) != len(actualTokens) {
+		return false
+	}
+
+	for i := range expectedTokens {
+		if ignoreCase {
+			if !strings.EqualFold(expectedTokens[i], actualTokens[i]) {
+				return false
+			}
+		} else if expectedTokens[i] != actualTokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// compareFloats accepts a number if it is within absEpsilon or within relEpsilon relative to the expected value.
+// Tokens that are not numbers in the expected output must match exactly, so must NaN and infinities.
+func compareFloats(expected, actual string, absEpsilon, relEpsilon float64) bool {
+	if absEpsilon <= 0 && relEpsilon <= 0 {
+		absEpsilon = util.DEFAULT_FLOAT_EPSILON
+	}
+
+	expectedTokens := strings.Fields(expected)
+	actualTokens := strings.Fields(actual)
+	if len(expectedTokens) != len(actualTokens) {
+		return false
+	}
+
+	for i := range expectedTokens {
+		expectedValue, err := strconv.ParseFloat(expectedTokens[i], 64)
+		if err != nil || math.IsNaN(expectedValue) || math.IsInf(expectedValue, 0) {
+			if expectedTokens[i] != actualTokens[i] {
+				return false
+			}
+			continue
+		}
+
+		actualValue, err := strconv.ParseFloat(actualTokens[i], 64)
+		if err != nil || math.IsNaN(actualValue) || math.IsInf(actualValue, 0) {
+			return false
+		}
+
+		diff := math.Abs(expectedValue - actualValue)
+		if diff > absEpsilon && diff > relEpsilon*math.Abs(expectedValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareJSON accepts the same JSON value, regardless of formatting and the order of object keys.
+// Numbers of an int or long numberType must be equal exactly, other numbers are compared like by compareFloats.
+// Either way 2 and 2.0 are equal.
+func compareJSON(expected, actual string, numberType models.ValueType, absEpsilon, relEpsilon float64) bool {
+	if absEpsilon <= 0 && relEpsilon <= 0 {
+		absEpsilon = util.DEFAULT_FLOAT_EPSILON
+	}
+
+	decode := func(data string) (interface{}, bool) {
+		decoder := json.NewDecoder(strings.NewReader(data))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil || decoder.More() {
+			return nil, false
+		}
+		return value, true
+	}
+	expectedValue, ok := decode(expected)
+	if !ok {
+		return false
+	}
+	actualValue, ok := decode(actual)
+	if !ok {
+		return false
+	}
+	return jsonValuesEqual(expectedValue, actualValue, numberType, absEpsilon, relEpsilon)
+}
+
+// jsonValuesEqual compares two decoded JSON values, see compareJSON
+func jsonValuesEqual(expected, actual interface{}, numberType models.ValueType, absEpsilon, relEpsilon float64) bool {
+	switch expected := expected.(type) {
+	case json.Number:
+		actual, ok := actual.(json.Number)
+		if !ok {
+			return false
+		}
+		if numberType == models.TypeInt || numberType == models.TypeLong {
+			// A float64 can't hold every long and the epsilon would accept off-by-one answers, so compare exactly
+			expectedValue, ok := new(big.Rat).SetString(expected.String())
+			if !ok {
+				return false
+			}
+			actualValue, ok := new(big.Rat).SetString(actual.String())
+			return ok && expectedValue.Cmp(actualValue) == 0
+		}
+		expectedValue, err := expected.Float64()
+		if err != nil {
+			return false
+		}
+		actualValue, err := actual.Float64()
+		if err != nil || math.IsNaN(actualValue) || math.IsInf(actualValue, 0) {
+			return false
+		}
+		diff := math.Abs(expectedValue - actualValue)
+		return diff <= absEpsilon || diff <= relEpsilon*math.Abs(expectedValue)
+	case []interface{}:
+		actual, ok := actual.([]interface{})
+		if !ok || len(actual) != len(expected) {
+			return false
+		}
+		for i := range expected {
+			if !jsonValuesEqual(expected[i], actual[i], numberType, absEpsilon, relEpsilon) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		actual, ok := actual.(map[string]interface{})
+		if !ok || len(actual) != len(expected) {
+			return false
+		}
+		for key, value := range expected {
+			actualValue, ok := actual[key]
+			if !ok || !jsonValuesEqual(value, actualValue, numberType, absEpsilon, relEpsilon) {
+				return false
+			}
+		}
+		return true
+	default:
+		// Strings, booleans and null
+		return expected == actual
+	}
+}
+
+// judgeProgram is a program uploaded by the contest owner, such as a checker or an interactor.
+// It is compiled once per submission and run in the sandbox like a solution.
+type judgeProgram struct {
+	sandbox    util.Sandbox
+	solution   models.Solution
+	workDir    string
+	sourceFile string
+}
+
+// prepareJudgeProgram compiles the program in its own workspace, which is removed by Close
+func prepareJudgeProgram(ctx context.Context, sandbox util.Sandbox, name string, language string, source string) (*judgeProgram, error) {
+	if language == "" {
+		language = "C++"
+	}
+
+	lang, ok := config.Languages.Get(language)
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s language: %s", name, language)
+	}
+	// The program is run as is, unless the language can't run code without its harness (e.g. Java's class name)
+	if lang.AlwaysWrap {
+		source = lang.WrapCode(source, "")
+	}
+
+	workDir, sourceFile, err := PrepareWorkspace(lang.Extension, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare %s workspace: %w", name, err)
+	}
+
+	program := &judgeProgram{
+		sandbox:    sandbox,
+		solution:   models.Solution{Language: language, Code: source},
+		workDir:    workDir,
+		sourceFile: sourceFile,
+	}
+
+	compileResult, err := CompileCode(ctx, sandbox, program.solution, workDir, sourceFile)
+	if err != nil {
+		util.CleanupTempDir(workDir)
+		return nil, fmt.Errorf("failed to compile %s: %w", name, err)
+	}
+	if compileResult.CompileError {
+		util.CleanupTempDir(workDir)
+		return nil, fmt.Errorf("%s does not compile: %s", name, compileResult.Output)
+	}
+
+	return program, nil
+}
+
+// Close removes the workspace of the program
+func (p *judgeProgram) Close() {
+	util.CleanupTempDir(p.workDir)
+}
+
+// writeTestFiles stores the files of a test case in the workspace and returns their paths as the program sees them.
+// Every test case gets its own files, so that test cases can be run concurrently. Call the returned function to remove them.
+func (p *judgeProgram) writeTestFiles(idx int, extensions []string, contents []string) ([]string, func(), error) {
+	var paths []string
+	var written []string
+	cleanup := func() {
+		for _, path := range written {
+			os.Remove(path)
+		}
+	}
+
+	for i, extension := range extensions {
+		name := fmt.Sprintf("test%d.%s", idx, extension)
+		path := filepath.Join(p.workDir, name)
+		if err := os.WriteFile(path, []byte(contents[i]), 0644); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		written = append(written, path)
+		paths = append(paths, p.sandbox.WorkspacePath(p.workDir, name))
+	}
+	return paths, cleanup, nil
+}
+
+// acceptedByExitCode interprets the exit code of a checker or interactor the way testlib does.
+// 0 accepts, 1 (wrong answer) or 2 (presentation error) rejects, anything else means the program itself failed.
+func acceptedByExitCode(name string, run util.RunResult) (bool, error) {
+	if run.Stats == nil || run.Stats.OOMKilled || (run.Err != nil && run.Stats.ExitCode == 0) {
+		return false, fmt.Errorf("%s failed: %v", name, run.Err)
+	}
+
+	message := strings.TrimSpace(run.Output.Stderr + run.Output.Stdout)
+	switch run.Stats.ExitCode {
+	case 0:
+		return true, nil
+	case 1, 2:
+		log.Printf("The %s rejected the output: %s", name, message)
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s failed with exit code %d: %s", name, run.Stats.ExitCode, message)
+	}
+}
+
+// customChecker is called as `checker <input> <output> <answer>`, where output is the contestant's output
+// and answer the expected one
+type customChecker struct {
+	*judgeProgram
+}
+
+func (c *customChecker) Check(ctx context.Context, idx int, input, expected, actual string) (bool, error) {
+	image, err := getDockerImageForLanguage(c.solution.Language)
+	if err != nil {
+		return false, err
+	}
+
+	args, cleanup, err := c.writeTestFiles(idx, []string{"in", "out", "ans"}, []string{input, actual, expected})
+	if err != nil {
+		return false, err
+	}
+	defer cleanup()
+
+	// The sandbox applies the time limit once the checker has a slot
+	output, stats, err := c.sandbox.Run(ctx, image, c.workDir, c.sourceFile, "", util.CHECKER_TIME_LIMIT, util.CHECKER_MEMORY_LIMIT, args...)
+	return acceptedByExitCode("checker", util.RunResult{Output: output, Stats: stats, Err: err})
+}
@@ -0,0 +1,83 @@
+package operations
+
+import (
+	"backend/models"
+	"context"
+	"testing"
+)
+
+func TestCompareFloats(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     bool
+	}{
+		{"within the epsilon", "0.3 2", "0.30000000000000004 2.0", true},
+		{"off", "1.5", "1.6", false},
+		{"word must match", "YES 1", "NO 1", false},
+		{"finite answer is not nan", "nan", "0", false},
+		{"nan matches itself", "nan", "nan", true},
+		{"finite answer is not inf", "inf", "1e308", false},
+		{"inf matches itself", "inf", "inf", true},
+		{"infinities differ in sign", "-inf", "inf", false},
+		{"answer is not inf", "1", "inf", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareFloats(tt.expected, tt.actual, 0, 0); got != tt.want {
+				t.Errorf("compareFloats(%q, %q) = %v, want %v", tt.expected, tt.actual, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		expected   string
+		actual     string
+		numberType models.ValueType
+		want       bool
+	}{
+		{"formatting", `[1, 2, 3]`, "[1,2,3]\n", models.TypeInt, true},
+		{"object key order", `{"a": 1, "b": [true, null]}`, `{"b":[true,null],"a":1}`, "", true},
+		{"integer written as a float", `2`, `2.0`, models.TypeInt, true},
+		{"long off by one", `9007199254740993`, `9007199254740992`, models.TypeLong, false},
+		{"int within the epsilon", `[1000000000]`, `[1000000000.000000001]`, models.TypeInt, false},
+		{"nested longs", `[[1, 2], [3]]`, `[[1, 2], [4]]`, models.TypeLong, false},
+		{"double within the epsilon", `[0.1, 0.3]`, `[0.1000000001, 0.30000000000000004]`, models.TypeDouble, true},
+		{"double off", `1.5`, `1.6`, models.TypeDouble, false},
+		{"untyped numbers use the epsilon", `{"x": 0.3}`, `{"x": 0.30000000000000004}`, "", true},
+		{"string is not a number", `1`, `"1"`, models.TypeInt, false},
+		{"array length", `[1, 2]`, `[1, 2, 3]`, models.TypeInt, false},
+		{"trailing value", `1`, `1 2`, models.TypeInt, false},
+		{"invalid json", `"a"`, `"a`, models.TypeString, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareJSON(tt.expected, tt.actual, tt.numberType, 0, 0); got != tt.want {
+				t.Errorf("compareJSON(%q, %q, %q) = %v, want %v", tt.expected, tt.actual, tt.numberType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputCheckerComparesSignatureResultsByReturnType(t *testing.T) {
+	contest := &models.Contest{Signature: &models.FunctionSignature{Name: "solve", ReturnType: "long[]"}}
+	checker, err := newOutputChecker(context.Background(), nil, contest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checker.Close()
+
+	testCase := models.TestCase{}
+	if ok, _ := checker.Check(context.Background(), 0, testCase, "", "[123456789012345678]", "[123456789012345679]"); ok {
+		t.Error("a long[] result that is off by one was accepted")
+	}
+	if ok, _ := checker.Check(context.Background(), 0, testCase, "", "[123456789012345678]", "[ 123456789012345678 ]"); !ok {
+		t.Error("an equal long[] result was rejected")
+	}
+}
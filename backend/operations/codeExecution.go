@@ -1,68 +1,76 @@
 package operations
 
 import (
+	"backend/config"
 	"backend/models"
 	"backend/util"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-var (
-	// dockerClient is a singleton instance of the Docker client
-	dockerClient *util.DockerClient
-	clientOnce   sync.Once
-	clientErr    error
-)
+// NewSandbox creates the sandbox that runs submissions. JUDGE_SANDBOX=local runs programs as local processes
+// (e.g. in CI without a Docker daemon), otherwise every program runs in a Docker container.
+func NewSandbox() (util.Sandbox, error) {
+	if os.Getenv("JUDGE_SANDBOX") == "local" {
+		// Initialize with max 5 concurrent processes
+		return util.NewLocalSandbox(5)
+	}
 
-// getDockerClient returns a singleton Docker client instance
-func getDockerClient() (*util.DockerClient, error) {
-	clientOnce.Do(func() {
-		// Initialize with max 5 concurrent containers
+	// Initialize with max 5 concurrent containers
+	var err error
+	for attempts := 0; attempts < 3; attempts++ {
 		var client *util.DockerClient
-		for attempts := 0; attempts < 3; attempts++ {
-			var err error
-			client, err = util.NewDockerClient(5)
-			if err == nil {
-				dockerClient = client
-				clientErr = nil
-				return
-			}
-
-			clientErr = err
-			log.Printf("Failed to initialize Docker client (attempt %d): %v", attempts+1, err)
-			time.Sleep(500 * time.Millisecond)
+		client, err = util.NewDockerClient(5)
+		if err == nil {
+			return client, nil
 		}
 
-		if clientErr != nil {
-			log.Printf("All Docker client initialization attempts failed: %v", clientErr)
-		}
-	})
+		log.Printf("Failed to initialize Docker client (attempt %d): %v", attempts+1, err)
+		time.Sleep(500 * time.Millisecond)
+	}
+	return nil, err
+}
 
-	if clientErr != nil {
-		log.Printf("Using Docker client failed: %v", clientErr)
+// CompileCode compiles the solution in its workspace once, so that test cases only run the artifact.
+// For interpreted languages this is a no-op. A compiler failure is reported through CompileError,
+// the returned error is only set when the compiler could not be run at all.
+func CompileCode(ctx context.Context, sandbox util.Sandbox, solution models.Solution, workDir string, sourceFile string) (util.ExecutionResult, error) {
+	image, err := getDockerImageForLanguage(solution.Language)
+	if err != nil {
+		return util.ExecutionResult{Error: err}, fmt.Errorf("unsupported language: %w", err)
 	}
 
-	return dockerClient, clientErr
-}
+	// Pulling the image must not count against the compile time limit
+	if err := sandbox.Prepare(ctx, image, sourceFile); err != nil {
+		return util.ExecutionResult{Error: err}, fmt.Errorf("failed to prepare sandbox: %w", err)
+	}
 
-// ExecuteCode runs the code in a Docker container and returns the results
-func ExecuteCode(ctx context.Context, solution models.Solution, inputString string, codeFile string, timeLimit int, memoryLimit int) (util.ExecutionResult, error) {
-	// Get the Docker client
-	dockerClient, err := getDockerClient()
+	startTime := time.Now()
+	diagnostics, compiled, err := sandbox.Compile(ctx, image, workDir, sourceFile, solution.CompilerFlags, util.COMPILE_TIME_LIMIT, util.COMPILE_MEMORY_LIMIT)
 	if err != nil {
-		return util.ExecutionResult{
-			TimedOut: false,
-			Error:    err,
-		}, fmt.Errorf("failed to get Docker client: %w", err)
+		return util.ExecutionResult{Error: err}, fmt.Errorf("failed to compile: %w", err)
+	}
+
+	result := util.ExecutionResult{
+		Output:   strings.TrimSpace(diagnostics),
+		Duration: time.Since(startTime).Milliseconds(),
 	}
+	if !compiled {
+		result.CompileError = true
+		result.Error = fmt.Errorf("compilation failed")
+	}
+	return result, nil
+}
 
+// ExecuteCode runs the compiled workspace in the sandbox and returns the results
+func ExecuteCode(ctx context.Context, sandbox util.Sandbox, solution models.Solution, inputString string, workDir string, sourceFile string, timeLimit int, memoryLimit int) (util.ExecutionResult, error) {
 	// Get the Docker image for the language
 	image, err := getDockerImageForLanguage(solution.Language)
 	if err != nil {
@@ -72,17 +80,71 @@ func ExecuteCode(ctx context.Context, solution models.Solution, inputString stri
 		}, fmt.Errorf("unsupported language: %w", err)
 	}
 
-	// Execute the container
-	output, stats, err := dockerClient.ExecuteContainer(ctx, image, codeFile, inputString, timeLimit, memoryLimit)
+	// Execute the program
+	output, stats, err := sandbox.Run(ctx, image, workDir, sourceFile, inputString, timeLimit, memoryLimit)
+
+	return newExecutionResult(solution, util.RunResult{Output: output, Stats: stats, Err: err}, timeLimit, memoryLimit), nil
+}
+
+// warmContainersEnabled reports whether JUDGE_WARM_CONTAINERS asks to run all test cases of a submission
+// in one container instead of starting a container per test case
+func warmContainersEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("JUDGE_WARM_CONTAINERS"))
+	return enabled
+}
+
+// startSession starts a sandbox session for the compiled workspace when warm containers are enabled and the
+// sandbox supports them. It returns nil if test cases should run one by one with ExecuteCode instead.
+func startSession(ctx context.Context, sandbox util.Sandbox, solution models.Solution, workDir string, sourceFile string, testCases []models.TestCase, limits languageLimits) util.SandboxSession {
+	if !warmContainersEnabled() {
+		return nil
+	}
+
+	sessionSandbox, ok := sandbox.(util.SessionSandbox)
+	if !ok {
+		return nil
+	}
+
+	image, err := getDockerImageForLanguage(solution.Language)
+	if err != nil {
+		return nil
+	}
+
+	// The container starts with the highest limit, every run lowers it to its own
+	memoryLimit := 0
+	for _, testCase := range testCases {
+		memoryLimit = max(memoryLimit, applyDefaultIfInvalid(testCase.MemoryLimit, util.DEFAULT_MEMORY_LIMIT, util.MAX_MEMORY_LIMIT))
+	}
+	_, memoryLimit = limits.apply(0, memoryLimit)
+
+	session, err := sessionSandbox.StartSession(ctx, image, workDir, sourceFile, memoryLimit)
+	if err != nil {
+		log.Printf("Failed to start warm container, running a container per test case: %v", err)
+		return nil
+	}
+	return session
+}
+
+// ExecuteCodeInSession runs the compiled workspace for a single test case in the session of the submission
+func ExecuteCodeInSession(ctx context.Context, session util.SandboxSession, solution models.Solution, inputString string, timeLimit int, memoryLimit int) util.ExecutionResult {
+	output, stats, err := session.Run(ctx, inputString, timeLimit, memoryLimit)
+	return newExecutionResult(solution, util.RunResult{Output: output, Stats: stats, Err: err}, timeLimit, memoryLimit)
+}
+
+// newExecutionResult turns a finished container run of the solution into an ExecutionResult
+func newExecutionResult(solution models.Solution, run util.RunResult, timeLimit int, memoryLimit int) util.ExecutionResult {
+	output, stats, err := run.Output, run.Stats, run.Err
 
 	// Create execution result with default values
 	result := util.ExecutionResult{
-		Output:   output,
-		Error:    err,
-		Duration: 0,
-		MemUsage: 0,
-		CPUUsage: 0,
-		TimedOut: false,
+		Output:              output.Stdout,
+		Stderr:              output.Stderr,
+		OutputLimitExceeded: output.Truncated,
+		Error:               err,
+		Duration:            0,
+		MemUsage:            0,
+		CPUUsage:            0,
+		TimedOut:            false,
 	}
 
 	// If we got stats, populate them (even if there was an error)
@@ -91,11 +153,21 @@ func ExecuteCode(ctx context.Context, solution models.Solution, inputString stri
 		result.MemUsage = int64(stats.MemoryUsage)
 		result.CPUUsage = stats.CPUPercent
 		result.TimedOut = stats.Duration >= int64(timeLimit)
+		result.ExitCode = stats.ExitCode
+		result.OOMKilled = stats.OOMKilled
 
 		log.Printf("Container stats: CPU=%.2f%%, Memory=%d bytes (%.2f%%), Duration=%d ms",
 			stats.CPUPercent, stats.MemoryUsage, stats.MemoryPercent, stats.Duration)
 	}
 
+	if result.OOMKilled {
+		log.Printf("Container was killed for exceeding the memory limit of %d MB", memoryLimit)
+	}
+
+	if result.OutputLimitExceeded {
+		log.Printf("Output was truncated at %d bytes", util.OutputLimitBytes())
+	}
+
 	// Check for timeout error
 	if err != nil && strings.Contains(err.Error(), "timed out") {
 		result.TimedOut = true
@@ -103,29 +175,20 @@ func ExecuteCode(ctx context.Context, solution models.Solution, inputString stri
 	}
 
 	// Format the output based on the language
-	if result.Error == nil {
+	if result.Error == nil && !solution.RawOutput {
 		result.Output = formatOutputByLanguage(result.Output, solution.Language)
 	}
 
-	return result, nil
+	return result
 }
 
 // getDockerImageForLanguage returns the appropriate Docker image for the language
 func getDockerImageForLanguage(language string) (string, error) {
-	switch language {
-	case "JavaScript":
-		return "node:14", nil
-	case "Python":
-		return "python:3.8", nil
-	case "Java":
-		return "openjdk:11", nil
-	case "C++":
-		return "gcc:latest", nil
-	case "C#":
-		return "mcr.microsoft.com/dotnet/sdk:6.0", nil
-	default:
+	lang, ok := config.Languages.Get(language)
+	if !ok {
 		return "", fmt.Errorf("unsupported language: %s", language)
 	}
+	return lang.Image, nil
 }
 
 // Normalize output string for comparison to handle whitespace differences
@@ -144,116 +207,248 @@ func normalizeOutput(output string) string {
 	return output
 }
 
-// RunCodeTestCasesWithStats tests code against multiple test cases and returns results with resource stats
-func RunCodeTestCasesWithStats(language string, code string, testCases []models.TestCase, isAIEnabled bool) (int, []byte, int, bool, int, int, []util.ExecutionResult, error) {
-	// First, identify the entry point and create temp file (same as before)
-	entryPoint := "main"
-	if isAIEnabled {
-		var err error
-		entryPoint, err = util.IdentifyCodeEntryPoint(code)
-		if err != nil || entryPoint == "" {
-			log.Printf("Warning: Could not identify entry point, using 'main': %v", err)
-			entryPoint = "main"
-		}
-	}
+// TestCaseProgress describes a finished public test case while a submission is still being judged
+type TestCaseProgress struct {
+	Index       int            `json:"index"`
+	TestCaseID  string         `json:"testCaseId"`
+	Passed      bool           `json:"status"`
+	Verdict     models.Verdict `json:"verdict"`
+	Time        int            `json:"time"`
+	MemoryUsage int            `json:"memoryUsage"`
+}
 
-	extension, modifiedCode := GetFileExtensionAndModifiedCode(language, code, entryPoint)
-	codeFile, err := util.CreateTempFile(modifiedCode, extension)
-	if err != nil {
-		return fiber.StatusInternalServerError, nil, 0, false, 0, 0, nil, fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer cleanupTempFile(codeFile)
+// ProgressFunc is called after every public test case; it may be nil
+type ProgressFunc func(progress TestCaseProgress)
+
+// CodeRunResult is the outcome of running a solution against all test cases of a contest
+type CodeRunResult struct {
+	StatusCode      int
+	Results         []models.TestCaseResult // Only public test cases are included
+	Score           int
+	PassedAll       bool
+	PassedTestCases int
+	TotalTestCases  int
+	ExecResults     []util.ExecutionResult
+	Verdict         models.Verdict // Most severe verdict over all test cases, hidden ones included
+}
 
-	// Handle case with no test cases
-	if len(testCases) == 0 {
-		return fiber.StatusOK, []byte("[]"), 100, true, 0, 0, nil, nil
+// determineVerdict classifies the execution of a single test case
+func determineVerdict(execResult util.ExecutionResult, outputMatches bool, timeLimit int) models.Verdict {
+	switch {
+	case execResult.CompileError:
+		return models.VerdictCompilationError
+	case execResult.OOMKilled:
+		return models.VerdictMemoryLimitExceeded
+	case execResult.TimedOut || int(execResult.Duration) > timeLimit:
+		return models.VerdictTimeLimitExceeded
+	case execResult.OutputLimitExceeded:
+		return models.VerdictOutputLimitExceeded
+	case execResult.Error != nil || execResult.ExitCode != 0:
+		return models.VerdictRuntimeError
+	case !outputMatches:
+		return models.VerdictWrongAnswer
+	default:
+		return models.VerdictAccepted
 	}
+}
 
-	solution := models.Solution{
-		Language: language,
-		Code:     code,
+// nilIfEmpty avoids storing empty stderr output
+func nilIfEmpty(value string) *string {
+	if value == "" {
+		return nil
 	}
+	return &value
+}
 
-	var allResults []models.TestCaseResult
-	var executionResults []util.ExecutionResult
-	totalTestCases := len(testCases)
-	passedTestCases := 0
-
+// compilationErrorResult marks every test case as a compilation error, the diagnostics are shown as output
+func compilationErrorResult(testCases []models.TestCase, compileResult util.ExecutionResult, limits languageLimits, onProgress ProgressFunc) *CodeRunResult {
+	results := []models.TestCaseResult{}
 	for idx, testCase := range testCases {
-		// Apply default limits if invalid values provided
-		timeLimit := applyDefaultIfInvalid(testCase.TimeLimit, util.DEFAULT_TIME_LIMIT, util.MAX_TIME_LIMIT)
-		memoryLimit := applyDefaultIfInvalid(testCase.MemoryLimit, util.DEFAULT_MEMORY_LIMIT, util.MAX_MEMORY_LIMIT)
+		if !testCase.Public {
+			continue
+		}
 
 		input := strings.TrimSpace(testCase.Input)
 		expectedOutput := strings.TrimSpace(testCase.Output)
+		diagnostics := compileResult.Output
+		timeLimit, memoryLimit := limits.apply(
+			applyDefaultIfInvalid(testCase.TimeLimit, util.DEFAULT_TIME_LIMIT, util.MAX_TIME_LIMIT),
+			applyDefaultIfInvalid(testCase.MemoryLimit, util.DEFAULT_MEMORY_LIMIT, util.MAX_MEMORY_LIMIT),
+		)
+		result := models.TestCaseResult{
+			TestCaseID:       &testCase.ID,
+			Passed:           false,
+			Verdict:          models.VerdictCompilationError,
+			SolutionOutput:   &diagnostics,
+			Input:            &input,
+			ExpectedOutput:   &expectedOutput,
+			MemoryUsageLimit: memoryLimit,
+			TimeLimit:        timeLimit,
+		}
+		limits.record(&result)
+		results = append(results, result)
+
+		if onProgress != nil {
+			onProgress(TestCaseProgress{
+				Index:      idx,
+				TestCaseID: testCase.ID,
+				Verdict:    models.VerdictCompilationError,
+			})
+		}
+	}
 
-		// Create a dedicated context for each test case
-		testCtx, cancelTest := context.WithTimeout(context.Background(), 2*time.Duration(timeLimit)*time.Millisecond)
+	return &CodeRunResult{
+		StatusCode:     fiber.StatusOK,
+		Results:        results,
+		Score:          0,
+		TotalTestCases: len(testCases),
+		ExecResults:    []util.ExecutionResult{compileResult},
+		Verdict:        models.VerdictCompilationError,
+	}
+}
 
-		// Execute code with the new Docker client
-		execResult, err := ExecuteCode(testCtx, solution, input, codeFile, timeLimit, memoryLimit)
-		cancelTest() // Cancel the context after execution
+// RunCodeTestCasesWithStats tests code against multiple test cases and returns results with resource stats
+// The contest provides the test cases, the checker and whether AI entry point identification is enabled.
+func RunCodeTestCasesWithStats(ctx context.Context, sandbox util.Sandbox, language string, code string, contest *models.Contest, onProgress ProgressFunc) (*CodeRunResult, error) {
+	testCases := contest.TestCases
 
+	var extension, modifiedCode string
+	if contest.Signature != nil {
+		// Function-signature problems declare the entry point, the harness passes the JSON arguments to it
+		var err error
+		extension, modifiedCode, err = GetSignatureModifiedCode(language, code, contest.Signature)
 		if err != nil {
-			log.Printf("Error executing code for test case #%d: %v", idx+1, err)
+			return &CodeRunResult{StatusCode: fiber.StatusBadRequest}, err
+		}
+	} else {
+		// The harness calls main unless the contest has the entry point identified
+		entryPoint := "main"
+		if contest.EnableAICodeEntryIdentification {
+			var err error
+			entryPoint, err = util.IdentifyCodeEntryPoint(ctx, contest.ID, language, code)
+			if err != nil {
+				return &CodeRunResult{StatusCode: fiber.StatusInternalServerError}, fmt.Errorf("failed to identify the entry point: %w", err)
+			}
 		}
+		extension, modifiedCode = GetFileExtensionAndModifiedCode(language, code, entryPoint)
+	}
+
+	workDir, sourceFile, err := PrepareWorkspace(extension, modifiedCode)
+	if err != nil {
+		return &CodeRunResult{StatusCode: fiber.StatusInternalServerError}, fmt.Errorf("failed to prepare workspace: %w", err)
+	}
+	defer util.CleanupTempDir(workDir)
+
+	// Handle case with no test cases
+	if len(testCases) == 0 {
+		return &CodeRunResult{
+			StatusCode: fiber.StatusOK,
+			Results:    []models.TestCaseResult{},
+			Score:      100,
+			PassedAll:  true,
+			Verdict:    models.VerdictAccepted,
+		}, nil
+	}
 
-		executionResults = append(executionResults, execResult)
+	// Per-language time multipliers, extra memory and compiler flags of the contest
+	limits := resolveLanguageLimits(contest, language)
 
-		// Determine if the test passed based on expected output and time requirements
-		var passed bool
-		if execResult.Error == nil {
-			// Normalize both outputs for comparison
-			normalizedActual := normalizeOutput(execResult.Output)
-			normalizedExpected := normalizeOutput(expectedOutput)
+	solution := models.Solution{
+		Language:      language,
+		Code:          code,
+		CompilerFlags: limits.compilerFlags,
+		RawOutput:     contest.Signature != nil,
+	}
 
-			// Debug the comparison
-			log.Printf("Test Case #%d Comparison: \nExpected: '%s'\nActual:   '%s'\nNormalized Expected: '%s'\nNormalized Actual:   '%s'",
-				idx+1, expectedOutput, execResult.Output, normalizedExpected, normalizedActual)
+	// Compile once for the whole submission, so time limits only measure execution.
+	// The sandbox starts the compile time limit once the compiler has a slot, ctx only bounds the whole job.
+	compileResult, err := CompileCode(ctx, sandbox, solution, workDir, sourceFile)
+	if err != nil {
+		return &CodeRunResult{StatusCode: fiber.StatusInternalServerError}, err
+	}
+	if err := ctx.Err(); err != nil {
+		// A compiler stopped by the deadline of the job is no compilation error
+		return &CodeRunResult{StatusCode: fiber.StatusInternalServerError}, err
+	}
+	if compileResult.CompileError {
+		log.Printf("Compilation failed:\n%s", compileResult.Output)
+		return compilationErrorResult(testCases, compileResult, limits, onProgress), nil
+	}
 
-			passed = normalizedActual == normalizedExpected &&
-				!execResult.TimedOut &&
-				int(execResult.Duration) <= timeLimit
+	checker, err := newOutputChecker(ctx, sandbox, contest)
+	if err != nil {
+		return &CodeRunResult{StatusCode: fiber.StatusInternalServerError}, err
+	}
+	defer checker.Close()
 
-			if passed {
-				passedTestCases++
-			}
+	var judgeInteractor *interactor
+	if contest.Interactive {
+		judgeInteractor, err = newInteractor(ctx, sandbox, contest)
+		if err != nil {
+			return &CodeRunResult{StatusCode: fiber.StatusInternalServerError}, err
 		}
+		defer judgeInteractor.Close()
+	}
 
-		// Create test case result
-		testCaseResult := models.TestCaseResult{
-			TestCaseID:       testCase.ID,
-			Passed:           passed,
-			SolutionOutput:   &execResult.Output,
-			Input:            &input,
-			ExpectedOutput:   &expectedOutput,
-			MemoryUsage:      int(execResult.MemUsage),
-			Time:             int(execResult.Duration),
-			CPUUsage:         execResult.CPUUsage,
-			MemoryUsageLimit: memoryLimit,
-			TimeLimit:        timeLimit,
-		}
+	judge := &submissionJudge{
+		sandbox:    sandbox,
+		solution:   solution,
+		workDir:    workDir,
+		sourceFile: sourceFile,
+		testCases:  testCases,
+		checker:    checker,
+		interactor: judgeInteractor,
+		limits:     limits,
+	}
 
-		log.Printf("Test Case #%d Result: passed=%v, time=%dms, memUsage=%d bytes, CPU=%.2f%%, error=%v",
-			idx+1, testCaseResult.Passed, testCaseResult.Time, execResult.MemUsage, execResult.CPUUsage, execResult.Error)
+	allResults := []models.TestCaseResult{}
+	var executionResults []util.ExecutionResult
+	var verdicts []models.Verdict
+	totalTestCases := len(testCases)
+	passedTestCases := 0
 
+	judged, err := judge.run(ctx, contest.StopOnFirstFailure, func(idx int, testCase judgedTestCase) {
 		// Only include the test case in results if it's public
-		if testCase.Public {
-			allResults = append(allResults, testCaseResult)
+		if testCases[idx].Public && onProgress != nil {
+			onProgress(TestCaseProgress{
+				Index:       idx,
+				TestCaseID:  testCases[idx].ID,
+				Passed:      testCase.result.Passed,
+				Verdict:     testCase.result.Verdict,
+				Time:        testCase.result.Time,
+				MemoryUsage: testCase.result.MemoryUsage,
+			})
 		}
+	})
+	if err != nil {
+		return &CodeRunResult{StatusCode: fiber.StatusInternalServerError}, err
 	}
 
-	// Calculate score percentage and whether all tests passed
-	scorePercentage := calculateScore(totalTestCases, passedTestCases)
-	passedAll := passedTestCases == totalTestCases
+	for idx, testCase := range judged {
+		if testCase == nil {
+			continue // Skipped after an earlier failure
+		}
 
-	jsonResult, err := json.Marshal(allResults)
-	if err != nil {
-		log.Printf("Error marshaling results to JSON: %v", err)
-		return fiber.StatusInternalServerError, nil, 0, false, 0, 0, nil, err
+		executionResults = append(executionResults, testCase.execResult)
+		verdicts = append(verdicts, testCase.result.Verdict)
+		if testCase.result.Passed {
+			passedTestCases++
+		}
+		if testCases[idx].Public {
+			allResults = append(allResults, testCase.result)
+		}
 	}
 
-	return fiber.StatusOK, jsonResult, scorePercentage, passedAll, passedTestCases, totalTestCases, executionResults, nil
+	return &CodeRunResult{
+		StatusCode:      fiber.StatusOK,
+		Results:         allResults,
+		Score:           calculateScore(totalTestCases, passedTestCases),
+		PassedAll:       passedTestCases == totalTestCases,
+		PassedTestCases: passedTestCases,
+		TotalTestCases:  totalTestCases,
+		ExecResults:     executionResults,
+		Verdict:         models.WorstVerdict(verdicts...),
+	}, nil
 }
 
 // formatOutputByLanguage has been moved to codeSubmition.plain.go
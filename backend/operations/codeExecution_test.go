@@ -0,0 +1,231 @@
+package operations
+
+import (
+	"backend/models"
+	"backend/util"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSandbox answers every run with the result run returns for its input, without running anything
+type fakeSandbox struct {
+	compiles bool
+	slotWait time.Duration // How long a run waits for a slot of the pool
+	run      func(input string, timeoutMs int, memoryLimitMB int) (util.ContainerOutput, *util.StatsResult, error)
+
+	mu   sync.Mutex
+	runs int
+}
+
+func (f *fakeSandbox) Prepare(ctx context.Context, image string, sourceFile string) error {
+	return nil
+}
+
+func (f *fakeSandbox) Compile(ctx context.Context, image, workDir, sourceFile string, flags []string, timeoutMs int, memoryLimitMB int) (string, bool, error) {
+	if !f.compiles {
+		return "main.cpp:1: error: expected ';'", false, nil
+	}
+	return "", true, nil
+}
+
+func (f *fakeSandbox) Run(ctx context.Context, image, workDir, sourceFile, inputString string, timeoutMs int, memoryLimitMB int, args ...string) (util.ContainerOutput, *util.StatsResult, error) {
+	select {
+	case <-time.After(f.slotWait):
+	case <-ctx.Done():
+		return util.ContainerOutput{}, nil, ctx.Err()
+	}
+
+	f.mu.Lock()
+	f.runs++
+	f.mu.Unlock()
+	return f.run(inputString, timeoutMs, memoryLimitMB)
+}
+
+func (f *fakeSandbox) RunInteractive(ctx context.Context, solution util.ContainerRun, interactor util.ContainerRun) (util.RunResult, util.RunResult, error) {
+	return util.RunResult{}, util.RunResult{}, errors.ErrUnsupported
+}
+
+func (f *fakeSandbox) RunCommand(ctx context.Context, run util.CommandRun) (util.ContainerOutput, *util.StatsResult, error) {
+	return util.ContainerOutput{}, nil, errors.ErrUnsupported
+}
+
+func (f *fakeSandbox) WorkspacePath(workDir string, name string) string {
+	return filepath.Join(workDir, name)
+}
+
+// runByInput makes the fake program misbehave in the way its input names
+func runByInput(input string, timeoutMs int, memoryLimitMB int) (util.ContainerOutput, *util.StatsResult, error) {
+	stats := &util.StatsResult{Duration: 10, MemoryUsage: 1024}
+	switch input {
+	case "wrong":
+		return util.ContainerOutput{Stdout: "something else"}, stats, nil
+	case "slow":
+		stats.Duration = int64(timeoutMs)
+		return util.ContainerOutput{}, stats, fmt.Errorf("execution timed out after %d ms", timeoutMs)
+	case "hungry":
+		stats.OOMKilled = true
+		stats.ExitCode = 137
+		return util.ContainerOutput{}, stats, fmt.Errorf("memory limit of %d MB exceeded", memoryLimitMB)
+	case "crash":
+		stats.ExitCode = 1
+		return util.ContainerOutput{Stderr: "Traceback"}, stats, fmt.Errorf("container exited with non-zero status: 1")
+	case "chatty":
+		return util.ContainerOutput{Stdout: "chatty chatty", Truncated: true}, stats, nil
+	}
+	return util.ContainerOutput{Stdout: input}, stats, nil
+}
+
+func TestDetermineVerdict(t *testing.T) {
+	tests := []struct {
+		name          string
+		result        util.ExecutionResult
+		outputMatches bool
+		want          models.Verdict
+	}{
+		{"accepted", util.ExecutionResult{Duration: 10}, true, models.VerdictAccepted},
+		{"wrong answer", util.ExecutionResult{Duration: 10}, false, models.VerdictWrongAnswer},
+		{"compile error", util.ExecutionResult{CompileError: true, Error: errors.New("compilation failed")}, false, models.VerdictCompilationError},
+		{"oom kill wins over the exit code", util.ExecutionResult{OOMKilled: true, ExitCode: 137, Error: errors.New("memory")}, false, models.VerdictMemoryLimitExceeded},
+		{"timed out", util.ExecutionResult{TimedOut: true, Error: errors.New("timed out")}, false, models.VerdictTimeLimitExceeded},
+		{"slower than the limit", util.ExecutionResult{Duration: 1001}, true, models.VerdictTimeLimitExceeded},
+		{"output limit", util.ExecutionResult{OutputLimitExceeded: true}, false, models.VerdictOutputLimitExceeded},
+		{"exit code", util.ExecutionResult{ExitCode: 1}, true, models.VerdictRuntimeError},
+		{"sandbox error", util.ExecutionResult{Error: errors.New("exited")}, false, models.VerdictRuntimeError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := determineVerdict(tt.result, tt.outputMatches, 1000); got != tt.want {
+				t.Errorf("determineVerdict() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCodeTestCasesWithStatsVerdicts(t *testing.T) {
+	t.Setenv("JUDGE_WARM_CONTAINERS", "false")
+
+	inputs := []string{"42", "wrong", "slow", "hungry", "crash", "chatty"}
+	want := []models.Verdict{
+		models.VerdictAccepted,
+		models.VerdictWrongAnswer,
+		models.VerdictTimeLimitExceeded,
+		models.VerdictMemoryLimitExceeded,
+		models.VerdictRuntimeError,
+		models.VerdictOutputLimitExceeded,
+	}
+
+	contest := &models.Contest{}
+	for i, input := range inputs {
+		contest.TestCases = append(contest.TestCases, models.TestCase{
+			ID:          fmt.Sprintf("tc-%d", i),
+			Input:       input,
+			Output:      input,
+			TimeLimit:   1000,
+			MemoryLimit: 64,
+			Public:      true,
+		})
+	}
+
+	sandbox := &fakeSandbox{compiles: true, run: runByInput}
+	result, err := RunCodeTestCasesWithStats(context.Background(), sandbox, "C++", "int main() {}", contest, nil)
+	if err != nil {
+		t.Fatalf("RunCodeTestCasesWithStats() error = %v", err)
+	}
+
+	if sandbox.runs != len(inputs) {
+		t.Errorf("sandbox ran %d times, want once per test case (%d)", sandbox.runs, len(inputs))
+	}
+	if len(result.Results) != len(inputs) {
+		t.Fatalf("got %d results, want %d", len(result.Results), len(inputs))
+	}
+	for i, testCase := range result.Results {
+		if testCase.Verdict != want[i] {
+			t.Errorf("test case %q: verdict = %s, want %s", inputs[i], testCase.Verdict, want[i])
+		}
+	}
+	if result.PassedTestCases != 1 || result.PassedAll {
+		t.Errorf("passed %d (all: %v), want only the first test case", result.PassedTestCases, result.PassedAll)
+	}
+}
+
+func TestRunCodeTestCasesWithStatsCompilationError(t *testing.T) {
+	contest := &models.Contest{TestCases: []models.TestCase{
+		{ID: "public", Input: "1", Output: "1", Public: true},
+		{ID: "hidden", Input: "2", Output: "2"},
+	}}
+
+	sandbox := &fakeSandbox{compiles: false, run: runByInput}
+	result, err := RunCodeTestCasesWithStats(context.Background(), sandbox, "C++", "int main() {", contest, nil)
+	if err != nil {
+		t.Fatalf("RunCodeTestCasesWithStats() error = %v", err)
+	}
+
+	if sandbox.runs != 0 {
+		t.Errorf("sandbox ran %d times, want no runs after the compiler failed", sandbox.runs)
+	}
+	if result.Verdict != models.VerdictCompilationError {
+		t.Errorf("verdict = %s, want %s", result.Verdict, models.VerdictCompilationError)
+	}
+	if len(result.Results) != 1 || result.Results[0].Verdict != models.VerdictCompilationError {
+		t.Errorf("results = %+v, want the public test case marked as a compilation error", result.Results)
+	}
+}
+
+func TestRunCodeTestCasesWithStatsWaitsForSlots(t *testing.T) {
+	t.Setenv("JUDGE_WARM_CONTAINERS", "false")
+
+	// Waiting for a slot takes far longer than the time limit, which only starts once the program runs
+	contest := &models.Contest{TestCases: []models.TestCase{
+		{ID: "tc", Input: "1", Output: "1", TimeLimit: 20, Public: true},
+	}}
+	sandbox := &fakeSandbox{compiles: true, slotWait: 100 * time.Millisecond, run: runByInput}
+	result, err := RunCodeTestCasesWithStats(context.Background(), sandbox, "C++", "int main() {}", contest, nil)
+	if err != nil {
+		t.Fatalf("RunCodeTestCasesWithStats() error = %v", err)
+	}
+	if result.Verdict != models.VerdictAccepted {
+		t.Errorf("verdict = %s, want %s after waiting for a slot", result.Verdict, models.VerdictAccepted)
+	}
+}
+
+func TestRunCodeTestCasesWithStatsFailsWhenJobTimesOut(t *testing.T) {
+	t.Setenv("JUDGE_WARM_CONTAINERS", "false")
+
+	// The job runs out of time while the test cases wait for slots, which must not grade them
+	contest := &models.Contest{}
+	for i := 0; i < 8; i++ {
+		contest.TestCases = append(contest.TestCases, models.TestCase{ID: fmt.Sprintf("tc-%d", i), Input: "1", Output: "1", TimeLimit: 1000})
+	}
+	sandbox := &fakeSandbox{compiles: true, slotWait: 30 * time.Millisecond, run: runByInput}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err := RunCodeTestCasesWithStats(ctx, sandbox, "C++", "int main() {}", contest, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunCodeTestCasesWithStats() = %+v, %v, want %v", result, err, context.DeadlineExceeded)
+	}
+}
+
+func TestMaxJudgeDuration(t *testing.T) {
+	t.Setenv("JUDGE_TEST_PARALLELISM", "2")
+
+	contest := &models.Contest{TestCases: []models.TestCase{{TimeLimit: 1000}, {TimeLimit: 3000}, {TimeLimit: 2000}}}
+	// Compiling, then half of the 6s of the test cases plus the longest one
+	want := time.Duration(util.COMPILE_TIME_LIMIT+3000+3000) * time.Millisecond
+	if got := MaxJudgeDuration(contest, "C++"); got != want {
+		t.Errorf("MaxJudgeDuration() = %v, want %v", got, want)
+	}
+
+	// The custom checker is compiled once and runs after every test case
+	contest.Checker = models.CheckerCustom
+	want += time.Duration(util.COMPILE_TIME_LIMIT+3*util.CHECKER_TIME_LIMIT/2+util.CHECKER_TIME_LIMIT) * time.Millisecond
+	if got := MaxJudgeDuration(contest, "C++"); got != want {
+		t.Errorf("MaxJudgeDuration() with a custom checker = %v, want %v", got, want)
+	}
+}
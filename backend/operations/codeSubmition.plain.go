@@ -1,80 +1,27 @@
 package operations
 
 import (
+	"backend/config"
 	"backend/models"
-	"bytes"
+	"backend/util"
 	"context"
-	"errors"
-	"fmt"
+	"encoding/json"
 	"log"
 	"os/exec"
 	"strings"
-	"time"
-)
-
-// ExecutionResult contains the result of code execution
-type ExecutionResult struct {
-	Output   string
-	Duration time.Duration
-	MemUsage int64
-	Error    error
-	TimedOut bool
-}
-
-// executeCode runs a solution's code with the given input and resource constraints
-func executeCode(solution models.Solution, inputString string, codeFile string, timeLimit int, memoryLimit int) ExecutionResult {
-	cmdArgs := GetDockerCommand(solution.Language, codeFile, inputString, memoryLimit)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeLimit)*time.Millisecond)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "docker", cmdArgs...)
-	log.Printf("Running command: %v\n", cmd.Args)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	startTime := time.Now()
-	err := cmd.Run()
-	duration := time.Since(startTime)
-
-	result := ExecutionResult{
-		Duration: duration,
-		MemUsage: int64(memoryLimit), // Placeholder - would be better to get actual memory usage
-		TimedOut: false,
-	}
 
-	// Check for timeout error
-	if ctx.Err() == context.DeadlineExceeded {
-		result.Error = errors.New("execution timed out")
-		result.TimedOut = true
-		// Clean up container if needed
-		containerID := extractContainerID(cmd.Args)
-		if containerID != "" {
-			killContainer(containerID)
-		}
-		return result
-	}
-
-	if err != nil {
-		errorOutput := stderr.String()
-		if errorOutput == "" {
-			errorOutput = stdout.String()
-		}
-		result.Error = fmt.Errorf("execution error: %v\nOutput: %s", err, errorOutput)
-		return result
-	}
-
-	output := strings.TrimSpace(stdout.String())
-	// Handle language-specific output formatting
-	result.Output = formatOutputByLanguage(output, solution.Language)
-	return result
-}
+	"github.com/gofiber/fiber/v2"
+)
 
 // formatOutputByLanguage handles language-specific output formatting
 func formatOutputByLanguage(output string, language string) string {
 	output = strings.TrimSpace(output)
 
+	// Submissions may name the language in any case
+	if lang, ok := config.Languages.Get(language); ok {
+		language = lang.Name
+	}
+
 	switch language {
 	case "Python":
 		// Only trim if the output appears to be a Python string representation
@@ -83,7 +30,7 @@ func formatOutputByLanguage(output string, language string) string {
 			(strings.HasPrefix(output, "\"") && strings.HasSuffix(output, "\"")) {
 			return strings.Trim(output, "[]'\"")
 		}
-	case "JavaScript":
+	case "JavaScript", "TypeScript":
 		// Clean up any potential undefined/null outputs that Node might add
 		if output == "undefined" || output == "null" {
 			return ""
@@ -99,34 +46,37 @@ func formatOutputByLanguage(output string, language string) string {
 		// Remove any trailing "undefined" that Node.js might append
 		output = strings.TrimSuffix(output, "undefined")
 		return strings.TrimSpace(output)
-	}
-
-	return output
-}
-
-// extractContainerID extracts the container ID from Docker command arguments
-func extractContainerID(args []string) string {
-	for i, arg := range args {
-		if arg == "run" && i+1 < len(args) {
-			return args[i+1]
+	case "Go":
+		// A nil pointer or interface returned to the harness
+		if output == "<nil>" {
+			return ""
+		}
+	case "Rust":
+		// The unit value printed with {:?}
+		if output == "()" {
+			return ""
 		}
 	}
-	return ""
-}
 
-// killContainer forcefully stops a Docker container
-func killContainer(containerID string) {
-	killCmd := exec.Command("docker", "kill", containerID)
-	killCmd.Run() // Ignore errors, just try to clean up
+	return output
 }
 
 // RunCodeTestCases tests code against multiple test cases and returns results
-func RunCodeTestCases(language string, code string, testCases []models.TestCase, isAIEnabled bool) (int, []byte, int, bool, int, int, error) {
+func RunCodeTestCases(sandbox util.Sandbox, language string, code string, testCases []models.TestCase, isAIEnabled bool) (int, []byte, int, bool, int, int, error) {
 	// Use the new implementation with Docker client
-	statusCode, jsonResult, scorePercentage, passedAll, passedTestCases, totalTestCases, _, err :=
-		RunCodeTestCasesWithStats(language, code, testCases, isAIEnabled)
+	contest := &models.Contest{TestCases: testCases, EnableAICodeEntryIdentification: isAIEnabled}
+	runResult, err := RunCodeTestCasesWithStats(context.Background(), sandbox, language, code, contest, nil)
+	if err != nil {
+		return runResult.StatusCode, nil, 0, false, 0, 0, err
+	}
+
+	jsonResult, err := json.Marshal(runResult.Results)
+	if err != nil {
+		log.Printf("Error marshaling results to JSON: %v", err)
+		return fiber.StatusInternalServerError, nil, 0, false, 0, 0, err
+	}
 
-	return statusCode, jsonResult, scorePercentage, passedAll, passedTestCases, totalTestCases, err
+	return runResult.StatusCode, jsonResult, runResult.Score, runResult.PassedAll, runResult.PassedTestCases, runResult.TotalTestCases, nil
 }
 
 // applyDefaultIfInvalid returns a default value if the given value is invalid
@@ -1,121 +1,230 @@
 package operations
 
 import (
+	"backend/models"
 	"backend/util"
-	"bytes"
+	"context"
 	"fmt"
-	"math/rand"
-	"os/exec"
-	"regexp"
-	"strconv"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strings"
-
-	"github.com/gofiber/fiber/v2"
+	"time"
 )
 
-func RunRepoTestCases(repository string, testFile []byte, githubToken string) (int, []byte, int, bool, int, int, error) {
-	var tempDir string
-	tempDir, err := util.CloneRepository(repository, githubToken)
+// RepoRunResult is the outcome of running the test file of a contest against a repository submission
+type RepoRunResult struct {
+	Output          []byte
+	Results         []models.TestCaseResult // One for every test of the test file
+	Score           int
+	PassedAll       bool
+	PassedTestCases int
+	TotalTestCases  int
+	Stats           []*util.StatsResult // One for every phase that ran
+}
+
+// RunRepoTestCases clones the repository and runs the test file against it with the test framework in the sandbox.
+// The returned error is only set if the tests could not be run at all, e.g. when cloning fails or ctx is done.
+func RunRepoTestCases(ctx context.Context, sandbox util.Sandbox, repository string, testFramework models.TestFramework, testFile []byte, githubToken string) (*RepoRunResult, error) {
+	cloneCtx, cancel := context.WithTimeout(ctx, util.REPO_CLONE_TIME_LIMIT*time.Millisecond)
+	tempDir, err := util.CloneRepository(cloneCtx, repository, githubToken)
+	cancel()
 	if err != nil {
-		return 0, nil, 0, false, 0, 0, err
+		return nil, err
 	}
 	defer util.CleanupTempDir(tempDir)
 
-	output, successCount, failCount, err := runTestScript(testFile, tempDir)
-	totalTestCases := successCount + failCount
+	output, results, stats, err := runTestScript(ctx, sandbox, testFramework, testFile, tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	successCount := 0
+	for _, result := range results {
+		if result.Passed {
+			successCount++
+		}
+	}
+	totalTestCases := len(results)
 	var passedPercentage float64
-	if totalTestCases == 0 {
-		passedPercentage = 0
-	} else {
+	if totalTestCases > 0 {
 		passedPercentage = float64(successCount) / float64(totalTestCases) * 100
-		if passedPercentage < 0 {
-			passedPercentage = 0
-		}
 	}
-	passedAll := successCount == totalTestCases && failCount == 0 && totalTestCases != 0
+	passedAll := successCount == totalTestCases && totalTestCases != 0
 	fmt.Printf("Success count: %d\n", successCount)
-	fmt.Printf("Fail count: %d\n", failCount)
 	fmt.Printf("Total test cases: %d\n", totalTestCases)
 	fmt.Printf("Passed percentage: %f\n", passedPercentage)
 
+	return &RepoRunResult{
+		Output:          []byte(output),
+		Results:         results,
+		Score:           int(passedPercentage),
+		PassedAll:       passedAll,
+		PassedTestCases: successCount,
+		TotalTestCases:  totalTestCases,
+		Stats:           stats,
+	}, nil
+}
+
+// runTestScript runs the setup and test phases of the framework in the sandbox, one after the other, and reads the
+// results of the tests from the report of the test runner. A phase that fails, times out or runs out of memory ends up
+// in the output; only a phase the sandbox couldn't run at all is an error.
+func runTestScript(ctx context.Context, sandbox util.Sandbox, testFramework models.TestFramework, testFile []byte, tempDir string) (string, []models.TestCaseResult, []*util.StatsResult, error) {
+	framework, image, err := getRepoFramework(testFramework)
 	if err != nil {
-		if !strings.Contains(err.Error(), "exit status 1") {
-			return fiber.StatusInternalServerError, nil, 0, false, 0, 0, err
-		}
+		return "", nil, nil, err
 	}
 
-	return fiber.StatusOK, []byte(output), int(passedPercentage), passedAll, successCount, totalTestCases, nil
-}
+	testRun, err := framework.Setup(tempDir, testFile, func(name string) string {
+		return sandbox.WorkspacePath(tempDir, name)
+	})
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to add test file: %w", err)
+	}
+	// The sandbox runs the commands as an unprivileged user, which has to be able to install the dependencies here
+	if err := makeWritable(tempDir); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to prepare repository: %w", err)
+	}
 
-func runTestScript(testFile []byte, tempDir string) (string, int, int, error) {
-	// Get the Docker commands for setup and testing
-	testFileName := "contestifyJestTest" + strconv.Itoa(rand.Intn(1000000)) + ".test.js"
-	AddTestFileToDir(tempDir, testFileName, testFile)
-	commands := GetDockerRepoCommand("JavaScript", tempDir, testFileName)
-	var finalOutput bytes.Buffer
-	var err error
+	// Whatever the repository ships where the dependencies go is removed, so that it can't stand in for them
+	if framework.Cache != nil {
+		if err := os.RemoveAll(filepath.Join(tempDir, filepath.FromSlash(framework.Cache.Dir))); err != nil {
+			return "", nil, nil, fmt.Errorf("failed to prepare repository: %w", err)
+		}
+	}
 
-	for _, cmdArgs := range commands {
-		// Execute each Docker command in sequence
-		cmd := exec.Command("docker", cmdArgs...)
-		fmt.Println("Running command: ", cmd.Args)
+	// Cached dependencies are mounted read-only instead of running the setup phases, which needs no network. A missing
+	// entry is built first, so that a warm cache behaves like a cold one. If that fails the setup phases install the
+	// dependencies into the repository as without a cache.
+	var mounts []util.CommandMount
+	var stats []*util.StatsResult
+	cache := util.GetDependencyCache()
+	if cacheKey, cacheable := dependencyCacheKey(tempDir, testFramework, framework.Cache); cacheable && cache != nil {
+		entry, release, ok := cache.Acquire(cacheKey)
+		if !ok {
+			buildStats, err := buildCachedDependencies(ctx, sandbox, image, cache, cacheKey, framework.Cache, tempDir)
+			if buildStats != nil {
+				stats = append(stats, buildStats)
+			}
+			if err != nil {
+				fmt.Printf("Failed to cache dependencies: %v\n", err)
+			} else {
+				entry, release, ok = cache.Acquire(cacheKey)
+			}
+		}
+		if ok {
+			defer release()
+			fmt.Println("Using cached dependencies: ", cacheKey)
+			mounts = []util.CommandMount{{Source: filepath.Join(entry, filepath.Base(framework.Cache.Dir)), Target: framework.Cache.Dir}}
+		}
+	}
 
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		cmd.Stderr = &out
+	var finalOutput strings.Builder
+	for _, phase := range testRun.Phases {
+		if phase.Setup && mounts != nil {
+			continue
+		}
+		fmt.Println("Running phase: ", phase.Name)
+		out, phaseStats, runErr := sandbox.RunCommand(ctx, util.CommandRun{
+			Image:         image,
+			WorkDir:       tempDir,
+			Command:       phase.Command,
+			Policy:        util.REPO_SANDBOX_POLICY,
+			TimeoutMs:     phase.TimeoutMs,
+			MemoryLimitMB: util.REPO_MEMORY_LIMIT,
+			Network:       phase.Network,
+			Mounts:        mounts,
+		})
+		if ctx.Err() != nil {
+			return "", nil, stats, ctx.Err()
+		}
+		if phaseStats == nil && runErr != nil {
+			return "", nil, stats, fmt.Errorf("failed to run %s: %w", phase.Name, runErr)
+		}
+		stats = append(stats, phaseStats)
 
-		err = cmd.Run()
-		output := out.String()
-		fmt.Println("Output: ", output)
-		finalOutput.WriteString(output) // Append each command's output to final output
+		finalOutput.WriteString(out.Stdout)
+		finalOutput.WriteString(out.Stderr)
+		if runErr == nil {
+			continue
+		}
 
-		if err != nil {
-			// Log the error but continue with the next command
-			fmt.Printf("Error running command: %v\n", err)
+		// A failing test makes the test phase fail too, its results are still in the report
+		fmt.Printf("Error running %s: %v\n", phase.Name, runErr)
+		fmt.Fprintf(&finalOutput, "\n%s failed: %v\n", phase.Name, runErr)
+		if phase.Setup {
+			break
 		}
 	}
 
-	// Parse the final output for test results
-	output := finalOutput.String()
-	successCount, failCount := parseTestResults(output)
-	fmt.Printf("Parsed test results - Success: %d, Fail: %d\n", successCount, failCount)
-
-	// Return results even if there was an error, to get success/fail counts
-	return output, successCount, failCount, err
+	// Without a report nothing passed, e.g. when the dependencies could not be installed or the tests timed out
+	results, err := framework.Parse(filepath.Join(tempDir, filepath.FromSlash(testRun.Report)))
+	if err != nil {
+		fmt.Printf("No test results: %v\n", err)
+		fmt.Fprintf(&finalOutput, "\nNo test results: %v\n", err)
+		results = []models.TestCaseResult{}
+	}
+	return finalOutput.String(), results, stats, nil
 }
 
-// Helper function to parse Jest output for test results
-func parseTestResults(output string) (int, int) {
-	var successCount, failCount int
-
-	// Match test summary line that shows passed and total tests
-	summaryRegex := regexp.MustCompile(`Tests:\s+(?:(\d+)\s+failed,\s+)?(\d+)\s+passed(?:,\s+(\d+)\s+total)?`)
-
-	matches := summaryRegex.FindStringSubmatch(output)
-	if matches != nil {
-		fmt.Printf("Found test results matches: %v\n", matches)
+// buildCachedDependencies installs the dependencies of the repository at repoDir into a new entry of the cache. They
+// are installed in a directory holding nothing but the lockfiles, without running code of the packages, so that neither
+// the repository nor its dependencies can change what later submissions get from the cache.
+func buildCachedDependencies(ctx context.Context, sandbox util.Sandbox, image string, cache *util.DependencyCache, key string, dependencies *repoDependencies, repoDir string) (*util.StatsResult, error) {
+	buildDir, err := util.CreateTempDir()
+	if err != nil {
+		return nil, err
+	}
+	defer util.CleanupTempDir(buildDir)
 
-		// Parse failed tests if present
-		if matches[1] != "" {
-			failCount, _ = strconv.Atoi(matches[1])
+	for _, name := range dependencies.Lockfiles {
+		content, err := os.ReadFile(filepath.Join(repoDir, name))
+		if err != nil {
+			continue // Only the first lockfile is required, see dependencyCacheKey
 		}
-
-		// Parse passed tests
-		if matches[2] != "" {
-			successCount, _ = strconv.Atoi(matches[2])
+		if err := writeRepoFile(buildDir, name, content); err != nil {
+			return nil, err
 		}
+	}
+	if err := makeWritable(buildDir); err != nil {
+		return nil, err
+	}
 
-		// Verify against total if present
-		if matches[3] != "" {
-			total, _ := strconv.Atoi(matches[3])
-			if total != successCount+failCount {
-				fmt.Printf("Warning: Total tests (%d) doesn't match sum of passed (%d) and failed (%d)\n",
-					total, successCount, failCount)
-			}
-		}
-	} else {
-		fmt.Printf("No test results found in output: %s\n", output)
+	workspace := func(name string) string {
+		return sandbox.WorkspacePath(buildDir, name)
 	}
+	out, stats, err := sandbox.RunCommand(ctx, util.CommandRun{
+		Image:         image,
+		WorkDir:       buildDir,
+		Command:       dependencies.Install(workspace),
+		Policy:        util.REPO_SANDBOX_POLICY,
+		TimeoutMs:     util.REPO_SETUP_TIME_LIMIT,
+		MemoryLimitMB: util.REPO_MEMORY_LIMIT,
+		Network:       true,
+	})
+	if err != nil {
+		return stats, fmt.Errorf("installing the dependencies failed: %w\n%s", err, out.Stderr)
+	}
+	return stats, cache.Store(key, filepath.Join(buildDir, filepath.FromSlash(dependencies.Dir)))
+}
 
-	return successCount, failCount
+// makeWritable lets every user write to the files and directories under dir
+func makeWritable(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		mode := info.Mode().Perm() | 0666
+		if entry.IsDir() {
+			mode |= 0111
+		}
+		return os.Chmod(path, mode)
+	})
 }
@@ -0,0 +1,135 @@
+package operations
+
+import (
+	"backend/models"
+	"backend/util"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// repoSandbox runs the commands of repository submissions with runCommand instead of a sandbox
+type repoSandbox struct {
+	fakeSandbox
+	runCommand func(run util.CommandRun) (util.ContainerOutput, *util.StatsResult, error)
+}
+
+func (s *repoSandbox) RunCommand(ctx context.Context, run util.CommandRun) (util.ContainerOutput, *util.StatsResult, error) {
+	return s.runCommand(run)
+}
+
+// writeJestRepository writes a repository with a package-lock.json and whatever else files holds
+func writeJestRepository(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files["package.json"] = `{"name": "shop", "devDependencies": {"jest": "^29.7.0"}}`
+	files["package-lock.json"] = `{"name": "shop", "lockfileVersion": 3, "packages": {"": {"name": "shop"}, "node_modules/jest": {"version": "29.7.0"}}}`
+	for name, content := range files {
+		if err := writeRepoFile(dir, name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunTestScriptBuildsCachedDependenciesFromLockfiles(t *testing.T) {
+	t.Setenv("JUDGE_DEPENDENCY_CACHE_DIR", t.TempDir())
+	t.Setenv("JUDGE_DEPENDENCY_CACHE_MB", "16")
+	if util.GetDependencyCache() == nil {
+		t.Skip("the dependency cache was opened before with other settings")
+	}
+
+	var installs int
+	var phases []string
+	sandbox := &repoSandbox{}
+	sandbox.runCommand = func(run util.CommandRun) (util.ContainerOutput, *util.StatsResult, error) {
+		stats := &util.StatsResult{}
+		switch {
+		case slices.Contains(run.Command, "--ignore-scripts"):
+			installs++
+			entries, _ := os.ReadDir(run.WorkDir)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if !slices.Equal(names, []string{"package-lock.json", "package.json"}) {
+				t.Errorf("dependencies were installed next to %v, want only the lockfiles", names)
+			}
+			return util.ContainerOutput{}, stats, writeRepoFile(run.WorkDir, "node_modules/jest/index.js", []byte("clean"))
+		case run.Command[0] == "npx":
+			phases = append(phases, "jest")
+			if len(run.Mounts) != 1 || run.Mounts[0].Target != "node_modules" {
+				t.Fatalf("mounts = %+v, want the cached node_modules", run.Mounts)
+			}
+			if content, _ := os.ReadFile(filepath.Join(run.Mounts[0].Source, "jest", "index.js")); string(content) != "clean" {
+				t.Errorf("cached jest is %q, want the one installed from the lockfile", content)
+			}
+			if _, err := os.Stat(filepath.Join(run.WorkDir, "node_modules")); !os.IsNotExist(err) {
+				t.Errorf("the node_modules of the repository were kept: %v", err)
+			}
+			report := strings.TrimPrefix(run.Command[len(run.Command)-1], "--outputFile=")
+			return util.ContainerOutput{}, stats, writeRepoFile(run.WorkDir, report, []byte(`{"testResults": []}`))
+		default:
+			phases = append(phases, run.Command[0])
+			return util.ContainerOutput{}, stats, nil
+		}
+	}
+
+	// Repositories that ship tampered dependencies must neither use them nor get them into the cache
+	for _, files := range []map[string]string{
+		{"node_modules/jest/index.js": "tampered"},
+		{},
+		{"node_modules/jest/index.js": "tampered", ".npmrc": "ignore-scripts=false"},
+	} {
+		dir := writeJestRepository(t, files)
+		if _, _, _, err := runTestScript(context.Background(), sandbox, models.TestFrameworkJest, []byte("test('x', () => {})"), dir); err != nil {
+			t.Fatalf("runTestScript() error = %v", err)
+		}
+	}
+
+	if installs != 1 {
+		t.Errorf("dependencies were installed %d times, want once for all repositories with the same lockfiles", installs)
+	}
+	if !slices.Equal(phases, []string{"jest", "jest", "jest"}) {
+		t.Errorf("phases = %v, want only the tests with cached dependencies", phases)
+	}
+}
+
+func TestDependencyCacheKeySkipsInstallScripts(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		cacheable bool
+	}{
+		{"no scripts", map[string]string{}, true},
+		{"postinstall of the repository", map[string]string{"package.json": `{"scripts": {"postinstall": "node setup.js"}}`}, false},
+		{"prepare of the repository", map[string]string{"package.json": `{"scripts": {"prepare": "husky install", "test": "jest"}}`}, false},
+		{"dependency with an install script", map[string]string{"package-lock.json": `{"lockfileVersion": 3, "packages": {"node_modules/esbuild": {"hasInstallScript": true}}}`}, false},
+		{"native addon", map[string]string{"binding.gyp": "{}"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{
+				"package.json":      `{"scripts": {"test": "jest"}}`,
+				"package-lock.json": `{"lockfileVersion": 3, "packages": {"node_modules/jest": {"version": "29.7.0"}}}`,
+			}
+			for name, content := range tt.files {
+				files[name] = content
+			}
+			for name, content := range files {
+				if err := writeRepoFile(dir, name, []byte(content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, ok := dependencyCacheKey(dir, models.TestFrameworkJest, npmDependencies); ok != tt.cacheable {
+				t.Errorf("dependencyCacheKey() ok = %v, want %v", ok, tt.cacheable)
+			}
+		})
+	}
+}
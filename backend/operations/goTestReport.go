@@ -0,0 +1,104 @@
+package operations
+
+import (
+	"backend/models"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// goTestEvent is a line of the output of `go test -json`
+type goTestEvent struct {
+	Action  string  `json:"Action"`
+	Package string  `json:"Package"`
+	Test    string  `json:"Test"`
+	Elapsed float64 `json:"Elapsed"` // In seconds
+	Output  string  `json:"Output"`
+}
+
+// goTestOutcome collects the events of a top-level test and its subtests
+type goTestOutcome struct {
+	action  string
+	elapsed float64
+	output  strings.Builder
+}
+
+// readGoTestReport turns the output of `go test -json` into one result per top-level test, subtests are part of
+// their parent. A test that never finished, e.g. because another one panicked, failed. A package that failed without
+// running any test, e.g. because it doesn't build, becomes a single failed result named after the package.
+func readGoTestReport(reportPath string) ([]models.TestCaseResult, error) {
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read go test report: %w", err)
+	}
+
+	var order []string
+	outcomes := map[string]*goTestOutcome{}
+	packageFailed := false
+	var packageName string
+	var packageOutput strings.Builder
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event goTestEvent
+		// Build errors are printed as plain text before the events
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			packageOutput.WriteString(scanner.Text() + "\n")
+			continue
+		}
+
+		if event.Test == "" {
+			packageName = event.Package
+			packageOutput.WriteString(event.Output)
+			if event.Action == "fail" {
+				packageFailed = true
+			}
+			continue
+		}
+
+		name, _, subtest := strings.Cut(event.Test, "/")
+		outcome, ok := outcomes[name]
+		if !ok {
+			outcome = &goTestOutcome{}
+			outcomes[name] = outcome
+			order = append(order, name)
+		}
+		switch event.Action {
+		case "output":
+			if !strings.HasPrefix(strings.TrimSpace(event.Output), "=== ") {
+				outcome.output.WriteString(event.Output)
+			}
+		case "pass", "fail", "skip":
+			if !subtest {
+				outcome.action = event.Action
+				outcome.elapsed = event.Elapsed
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid go test report: %w", err)
+	}
+
+	results := []models.TestCaseResult{}
+	for _, name := range order {
+		outcome := outcomes[name]
+		if outcome.action == "skip" {
+			continue
+		}
+		passed := outcome.action == "pass"
+		message := ""
+		if !passed {
+			message = outcome.output.String()
+		}
+		results = append(results, specResult(name, passed, int(outcome.elapsed*1000), message))
+	}
+
+	if len(results) == 0 && packageFailed {
+		results = append(results, specResult(packageName, false, 0, packageOutput.String()))
+	}
+	return results, nil
+}
@@ -0,0 +1,38 @@
+package operations
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadGoTestReport(t *testing.T) {
+	tests := []struct {
+		report string
+		want   []wantSpec
+	}{
+		{
+			// Subtests are part of their parent, skipped tests are left out
+			report: "gotest.json",
+			want: []wantSpec{
+				{name: "TestAdd", passed: true},
+				{name: "TestSub", passed: false, message: "Sub(5, 3) = 8, want 2 — résultat faux"},
+			},
+		},
+		{
+			report: "gotest_build_failed.json",
+			want: []wantSpec{
+				{name: "calc", passed: false, message: `cannot use "x" (untyped string constant) as int value`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.report, func(t *testing.T) {
+			results, err := readGoTestReport(filepath.Join("testdata", tt.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSpecs(t, results, tt.want)
+		})
+	}
+}
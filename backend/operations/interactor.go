@@ -0,0 +1,80 @@
+package operations
+
+import (
+	"backend/models"
+	"backend/util"
+	"context"
+	"fmt"
+	"log"
+)
+
+// interactor talks to the solution of an interactive problem: what the solution prints is the stdin of the
+// interactor and the other way round. Like testlib interactors it is called as `interactor <input> <output> <answer>`,
+// with the test input and the expected output as files. Its exit code decides whether the solution is accepted.
+type interactor struct {
+	*judgeProgram
+}
+
+func newInteractor(ctx context.Context, sandbox util.Sandbox, contest *models.Contest) (*interactor, error) {
+	if contest.InteractorSource == nil || len(*contest.InteractorSource) == 0 {
+		return nil, fmt.Errorf("contest is interactive but no interactor was uploaded")
+	}
+
+	program, err := prepareJudgeProgram(ctx, sandbox, "interactor", contest.InteractorLanguage, string(*contest.InteractorSource))
+	if err != nil {
+		return nil, err
+	}
+	return &interactor{program}, nil
+}
+
+// Run executes the compiled solution against the interactor for a single test case. Both run under the limits of
+// the test case. A solution that fails on its own (TLE, MLE, RE, ...) is reported through the execution result.
+func (i *interactor) Run(ctx context.Context, idx int, solution models.Solution, workDir string, sourceFile string, input string, expected string, timeLimit int, memoryLimit int) (util.ExecutionResult, bool, error) {
+	solutionImage, err := getDockerImageForLanguage(solution.Language)
+	if err != nil {
+		return util.ExecutionResult{Error: err}, false, fmt.Errorf("unsupported language: %w", err)
+	}
+	interactorImage, err := getDockerImageForLanguage(i.solution.Language)
+	if err != nil {
+		return util.ExecutionResult{Error: err}, false, err
+	}
+
+	files, cleanup, err := i.writeTestFiles(idx, []string{"in", "ans"}, []string{input, expected})
+	if err != nil {
+		return util.ExecutionResult{Error: err}, false, err
+	}
+	defer cleanup()
+
+	solutionRun, interactorRun, err := i.sandbox.RunInteractive(ctx,
+		util.ContainerRun{
+			Image:         solutionImage,
+			WorkDir:       workDir,
+			SourceFile:    sourceFile,
+			TimeoutMs:     timeLimit,
+			MemoryLimitMB: memoryLimit,
+		},
+		util.ContainerRun{
+			Image:         interactorImage,
+			WorkDir:       i.workDir,
+			SourceFile:    i.sourceFile,
+			TimeoutMs:     timeLimit,
+			MemoryLimitMB: memoryLimit,
+			Args:          []string{files[0], "/dev/null", files[1]},
+		})
+	if err != nil {
+		return util.ExecutionResult{Error: err}, false, fmt.Errorf("failed to run interactor: %w", err)
+	}
+
+	execResult := newExecutionResult(solution, solutionRun, timeLimit, memoryLimit)
+
+	accepted, err := acceptedByExitCode("interactor", interactorRun)
+	if err != nil {
+		// An interactor usually fails or times out because the solution stopped talking to it, then the solution's verdict stands
+		if execResult.Error != nil || execResult.TimedOut {
+			log.Printf("Interactor failed after the solution did on test case #%d: %v", idx+1, err)
+			return execResult, false, nil
+		}
+		return execResult, false, err
+	}
+	return execResult, accepted, nil
+}
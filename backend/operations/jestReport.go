@@ -0,0 +1,66 @@
+package operations
+
+import (
+	"backend/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// jestReport is the part of the report of `jest --json` that is stored with a submission
+type jestReport struct {
+	TestResults []struct {
+		Name             string `json:"name"` // Path of the test file inside the sandbox
+		Status           string `json:"status"`
+		Message          string `json:"message"`
+		AssertionResults []struct {
+			FullName        string   `json:"fullName"`
+			Status          string   `json:"status"`
+			Duration        *float64 `json:"duration"` // In milliseconds, null for specs that didn't run
+			FailureMessages []string `json:"failureMessages"`
+		} `json:"assertionResults"`
+	} `json:"testResults"`
+}
+
+// ansiEscapePattern matches the color codes Jest adds to failure messages
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// readJestReport turns the report written by `jest --json --outputFile` into one result per spec.
+// Skipped and todo specs are left out. A test file that fails before its specs run, e.g. with a syntax error,
+// becomes a single failed result named after the file.
+func readJestReport(reportPath string) ([]models.TestCaseResult, error) {
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Jest report: %w", err)
+	}
+	var report jestReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid Jest report: %w", err)
+	}
+
+	results := []models.TestCaseResult{}
+	for _, file := range report.TestResults {
+		if len(file.AssertionResults) == 0 {
+			if file.Status == "failed" {
+				results = append(results, specResult(path.Base(file.Name), false, 0, file.Message))
+			}
+			continue
+		}
+
+		for _, spec := range file.AssertionResults {
+			if spec.Status != "passed" && spec.Status != "failed" {
+				continue
+			}
+			duration := 0
+			if spec.Duration != nil {
+				duration = int(*spec.Duration)
+			}
+			message := strings.Join(spec.FailureMessages, "\n")
+			results = append(results, specResult(spec.FullName, spec.Status == "passed", duration, message))
+		}
+	}
+	return results, nil
+}
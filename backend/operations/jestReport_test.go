@@ -0,0 +1,25 @@
+package operations
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadJestReport(t *testing.T) {
+	results, err := readJestReport(filepath.Join("testdata", "jest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSpecs(t, results, []wantSpec{
+		{name: "cart adds an item", passed: true, timeMs: 3},
+		{name: "cart formats the total", passed: false, timeMs: 5, message: `Expected: "12,50 €"`},
+		{name: "contest.other.test.js", passed: false, message: "Cannot find module './checkout'"},
+	})
+
+	if _, err := readJestReport(filepath.Join("testdata", "missing.json")); err == nil {
+		t.Error("readJestReport() of a missing report = nil error")
+	}
+	if _, err := readJestReport(filepath.Join("testdata", "junit_pytest.xml")); err == nil {
+		t.Error("readJestReport() of a JUnit report = nil error")
+	}
+}
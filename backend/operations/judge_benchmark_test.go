@@ -0,0 +1,78 @@
+package operations
+
+import (
+	"backend/config"
+	"backend/models"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// benchmarkSolutions echo their input, so that every test case is accepted
+var benchmarkSolutions = map[string]string{
+	"Python":     "import sys\n\ndef main():\n    return sys.stdin.read().strip()\n",
+	"JavaScript": "function main(input) {\n    return input;\n}\n",
+	"C++":        "#include <iostream>\n#include <string>\nint main() {\n    std::string line;\n    std::getline(std::cin, line);\n    std::cout << line;\n}\n",
+	"Java":       "import java.util.Scanner;\npublic class Solution {\n    public static void main(String[] args) {\n        System.out.print(new Scanner(System.in).nextLine());\n    }\n}\n",
+}
+
+// BenchmarkJudge measures judging throughput with a container per test case (cold) and with one warm container per
+// submission (warm). It needs the same sandbox as the server, Docker unless JUDGE_SANDBOX=local, but no database:
+//
+//	go test ./operations -run '^$' -bench Judge -benchtime 3x
+//
+// JUDGE_BENCH_LANGUAGE picks the language of the solution, Python by default. The local sandbox has no sessions,
+// so both modes start a process per test case there.
+func BenchmarkJudge(b *testing.B) {
+	language := os.Getenv("JUDGE_BENCH_LANGUAGE")
+	if language == "" {
+		language = "Python"
+	}
+	code, ok := benchmarkSolutions[language]
+	if !ok {
+		b.Fatalf("no benchmark solution for %s", language)
+	}
+
+	sandbox, err := NewSandbox()
+	if err != nil {
+		b.Skipf("no sandbox: %v", err)
+	}
+	lang, _ := config.Languages.Get(language)
+	if err := sandbox.Prepare(context.Background(), lang.Image, lang.FileName); err != nil {
+		b.Skipf("sandbox can't run %s: %v", language, err)
+	}
+
+	const tests = 20
+	contest := &models.Contest{}
+	for i := 0; i < tests; i++ {
+		contest.TestCases = append(contest.TestCases, models.TestCase{
+			Input:       strconv.Itoa(i),
+			Output:      strconv.Itoa(i),
+			TimeLimit:   2000,
+			MemoryLimit: 256,
+		})
+	}
+
+	for _, warm := range []bool{false, true} {
+		mode := "cold"
+		if warm {
+			mode = "warm"
+		}
+		b.Run(fmt.Sprintf("%s/%s", language, mode), func(b *testing.B) {
+			b.Setenv("JUDGE_WARM_CONTAINERS", strconv.FormatBool(warm))
+
+			for i := 0; i < b.N; i++ {
+				result, err := RunCodeTestCasesWithStats(context.Background(), sandbox, language, code, contest, nil)
+				if err != nil {
+					b.Fatalf("judging failed: %v", err)
+				}
+				if !result.PassedAll {
+					b.Fatalf("expected every test case to pass, got %s", result.Verdict)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Milliseconds())/float64(b.N*tests), "ms/testcase")
+		})
+	}
+}
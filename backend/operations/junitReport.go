@@ -0,0 +1,78 @@
+package operations
+
+import (
+	"backend/models"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// junitSuite is a <testsuites> or <testsuite> element of a JUnit XML report. pytest nests suites in a <testsuites>
+// root, Maven Surefire and Gradle write one <testsuite> per test class.
+type junitSuite struct {
+	Suites    []junitSuite    `xml:"testsuite"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"` // In seconds
+	Failure   *junitFailure `xml:"failure"`
+	Error     *junitFailure `xml:"error"`
+	Skipped   *struct{}     `xml:"skipped"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// readJUnitReport turns a JUnit XML report into one result per test case, named "class.test".
+// Skipped test cases are left out, errors count as failures.
+func readJUnitReport(reportPath string) ([]models.TestCaseResult, error) {
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JUnit report: %w", err)
+	}
+	var root junitSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid JUnit report: %w", err)
+	}
+
+	results := []models.TestCaseResult{}
+	var collect func(suite junitSuite)
+	collect = func(suite junitSuite) {
+		for _, testCase := range suite.TestCases {
+			if testCase.Skipped != nil {
+				continue
+			}
+			name := testCase.Name
+			if testCase.ClassName != "" {
+				name = testCase.ClassName + "." + testCase.Name
+			}
+			seconds, _ := strconv.ParseFloat(testCase.Time, 64)
+
+			failure := testCase.Failure
+			if failure == nil {
+				failure = testCase.Error
+			}
+			message := ""
+			if failure != nil {
+				// The text is usually the stack trace, which starts with the message
+				message = strings.TrimSpace(failure.Text)
+				if message == "" {
+					message = failure.Message
+				}
+			}
+			results = append(results, specResult(name, failure == nil, int(seconds*1000), message))
+		}
+		for _, child := range suite.Suites {
+			collect(child)
+		}
+	}
+	collect(root)
+	return results, nil
+}
@@ -0,0 +1,43 @@
+package operations
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReadJUnitReport(t *testing.T) {
+	tests := []struct {
+		report string
+		want   []wantSpec
+	}{
+		{
+			report: "junit_pytest.xml",
+			want: []wantSpec{
+				{name: "test_contest.test_add", passed: true, timeMs: 1},
+				{name: "test_contest.test_greet", passed: false, timeMs: 2, message: "AssertionError: assert 'Hello, Zoë' == 'Hallo, Zoë'"},
+				{name: "test_contest.test_db", passed: false, timeMs: 3, message: "fixture 'db' not found"},
+			},
+		},
+		{
+			report: "junit_surefire.xml",
+			want: []wantSpec{
+				{name: "com.example.CalculatorTest.adds", passed: true, timeMs: 4},
+				{name: "com.example.CalculatorTest.divides", passed: false, timeMs: 1250, message: "CalculatorTest.java:17"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.report, func(t *testing.T) {
+			results, err := readJUnitReport(filepath.Join("testdata", tt.report))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSpecs(t, results, tt.want)
+		})
+	}
+
+	if _, err := readJUnitReport(filepath.Join("testdata", "jest.json")); err == nil {
+		t.Error("readJUnitReport() of a Jest report = nil error")
+	}
+}
@@ -0,0 +1,56 @@
+package operations
+
+import (
+	"backend/config"
+	"backend/models"
+	"backend/util"
+	"math"
+	"strings"
+)
+
+// languageLimits are the adjustments of a contest for the language of a submission, applied to every test case
+type languageLimits struct {
+	timeMultiplier float64
+	extraMemoryMB  int
+	compilerFlags  []string // The flags the submission is compiled with, including the defaults of the language
+}
+
+// resolveLanguageLimits combines the defaults of the language with the settings of the contest for it
+func resolveLanguageLimits(contest *models.Contest, language string) languageLimits {
+	limits := languageLimits{timeMultiplier: 1}
+
+	lang, ok := config.Languages.Get(language)
+	if !ok {
+		return limits
+	}
+	limits.timeMultiplier = lang.TimeMultiplier
+	limits.extraMemoryMB = lang.ExtraMemoryMB
+
+	setting, _ := contest.LanguageSettings.For(language)
+	if setting.TimeMultiplier > 0 {
+		limits.timeMultiplier = setting.TimeMultiplier
+	}
+	if setting.ExtraMemoryMB != nil {
+		limits.extraMemoryMB = *setting.ExtraMemoryMB
+	}
+	// Settings are validated when the contest is saved, the registry may have changed since
+	if err := lang.CheckCompilerFlags(setting.CompilerFlags); err == nil {
+		limits.compilerFlags = lang.CompilerFlags(setting.CompilerFlags)
+	} else {
+		limits.compilerFlags = lang.CompilerFlags(nil)
+	}
+	return limits
+}
+
+// apply returns the time and memory limits of a test case for the language, the time limit at most MAX_SCALED_TIME_LIMIT
+func (l languageLimits) apply(timeLimit int, memoryLimit int) (int, int) {
+	scaled := min(math.Ceil(float64(timeLimit)*l.timeMultiplier), util.MAX_SCALED_TIME_LIMIT)
+	return int(scaled), memoryLimit + l.extraMemoryMB
+}
+
+// record stores the adjustments on the result of a test case
+func (l languageLimits) record(result *models.TestCaseResult) {
+	result.TimeMultiplier = l.timeMultiplier
+	result.ExtraMemoryMB = l.extraMemoryMB
+	result.CompilerFlags = strings.Join(l.compilerFlags, " ")
+}
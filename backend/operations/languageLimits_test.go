@@ -0,0 +1,28 @@
+package operations
+
+import (
+	"backend/util"
+	"testing"
+)
+
+func TestLanguageLimitsApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     languageLimits
+		timeLimit  int
+		wantTime   int
+		wantMemory int
+	}{
+		{"unchanged", languageLimits{timeMultiplier: 1}, 2000, 2000, 128},
+		{"rounded up", languageLimits{timeMultiplier: 1.5, extraMemoryMB: 64}, 1001, 1502, 192},
+		{"capped", languageLimits{timeMultiplier: util.MAX_TIME_MULTIPLIER}, util.MAX_TIME_LIMIT, util.MAX_SCALED_TIME_LIMIT, 128},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotTime, gotMemory := tt.limits.apply(tt.timeLimit, 128)
+			if gotTime != tt.wantTime || gotMemory != tt.wantMemory {
+				t.Errorf("apply(%d, 128) = %d, %d, want %d, %d", tt.timeLimit, gotTime, gotMemory, tt.wantTime, tt.wantMemory)
+			}
+		})
+	}
+}
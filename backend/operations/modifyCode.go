@@ -1,194 +1,75 @@
 package operations
 
 import (
+	"backend/config"
+	"backend/models"
+	"backend/util"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strings"
 )
 
-func modifyJSCode(code string, entryPoint string) string {
-	// The JavaScript code to inject
-	template := `
-%s
-
-// Function to handle input properly
-function parseInput(input) {
-    try {
-        // Try to parse as JSON if it looks like JSON
-        if ((input.startsWith('{') && input.endsWith('}')) || 
-            (input.startsWith('[') && input.endsWith(']'))) {
-            return JSON.parse(input);
-        }
-        
-        // Try to parse as number
-        const num = Number(input);
-        if (!isNaN(num)) {
-            return num;
-        }
-        
-        // Return as string if all else fails
-        return input;
-    } catch (e) {
-        // Return original input if parsing fails
-        return input;
-    }
+// GetFileExtensionAndModifiedCode returns the source file extension of the language and the code wrapped in the
+// language's harness. The extension is empty for languages missing from the registry.
+func GetFileExtensionAndModifiedCode(language string, code string, entryPoint string) (string, string) {
+	lang, ok := config.Languages.Get(language)
+	if !ok {
+		return "", code
+	}
+	return lang.Extension, lang.WrapCode(code, entryPoint)
 }
 
-// Main execution
-if (typeof %s === "function") {
-    const args = process.argv.slice(2).map(parseInput); // Get and parse command-line arguments
-    const result = %s(...args);
-    
-    // Handle the result properly
-    if (result !== undefined) {
-        // For objects, stringify with pretty printing
-        if (typeof result === 'object' && result !== null) {
-            console.log(JSON.stringify(result));
-        } else {
-            console.log(result);
-        }
-    }
-} else {
-    console.error("Function '%s' not found");
-    process.exit(1);
-}
-`
-	// Replace the placeholder with the original code
-	modifiedCode := fmt.Sprintf(template, code, entryPoint, entryPoint, entryPoint)
-	return modifiedCode
+// GetSignatureModifiedCode returns the source file extension of the language and the code wrapped in the harness
+// that calls the function of a function-signature problem
+func GetSignatureModifiedCode(language string, code string, signature *models.FunctionSignature) (string, string, error) {
+	lang, ok := config.Languages.Get(language)
+	if !ok {
+		return "", "", fmt.Errorf("unsupported language: %s", language)
+	}
+	wrapped, err := lang.WrapSignature(code, signature)
+	if err != nil {
+		return "", "", err
+	}
+	return lang.Extension, wrapped, nil
 }
 
-func modifyPythonCode(code string, entryPoint string) string {
-	// The Python code to inject
-	template := `
-import sys
-
-# Simple approach: if there are command line arguments, use them as input
-# Otherwise, keep the standard input behavior
-if len(sys.argv) > 1:
-    # Save the original input function
-    original_input = input
-    
-    # Create a list of inputs from command line arguments
-    cli_inputs = sys.argv[1:]
-    cli_input_index = 0
-    
-    # Define our custom input function
-    def custom_input(prompt=''):
-        global cli_input_index
-        global cli_inputs
-        
-        # Print the prompt to simulate the normal input behavior
-        if prompt:
-            print(prompt, end='')
-            
-        # If we have inputs from command line, use them
-        if cli_input_index < len(cli_inputs):
-            result = cli_inputs[cli_input_index]
-            cli_input_index += 1
-            # Don't echo the input - let the user code handle output
-            return result
-        
-        # Fall back to standard input if we run out of args
-        return original_input(prompt)
-    
-    # Replace the built-in input function
-    input = custom_input
-
-%s
-
-if __name__ == "__main__":
-    try:
-        # If we have a callable entry point function, call it
-        if '%s' in globals() and callable(globals()['%s']):
-            result = %s()
-            if result is not None:
-                print(result)
-    except Exception as e:
-        print(f"Error: {e}")
-`
-	// Replace the placeholder with the original code and entry point
-	modifiedCode := fmt.Sprintf(template, code, entryPoint, entryPoint, entryPoint)
-
-	return modifiedCode
+// GetSourceFileName returns the name the solution file must have inside its workspace
+func GetSourceFileName(extension string) string {
+	if language, ok := config.Languages.ByExtension(extension); ok {
+		return language.FileName
+	}
+	return "main." + extension
 }
 
-func modifyJavaCode(code string, entryPoint string) string {
-	// Replace public class with "public class Main" to match the file name
-	modifiedCode := code
-
-	// Use regex to find and replace "public class X" with "public class Main"
-	re := regexp.MustCompile(`public\s+class\s+\w+`)
-	modifiedCode = re.ReplaceAllString(modifiedCode, "public class Main")
-
-	return modifiedCode
-}
+// PrepareWorkspace creates a temporary directory with the solution and any files its toolchain needs.
+// It returns the directory and the name of the source file inside it.
+func PrepareWorkspace(extension string, code string) (string, string, error) {
+	workDir, err := util.CreateTempDir()
+	if err != nil {
+		return "", "", err
+	}
+	// The sandbox runs the compiler as an unprivileged user, which has to be able to write its output here
+	if err := os.Chmod(workDir, 0777); err != nil {
+		util.CleanupTempDir(workDir)
+		return "", "", err
+	}
 
-func GetFileExtensionAndModifiedCode(language string, code string, entryPoint string) (string, string) {
-	extension := ""
-	modifiedCode := code
-	switch language {
-	case "Python":
-		extension = "py"
-		modifiedCode = modifyPythonCode(code, entryPoint)
-	case "JavaScript":
-		extension = "js"
-		modifiedCode = modifyJSCode(code, entryPoint)
-	case "Java":
-		extension = "java"
-		modifiedCode = modifyJavaCode(code, entryPoint)
-	case "C++":
-		extension = "cpp"
-	case "C#":
-		extension = "cs"
+	sourceFile := GetSourceFileName(extension)
+	if err := os.WriteFile(filepath.Join(workDir, sourceFile), []byte(code), 0644); err != nil {
+		util.CleanupTempDir(workDir)
+		return "", "", err
 	}
-	return extension, modifiedCode
-}
 
-func GetDockerCommand(language, codeFile, inputString string, memoryLimit int) []string {
-	cmdArgs := []string{}
-	switch language {
-	case "JavaScript":
-		cmdArgs = []string{
-			"run", "--rm", fmt.Sprintf("--memory=%dm", memoryLimit),
-			// "--memory-swap=-1",
-			// "--cpus=1",
-			"--network", "none", "-v", codeFile + ":/app/code.js", "node:14", "bash", "-c", fmt.Sprintf("node /app/code.js '%s'", inputString),
-		}
-	case "Java":
-		cmdArgs = []string{"run", "--rm", "--network", "none", "-v", codeFile + ":/app/code.java", "openjdk:11", "bash", "-c", fmt.Sprintf("javac /app/code.java && java -cp /app/ code %s", inputString)}
-	case "C++":
-		cmdArgs = []string{"run", "--rm", "--network", "none", "-v", codeFile + ":/app/code.cpp", "gcc:latest", "bash", "-c", fmt.Sprintf("g++ /app/code.cpp -o /app/a.out && ./app/a.out %s", inputString)}
-	case "C#":
-		cmdArgs = []string{
-			"run", "--rm", "--network", "none",
-			"-v", codeFile + ":/code/Program.cs",
-			"mcr.microsoft.com/dotnet/sdk:6.0",
-			"bash", "-c",
-			fmt.Sprintf(
-				"mkdir /app && cd /app && dotnet new console -n MyProject && mv /code/Program.cs /app/MyProject/Program.cs && dotnet run --project /app/MyProject %s",
-				inputString,
-			),
-		}
-	case "Python":
-		// Escape single quotes in the input string
-		escapedInput := strings.ReplaceAll(inputString, "'", "'\\''")
-		cmdArgs = []string{
-			"run",
-			"--rm",
-			"--network",
-			"none",
-			"-v",
-			codeFile + ":/app/code.py",
-			"python:3.8",
-			"bash",
-			"-c",
-			fmt.Sprintf("python3 /app/code.py '%s'", escapedInput),
+	// e.g. the project file of C#
+	language, _ := config.Languages.ByExtension(extension)
+	for name, content := range language.Files() {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644); err != nil {
+			util.CleanupTempDir(workDir)
+			return "", "", err
 		}
 	}
-	return cmdArgs
+
+	return workDir, sourceFile, nil
 }
 
 func AddTestFileToDir(dir string, testFileName string, testFile []byte) error {
@@ -196,30 +77,3 @@ func AddTestFileToDir(dir string, testFileName string, testFile []byte) error {
 	testFilePath := filepath.Join(dir, testFileName)
 	return os.WriteFile(testFilePath, testFile, 0644)
 }
-
-func GetDockerRepoCommand(language, dir, testFileName string) [][]string {
-	cmdArgs := [][]string{}
-
-	switch language {
-	case "JavaScript":
-		// First command: Run npm install with network access
-		cmdArgs = append(cmdArgs, []string{
-			"run", "--rm",
-			"-v", dir + ":/app", "-w", "/app",
-			"node:14",
-			"bash", "-c",
-			"npm install",
-		})
-
-		// Second command: Run npm test with network disabled
-		cmdArgs = append(cmdArgs, []string{
-			"run", "--rm", "--network", "none",
-			"-v", dir + ":/app", "-w", "/app",
-			"node:14",
-			"bash", "-c",
-			"npx jest " + testFileName, // Directly run Jest on the specific test file
-		})
-	}
-
-	return cmdArgs
-}
@@ -0,0 +1,415 @@
+package operations
+
+import (
+	"backend/models"
+	"backend/util"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RepoPhase is a command that runs in the workspace of a repository submission
+type RepoPhase struct {
+	Name      string
+	Command   []string
+	Network   bool // Only setup phases may reach the network, the tests run without it
+	Setup     bool // The tests can't run if a setup phase fails
+	TimeoutMs int
+}
+
+// repoTestRun is the test file of a contest written into a repository, with the phases that run it
+type repoTestRun struct {
+	Phases []RepoPhase
+	Report string // Where the test runner writes its results, relative to the repository
+}
+
+// repoFramework runs the test file of a repository contest with one test framework
+type repoFramework struct {
+	Language string // Language of the registry whose image runs the phases, unless Image is set
+	Image    string
+
+	// Setup writes the test file into the repository at dir. workspace returns the path under which the sandbox
+	// sees a file of the repository, for tools that need absolute paths.
+	Setup func(dir string, testFile []byte, workspace func(name string) string) (repoTestRun, error)
+
+	// Parse reads the report of the test runner into one result per test
+	Parse func(reportPath string) ([]models.TestCaseResult, error)
+
+	// Cache is where the setup phases install the dependencies, nil for frameworks whose dependencies are not cached
+	Cache *repoDependencies
+}
+
+// repoDependencies describes the dependencies of a repository for the dependency cache
+type repoDependencies struct {
+	Dir       string   // Where the setup phases install them, relative to the repository
+	Lockfiles []string // Files whose contents decide them, the first one must exist for the dependencies to be cached
+
+	// Install returns the command that installs the dependencies into Dir of a directory holding only the lockfiles,
+	// without running any code of the packages. workspace is like for repoFramework.Setup.
+	Install func(workspace func(name string) string) []string
+
+	// RunsScripts reports whether installing the dependencies of the repository at dir runs lifecycle scripts. Such
+	// dependencies are never cached, since Install skips the scripts and the cache would change the result.
+	RunsScripts func(dir string) bool
+}
+
+var repoFrameworks = map[models.TestFramework]repoFramework{
+	models.TestFrameworkJest:     {Language: "JavaScript", Setup: setupJest, Parse: readJestReport, Cache: npmDependencies},
+	models.TestFrameworkPytest:   {Language: "Python", Setup: setupPytest, Parse: readJUnitReport, Cache: pipDependencies},
+	models.TestFrameworkUnittest: {Language: "Python", Setup: setupPytest, Parse: readJUnitReport, Cache: pipDependencies},
+	models.TestFrameworkMaven:    {Image: "maven:3.9-eclipse-temurin-17", Setup: setupMaven, Parse: readJUnitReport},
+	models.TestFrameworkGradle:   {Image: "gradle:8.10-jdk17", Setup: setupGradle, Parse: readJUnitReport},
+	models.TestFrameworkGoTest:   {Language: "Go", Setup: setupGoTest, Parse: readGoTestReport, Cache: goDependencies},
+}
+
+// The manifests are part of the key as well, npm and Go need them next to the lockfiles to install
+var (
+	npmDependencies = &repoDependencies{
+		Dir:       "node_modules",
+		Lockfiles: []string{"package-lock.json", "package.json"},
+		Install: func(workspace func(name string) string) []string {
+			return []string{"npm", "ci", "--ignore-scripts", "--no-audit", "--no-fund"}
+		},
+		RunsScripts: npmRunsScripts,
+	}
+	pipDependencies = &repoDependencies{
+		Dir:       ".contestify/python",
+		Lockfiles: []string{"requirements.txt"},
+		// Wheels only, building a source distribution runs its setup.py
+		Install: func(workspace func(name string) string) []string {
+			return []string{"pip", "install", "--no-cache-dir", "--disable-pip-version-check", "--only-binary=:all:",
+				"--target", workspace(".contestify/python"), "pytest", "-r", "requirements.txt"}
+		},
+	}
+	goDependencies = &repoDependencies{
+		Dir:       ".contestify/go",
+		Lockfiles: []string{"go.sum", "go.mod"},
+		Install: func(workspace func(name string) string) []string {
+			return []string{"env", "GOPATH=" + workspace(".contestify/go"), "GOCACHE=" + workspace(".contestify/go-build"),
+				"GOFLAGS=-modcacherw", "go", "mod", "download"}
+		},
+	}
+)
+
+// npmInstallScripts are the scripts of package.json that npm install runs for the package itself
+var npmInstallScripts = []string{"preinstall", "install", "postinstall", "prepare"}
+
+// npmRunsScripts reports whether npm install runs scripts of the package at dir or of any of its dependencies
+func npmRunsScripts(dir string) bool {
+	// node-gyp builds packages with a binding.gyp even without an install script
+	if _, err := os.Stat(filepath.Join(dir, "binding.gyp")); err == nil {
+		return true
+	}
+
+	var manifest struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil && json.Unmarshal(content, &manifest) == nil {
+		for _, name := range npmInstallScripts {
+			if manifest.Scripts[name] != "" {
+				return true
+			}
+		}
+	}
+
+	// Lockfiles of npm 7 and later mark the packages with install scripts
+	var lockfile struct {
+		Packages map[string]struct {
+			HasInstallScript bool `json:"hasInstallScript"`
+		} `json:"packages"`
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "package-lock.json"))
+	if err != nil || json.Unmarshal(content, &lockfile) != nil {
+		return true
+	}
+	for _, pkg := range lockfile.Packages {
+		if pkg.HasInstallScript {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyCacheVersion changes the keys of all entries when the way they are built changes
+const dependencyCacheVersion = "2"
+
+// dependencyCacheKey returns the key of the dependencies of the repository at dir in the dependency cache.
+// ok is false if the framework doesn't cache its dependencies, the repository has no lockfile or installing its
+// dependencies runs lifecycle scripts.
+func dependencyCacheKey(dir string, testFramework models.TestFramework, dependencies *repoDependencies) (string, bool) {
+	if dependencies == nil {
+		return "", false
+	}
+	if dependencies.RunsScripts != nil && dependencies.RunsScripts(dir) {
+		return "", false
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s", dependencyCacheVersion, testFramework)
+	for i, name := range dependencies.Lockfiles {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			if i == 0 {
+				return "", false
+			}
+			continue
+		}
+		fmt.Fprintf(hash, "\x00%s\x00%d\x00", name, len(content))
+		hash.Write(content)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// getRepoFramework returns the test framework and the image it runs in
+func getRepoFramework(name models.TestFramework) (repoFramework, string, error) {
+	framework, ok := repoFrameworks[name]
+	if !ok {
+		return repoFramework{}, "", fmt.Errorf("unsupported test framework: %s", name)
+	}
+	if framework.Image != "" {
+		return framework, framework.Image, nil
+	}
+	image, err := getDockerImageForLanguage(framework.Language)
+	return framework, image, err
+}
+
+// repoFileSuffix keeps the files of the judge from clashing with the files of the repository
+func repoFileSuffix() string {
+	return strconv.Itoa(rand.Intn(1000000))
+}
+
+// writeRepoFile writes a file into the repository, creating the directories on the way
+func writeRepoFile(dir string, name string, content []byte) error {
+	filePath := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, content, 0644)
+}
+
+func setupJest(dir string, testFile []byte, workspace func(name string) string) (repoTestRun, error) {
+	suffix := repoFileSuffix()
+	testFileName := "contestifyJestTest" + suffix + ".test.js"
+	reportFileName := "contestifyJestReport" + suffix + ".json"
+	if err := AddTestFileToDir(dir, testFileName, testFile); err != nil {
+		return repoTestRun{}, err
+	}
+
+	return repoTestRun{
+		Phases: []RepoPhase{
+			{Name: "npm install", Command: []string{"npm", "install"}, Network: true, Setup: true, TimeoutMs: util.REPO_SETUP_TIME_LIMIT},
+			// Directly run Jest on the specific test file
+			{Name: "jest", Command: []string{"npx", "jest", testFileName, "--json", "--outputFile=" + reportFileName}, TimeoutMs: util.REPO_TEST_TIME_LIMIT},
+		},
+		Report: reportFileName,
+	}, nil
+}
+
+// setupPytest installs pytest and the requirements.txt of the repository into the workspace, as the image is read-only
+func setupPytest(dir string, testFile []byte, workspace func(name string) string) (repoTestRun, error) {
+	suffix := repoFileSuffix()
+	testFileName := "test_contestify_" + suffix + ".py"
+	reportFileName := "contestify_report_" + suffix + ".xml"
+	if err := AddTestFileToDir(dir, testFileName, testFile); err != nil {
+		return repoTestRun{}, err
+	}
+	packages := workspace(".contestify/python")
+
+	install := `if [ -f requirements.txt ]; then set -- "$@" -r requirements.txt; fi; exec pip install --no-cache-dir --disable-pip-version-check "$@"`
+	return repoTestRun{
+		Phases: []RepoPhase{
+			{Name: "pip install", Command: []string{"sh", "-c", install, "sh", "--target", packages, "pytest"}, Network: true, Setup: true, TimeoutMs: util.REPO_SETUP_TIME_LIMIT},
+			{Name: "pytest", Command: []string{"env", "PYTHONPATH=" + packages, "python", "-m", "pytest", testFileName, "--junitxml=" + reportFileName, "-p", "no:cacheprovider"}, TimeoutMs: util.REPO_TEST_TIME_LIMIT},
+		},
+		Report: reportFileName,
+	}, nil
+}
+
+var (
+	javaPackagePattern     = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*;`)
+	javaPublicClassPattern = regexp.MustCompile(`(?:^|[^.\w])public\s+(?:(?:final|abstract|strictfp)\s+)*class\s+(\w+)`)
+	javaClassPattern       = regexp.MustCompile(`(?:^|[^.\w])class\s+(\w+)`)
+)
+
+// javaTopLevel returns the Java source without comments, literals and everything between braces. What is left are
+// the package declaration, the imports and the headers of the top-level types.
+func javaTopLevel(source string) string {
+	var topLevel strings.Builder
+	depth := 0
+	for i := 0; i < len(source); i++ {
+		skipTo := func(end string, from int) {
+			if j := strings.Index(source[from:], end); j >= 0 {
+				i = from + j + len(end) - 1
+			} else {
+				i = len(source)
+			}
+			topLevel.WriteByte(' ')
+		}
+
+		switch c := source[i]; {
+		case strings.HasPrefix(source[i:], "//"):
+			skipTo("\n", i)
+		case strings.HasPrefix(source[i:], "/*"):
+			skipTo("*/", i+2)
+		case strings.HasPrefix(source[i:], `"""`):
+			skipTo(`"""`, i+3)
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(source) && source[j] != c && source[j] != '\n' {
+				if source[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			i = j
+			topLevel.WriteByte(' ')
+		case c == '{':
+			depth++
+			topLevel.WriteByte(' ')
+		case c == '}':
+			depth = max(depth-1, 0)
+		case depth == 0:
+			topLevel.WriteByte(c)
+		}
+	}
+	return topLevel.String()
+}
+
+// writeJUnitTestFile writes a Java test file where Maven and Gradle look for test classes and returns the fully
+// qualified name of its class
+func writeJUnitTestFile(dir string, testFile []byte) (string, error) {
+	// Only the top-level class counts, not nested classes or the word class in comments and strings
+	topLevel := javaTopLevel(string(testFile))
+	match := javaPublicClassPattern.FindStringSubmatch(topLevel)
+	if match == nil {
+		match = javaClassPattern.FindStringSubmatch(topLevel)
+	}
+	if match == nil {
+		return "", fmt.Errorf("the test file declares no class")
+	}
+	className := match[1]
+
+	qualifiedName := className
+	sourcePath := "src/test/java/" + className + ".java"
+	if match := javaPackagePattern.FindStringSubmatch(topLevel); match != nil {
+		qualifiedName = match[1] + "." + className
+		sourcePath = path.Join("src/test/java", strings.ReplaceAll(match[1], ".", "/"), className+".java")
+	}
+	return qualifiedName, writeRepoFile(dir, sourcePath, testFile)
+}
+
+// setupMaven resolves the dependencies and the Surefire provider into a local repository inside the workspace by
+// running the build with a test filter that matches nothing, so that the tests can run offline
+func setupMaven(dir string, testFile []byte, workspace func(name string) string) (repoTestRun, error) {
+	className, err := writeJUnitTestFile(dir, testFile)
+	if err != nil {
+		return repoTestRun{}, err
+	}
+	maven := []string{"mvn", "-B", "-Dmaven.repo.local=" + workspace(".contestify/m2")}
+
+	return repoTestRun{
+		Phases: []RepoPhase{
+			{Name: "mvn dependencies", Command: append(maven, "test", "-Dtest=ContestifyNoSuchTest", "-Dsurefire.failIfNoSpecifiedTests=false", "-DfailIfNoTests=false"), Network: true, Setup: true, TimeoutMs: util.REPO_SETUP_TIME_LIMIT},
+			{Name: "mvn test", Command: append(maven, "-o", "test", "-Dtest="+className), TimeoutMs: util.REPO_TEST_TIME_LIMIT},
+		},
+		Report: "target/surefire-reports/TEST-" + className + ".xml",
+	}, nil
+}
+
+// gradleResolveScript adds a task that downloads everything the tests need at runtime, which compiling them doesn't
+const gradleResolveScript = `allprojects {
+    tasks.register('contestifyResolve') {
+        doLast {
+            project.configurations.matching { it.name == 'testRuntimeClasspath' }.each { it.resolve() }
+        }
+    }
+}
+`
+
+// gradleCommand runs the Gradle wrapper of the repository if it has one, otherwise the Gradle of the image
+const gradleCommand = `if [ -x ./gradlew ]; then exec ./gradlew "$@"; fi; exec gradle "$@"`
+
+func setupGradle(dir string, testFile []byte, workspace func(name string) string) (repoTestRun, error) {
+	className, err := writeJUnitTestFile(dir, testFile)
+	if err != nil {
+		return repoTestRun{}, err
+	}
+	initScript := ".contestify/resolve" + repoFileSuffix() + ".gradle"
+	if err := writeRepoFile(dir, initScript, []byte(gradleResolveScript)); err != nil {
+		return repoTestRun{}, err
+	}
+	gradle := []string{"sh", "-c", gradleCommand, "sh", "--no-daemon", "-g", workspace(".contestify/gradle")}
+
+	return repoTestRun{
+		Phases: []RepoPhase{
+			{Name: "gradle dependencies", Command: append(gradle, "-I", workspace(initScript), "testClasses", "contestifyResolve"), Network: true, Setup: true, TimeoutMs: util.REPO_SETUP_TIME_LIMIT},
+			{Name: "gradle test", Command: append(gradle, "--offline", "test", "--tests", className), TimeoutMs: util.REPO_TEST_TIME_LIMIT},
+		},
+		Report: "build/test-results/test/TEST-" + className + ".xml",
+	}, nil
+}
+
+var goTestFunctionPattern = regexp.MustCompile(`(?m)^func\s+(Test\w*)\s*\(\s*\w+\s+\*testing\.T\s*\)`)
+
+// setupGoTest downloads the modules into a module cache inside the workspace and runs only the tests of the test file,
+// which goes into the package at the root of the repository
+func setupGoTest(dir string, testFile []byte, workspace func(name string) string) (repoTestRun, error) {
+	var tests []string
+	for _, match := range goTestFunctionPattern.FindAllSubmatch(testFile, -1) {
+		tests = append(tests, string(match[1]))
+	}
+	if len(tests) == 0 {
+		return repoTestRun{}, fmt.Errorf("the test file declares no tests")
+	}
+
+	suffix := repoFileSuffix()
+	testFileName := "contestify_" + suffix + "_test.go"
+	reportFileName := "contestify_report_" + suffix + ".json"
+	if err := AddTestFileToDir(dir, testFileName, testFile); err != nil {
+		return repoTestRun{}, err
+	}
+
+	// The module cache is read-only by default, which would keep the workspace from being removed
+	goEnv := []string{"env", "GOPATH=" + workspace(".contestify/go"), "GOCACHE=" + workspace(".contestify/go-build"), "GOFLAGS=-modcacherw"}
+	// go test -json writes to stdout, which is cut off at the output limit
+	test := `exec go test -json -run "$1" . > "$2"`
+
+	return repoTestRun{
+		Phases: []RepoPhase{
+			{Name: "go mod download", Command: append(goEnv, "go", "mod", "download"), Network: true, Setup: true, TimeoutMs: util.REPO_SETUP_TIME_LIMIT},
+			{Name: "go test", Command: append(goEnv, "GOPROXY=off", "sh", "-c", test, "sh", "^("+strings.Join(tests, "|")+")$", reportFileName), TimeoutMs: util.REPO_TEST_TIME_LIMIT},
+		},
+		Report: reportFileName,
+	}, nil
+}
+
+// specResult stores the outcome of a test of a repository submission as a test case result
+func specResult(name string, passed bool, durationMs int, failureMessage string) models.TestCaseResult {
+	verdict := models.VerdictWrongAnswer
+	if passed {
+		verdict = models.VerdictAccepted
+	}
+
+	failureMessage = ansiEscapePattern.ReplaceAllString(failureMessage, "")
+	if limit := util.OutputLimitBytes(); len(failureMessage) > limit {
+		failureMessage = failureMessage[:limit]
+	}
+	// The limit may cut a character in half, and the database only stores valid UTF-8
+	failureMessage = strings.ToValidUTF8(failureMessage, "")
+
+	return models.TestCaseResult{
+		Name:           &name,
+		Passed:         passed,
+		Verdict:        verdict,
+		FailureMessage: nilIfEmpty(failureMessage),
+		Time:           durationMs,
+	}
+}
@@ -0,0 +1,118 @@
+package operations
+
+import (
+	"backend/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// wantSpec is the part of a test case result the report tests compare
+type wantSpec struct {
+	name    string
+	passed  bool
+	timeMs  int
+	message string // Contained in the failure message, "" for none
+}
+
+// checkSpecs compares the results read from a report with the expected specs, in order
+func checkSpecs(t *testing.T, results []models.TestCaseResult, want []wantSpec) {
+	t.Helper()
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(results), len(want), results)
+	}
+	for i, result := range results {
+		if result.Name == nil || *result.Name != want[i].name {
+			t.Errorf("result %d: name = %v, want %q", i, result.Name, want[i].name)
+			continue
+		}
+		if result.Passed != want[i].passed || result.Time != want[i].timeMs {
+			t.Errorf("%s: passed = %v in %d ms, want %v in %d ms", want[i].name, result.Passed, result.Time, want[i].passed, want[i].timeMs)
+		}
+		switch {
+		case want[i].message == "" && result.FailureMessage != nil:
+			t.Errorf("%s: failure message = %q, want none", want[i].name, *result.FailureMessage)
+		case want[i].message != "" && (result.FailureMessage == nil || !strings.Contains(*result.FailureMessage, want[i].message)):
+			t.Errorf("%s: failure message = %v, want it to contain %q", want[i].name, result.FailureMessage, want[i].message)
+		}
+		if result.FailureMessage != nil && strings.Contains(*result.FailureMessage, "\x1b[") {
+			t.Errorf("%s: failure message keeps color codes: %q", want[i].name, *result.FailureMessage)
+		}
+	}
+}
+
+func TestSpecResultTruncatesAtCharacters(t *testing.T) {
+	t.Setenv("JUDGE_OUTPUT_LIMIT_KB", "1")
+
+	// The limit of 1024 bytes falls into the middle of a two-byte character
+	result := specResult("test", false, 0, "a"+strings.Repeat("é", 1024))
+	message := *result.FailureMessage
+	if !utf8.ValidString(message) {
+		t.Fatalf("failure message is not valid UTF-8: ...%q", message[len(message)-4:])
+	}
+	if len(message) != 1023 {
+		t.Errorf("failure message has %d bytes, want the 1023 bytes of whole characters below the limit", len(message))
+	}
+}
+
+func TestWriteJUnitTestFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		want     string
+		wantPath string
+	}{
+		{
+			name:     "public class",
+			source:   "package com.example;\n\nimport org.junit.jupiter.api.Test;\n\npublic class CalculatorTest {\n    @Test\n    void adds() {}\n}\n",
+			want:     "com.example.CalculatorTest",
+			wantPath: "src/test/java/com/example/CalculatorTest.java",
+		},
+		{
+			name:     "class in a comment",
+			source:   "/**\n * Tests the class Calculator of the submission.\n */\nclass CalculatorTest {\n}\n",
+			want:     "CalculatorTest",
+			wantPath: "src/test/java/CalculatorTest.java",
+		},
+		{
+			name:     "nested class first",
+			source:   "import org.junit.jupiter.api.Nested;\n\nfinal class OuterTest {\n    static class Helper {}\n\n    @Nested\n    class Inner {}\n}\n",
+			want:     "OuterTest",
+			wantPath: "src/test/java/OuterTest.java",
+		},
+		{
+			name:     "public class after a package-private one",
+			source:   "// class Old was removed\nclass Fixture {\n    String name = \"class Fake\";\n}\n\n@ExtendWith(MockitoExtension.class)\npublic final class ShopTest {\n    char brace = '{';\n}\n",
+			want:     "ShopTest",
+			wantPath: "src/test/java/ShopTest.java",
+		},
+		{
+			name:     "package in a comment",
+			source:   "/*\npackage com.old;\n*/\npackage com.shop;\npublic class CartTest {}\n",
+			want:     "com.shop.CartTest",
+			wantPath: "src/test/java/com/shop/CartTest.java",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			got, err := writeJUnitTestFile(dir, []byte(tt.source))
+			if err != nil {
+				t.Fatalf("writeJUnitTestFile() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("writeJUnitTestFile() = %q, want %q", got, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.wantPath)); err != nil {
+				t.Errorf("test file not written to %s: %v", tt.wantPath, err)
+			}
+		})
+	}
+
+	if _, err := writeJUnitTestFile(t.TempDir(), []byte("// class Nothing\ninterface Shop {}\n")); err == nil {
+		t.Error("writeJUnitTestFile() of a file without a class = nil error")
+	}
+}
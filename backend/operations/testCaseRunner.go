@@ -0,0 +1,238 @@
+package operations
+
+import (
+	"backend/models"
+	"backend/util"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// testCaseParallelism returns how many test cases of a submission may run at once.
+// The sandbox's pool still caps how many programs run over all submissions.
+func testCaseParallelism() int {
+	if parallelism, err := strconv.Atoi(os.Getenv("JUDGE_TEST_PARALLELISM")); err == nil && parallelism > 0 {
+		return parallelism
+	}
+	return util.DEFAULT_TEST_PARALLELISM
+}
+
+// MaxJudgeDuration returns how long judging a submission in the language takes at most once its programs have sandbox
+// slots: compiling the solution and the judge programs, then running the test cases with their checker on
+// testCaseParallelism workers
+func MaxJudgeDuration(contest *models.Contest, language string) time.Duration {
+	total := util.COMPILE_TIME_LIMIT
+	if contest.Interactive {
+		total += util.COMPILE_TIME_LIMIT
+	}
+
+	limits := resolveLanguageLimits(contest, language)
+	usesCustom := false
+	sum, longest := 0, 0
+	for _, testCase := range contest.TestCases {
+		timeLimit, _ := limits.apply(applyDefaultIfInvalid(testCase.TimeLimit, util.DEFAULT_TIME_LIMIT, util.MAX_TIME_LIMIT), 0)
+		checker := testCase.Checker
+		if checker == models.CheckerDefault {
+			checker = contest.Checker
+		}
+		if checker == models.CheckerCustom {
+			usesCustom = true
+			timeLimit += util.CHECKER_TIME_LIMIT
+		}
+		sum += timeLimit
+		longest = max(longest, timeLimit)
+	}
+	if usesCustom {
+		total += util.COMPILE_TIME_LIMIT
+	}
+	// No worker is idle while test cases are left, so the last one to finish started before sum/parallelism
+	if parallelism := min(testCaseParallelism(), len(contest.TestCases)); parallelism > 0 {
+		total += sum/parallelism + longest
+	}
+	return time.Duration(total) * time.Millisecond
+}
+
+// submissionJudge runs a compiled submission against the test cases of its contest
+type submissionJudge struct {
+	sandbox    util.Sandbox
+	solution   models.Solution
+	workDir    string
+	sourceFile string
+	testCases  []models.TestCase
+	checker    *outputChecker
+	interactor *interactor // Only set for interactive contests
+	limits     languageLimits
+}
+
+// judgedTestCase is the outcome of a single test case
+type judgedTestCase struct {
+	execResult util.ExecutionResult
+	result     models.TestCaseResult
+}
+
+// run judges the test cases on up to testCaseParallelism workers. The returned slice is in the order of the test
+// cases and onJudged is called in that order too, as soon as a test case and all before it are judged.
+// With stopOnFirstFailure, test cases after the first failed one are not started and stay nil in the result;
+// those already running are still judged. An error means judging itself failed, e.g. the checker crashed, or ctx is done.
+func (j *submissionJudge) run(ctx context.Context, stopOnFirstFailure bool, onJudged func(idx int, testCase judgedTestCase)) ([]*judgedTestCase, error) {
+	type outcome struct {
+		idx      int
+		testCase judgedTestCase
+		err      error
+	}
+
+	var next atomic.Int64 // Index of the next test case to start
+	var stopAt atomic.Int64
+	stopAt.Store(int64(len(j.testCases)))
+	stop := func(idx int) {
+		for {
+			current := stopAt.Load()
+			if int64(idx) >= current || stopAt.CompareAndSwap(current, int64(idx)) {
+				return
+			}
+		}
+	}
+
+	outcomes := make(chan outcome, len(j.testCases))
+	var wg sync.WaitGroup
+	for worker := 0; worker < min(testCaseParallelism(), len(j.testCases)); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Every worker gets its own warm container, interactive runs always get fresh containers
+			var session util.SandboxSession
+			if j.interactor == nil {
+				session = startSession(ctx, j.sandbox, j.solution, j.workDir, j.sourceFile, j.testCases, j.limits)
+				if session != nil {
+					defer session.Close()
+				}
+			}
+
+			for {
+				idx := int(next.Add(1) - 1)
+				if int64(idx) >= stopAt.Load() {
+					return
+				}
+
+				testCase, err := j.judgeTestCase(ctx, idx, session)
+				if err != nil || (stopOnFirstFailure && !testCase.result.Passed) {
+					stop(idx + 1)
+				}
+				outcomes <- outcome{idx: idx, testCase: testCase, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	judged := make([]*judgedTestCase, len(j.testCases))
+	errs := make([]error, len(j.testCases))
+	reported := 0
+	for outcome := range outcomes {
+		if outcome.err != nil {
+			errs[outcome.idx] = outcome.err
+			continue
+		}
+		judged[outcome.idx] = &outcome.testCase
+
+		// Report in order, later test cases wait for the earlier ones
+		for reported < len(judged) && judged[reported] != nil {
+			onJudged(reported, *judged[reported])
+			reported++
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return judged, nil
+}
+
+// judgeTestCase runs the solution for one test case, in the session if there is one, and checks its output.
+// The sandbox enforces the time limit from the moment the program has a slot, so ctx carries no deadline of the
+// test case: waiting for a slot behind other submissions must not turn into a runtime error. Once ctx is done the
+// outcome of the run says nothing about the solution, so it is an error instead of a verdict.
+func (j *submissionJudge) judgeTestCase(ctx context.Context, idx int, session util.SandboxSession) (judgedTestCase, error) {
+	testCase := j.testCases[idx]
+
+	// Apply default limits if invalid values provided
+	timeLimit := applyDefaultIfInvalid(testCase.TimeLimit, util.DEFAULT_TIME_LIMIT, util.MAX_TIME_LIMIT)
+	memoryLimit := applyDefaultIfInvalid(testCase.MemoryLimit, util.DEFAULT_MEMORY_LIMIT, util.MAX_MEMORY_LIMIT)
+	// Slower languages get more time and memory, the results record the adjusted limits
+	timeLimit, memoryLimit = j.limits.apply(timeLimit, memoryLimit)
+
+	input := strings.TrimSpace(testCase.Input)
+	expectedOutput := strings.TrimSpace(testCase.Output)
+
+	var execResult util.ExecutionResult
+	outputMatches := false
+	var err error
+
+	if j.interactor != nil {
+		// The interactor decides whether the answer is right while the solution runs
+		execResult, outputMatches, err = j.interactor.Run(ctx, idx, j.solution, j.workDir, j.sourceFile, input, expectedOutput, timeLimit, memoryLimit)
+		if err != nil {
+			return judgedTestCase{}, fmt.Errorf("test case #%d: %w", idx+1, err)
+		}
+	} else {
+		if session != nil {
+			execResult = ExecuteCodeInSession(ctx, session, j.solution, input, timeLimit, memoryLimit)
+		} else {
+			// Execute code with the new Docker client
+			execResult, err = ExecuteCode(ctx, j.sandbox, j.solution, input, j.workDir, j.sourceFile, timeLimit, memoryLimit)
+			if err != nil {
+				log.Printf("Error executing code for test case #%d: %v", idx+1, err)
+			}
+		}
+
+		// Compare outputs only if the program finished normally
+		if execResult.Error == nil {
+			log.Printf("Test Case #%d Comparison: \nExpected: '%s'\nActual:   '%s'", idx+1, expectedOutput, execResult.Output)
+
+			outputMatches, err = j.checker.Check(ctx, idx, testCase, input, expectedOutput, execResult.Output)
+			if err != nil {
+				return judgedTestCase{}, fmt.Errorf("test case #%d: %w", idx+1, err)
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return judgedTestCase{}, fmt.Errorf("test case #%d: %w", idx+1, err)
+	}
+
+	verdict := determineVerdict(execResult, outputMatches, timeLimit)
+
+	// Create test case result
+	testCaseResult := models.TestCaseResult{
+		TestCaseID:       &testCase.ID,
+		Passed:           verdict == models.VerdictAccepted,
+		Verdict:          verdict,
+		SolutionOutput:   &execResult.Output,
+		Stderr:           nilIfEmpty(execResult.Stderr),
+		Input:            &input,
+		ExpectedOutput:   &expectedOutput,
+		MemoryUsage:      int(execResult.MemUsage),
+		Time:             int(execResult.Duration),
+		CPUUsage:         execResult.CPUUsage,
+		MemoryUsageLimit: memoryLimit,
+		TimeLimit:        timeLimit,
+	}
+	j.limits.record(&testCaseResult)
+
+	log.Printf("Test Case #%d Result: verdict=%s, time=%dms, memUsage=%d bytes, CPU=%.2f%%, error=%v",
+		idx+1, testCaseResult.Verdict, testCaseResult.Time, execResult.MemUsage, execResult.CPUUsage, execResult.Error)
+
+	return judgedTestCase{execResult: execResult, result: testCaseResult}, nil
+}
@@ -3,20 +3,23 @@ package routes
 import (
 	"backend/handlers"
 	"backend/middlewares"
+	"backend/services"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
-func Setup(app *fiber.App, db *gorm.DB) {
+func Setup(app *fiber.App, db *gorm.DB, judgeService *services.JudgeService) {
 	api := app.Group("/api/v1")
 
 	userHandler := handlers.NewUserHandler(db)
 	contestHandler := handlers.NewContestHandler(db)
-	submissionHandler := handlers.NewSubmissionHandler(db)
+	submissionHandler := handlers.NewSubmissionHandler(db, judgeService)
 	leaderboardHandler := handlers.NewLeaderboardHandler(db)
 	githubHandler := handlers.NewGitHubHandler()
 	invitationHandler := handlers.NewInvitationHandler(db)
+	languageHandler := handlers.NewLanguageHandler(db)
+	dependencyCacheHandler := handlers.NewDependencyCacheHandler(db)
 
 	// public routes
 	api.Post("/auth/signIn", userHandler.UserSignIn)
@@ -36,6 +39,11 @@ func Setup(app *fiber.App, db *gorm.DB) {
 	api.Get("/users/:userId/invited-contests", contestHandler.GetUserInvitedContests)
 	api.Post("/contest/github/createRepo", githubHandler.CreateRepositoryFromTemplate)
 
+	// Admin only (checked in handlers)
+	api.Get("/admin/languages", languageHandler.ListLanguages)
+	api.Get("/admin/dependency-cache", dependencyCacheHandler.GetDependencyCache)
+	api.Delete("/admin/dependency-cache", dependencyCacheHandler.PurgeDependencyCache)
+
 	// Specific contest routes (needs access check)
 	contestAccess := middlewares.ContestAccessMiddleware(db)
 
@@ -46,6 +54,9 @@ func Setup(app *fiber.App, db *gorm.DB) {
 	api.Post("/codeSubmit/:contestId", contestAccess, submissionHandler.CreateSubmission)
 	api.Get("/submissions/:contestId", contestAccess, submissionHandler.GetSubmissionsByContestID)
 	api.Get("/submissions/:contestId/:ownerId", contestAccess, submissionHandler.GetSubmissionsByOwnerID)
+	api.Get("/submissions/:contestId/:submissionId/events", contestAccess, submissionHandler.StreamSubmissionEvents)
+	api.Get("/contest/:contestId/standings", contestAccess, leaderboardHandler.GetContestStandings)
+	api.Get("/contest/:contestId/stats", contestAccess, leaderboardHandler.GetContestStats)
 
 	// Contest management routes - only owner can access (checked in handlers)
 	api.Put("/contest/:id", contestHandler.EditContest)
@@ -53,6 +64,7 @@ func Setup(app *fiber.App, db *gorm.DB) {
 	api.Post("/contest/:id/TestCases", contestHandler.AddTestCase)
 	api.Put("/contest/:contestId/TestCases", contestHandler.UpdateTestCase)
 	api.Delete("/contest/:contestId/TestCases/:testCaseId", contestHandler.DeleteTestCase)
+	api.Get("/contest/:contestId/llm-usage", contestHandler.GetContestLLMUsage)
 
 	// Get submission by ID doesn't need contest access middleware (checked in handler)
 	api.Get("/submission/:id", submissionHandler.GetSubmissionByID)
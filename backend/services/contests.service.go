@@ -158,8 +158,18 @@ func (s *ContestService) CreateContest(ctx context.Context, contest *models.Cont
 	return s.DB.Create(contest).Error
 }
 
-func (s *ContestService) EditContest(ctx context.Context, id string, contest *models.Contest) error {
-	return s.DB.Model(&models.Contest{}).Where("id = ?", id).Updates(contest).Error
+// EditContest updates the non-zero fields of the contest. The columns named in clearable are written even if they
+// are empty, e.g. to remove the allowed languages of a contest.
+func (s *ContestService) EditContest(ctx context.Context, id string, contest *models.Contest, clearable ...string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Contest{}).Where("id = ?", id).Updates(contest).Error; err != nil {
+			return err
+		}
+		if len(clearable) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Contest{}).Where("id = ?", id).Select(clearable).Updates(contest).Error
+	})
 }
 
 func (s *ContestService) DeleteContest(ctx context.Context, id string) error {
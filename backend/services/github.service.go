@@ -17,7 +17,7 @@ func (s *GitHubService) CreateRepositoryFromTemplate(ctx context.Context, github
 	if err != nil {
 		return "", err
 	}
-	templateRepoPath, err := util.CloneRepository(templateCloneURL, githubAccessToken)
+	templateRepoPath, err := util.CloneRepository(ctx, templateCloneURL, githubAccessToken)
 	if err != nil {
 		return "", err
 	}
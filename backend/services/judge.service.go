@@ -0,0 +1,363 @@
+package services
+
+import (
+	"backend/models"
+	"backend/operations"
+	"backend/util"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Time a worker may spend judging a single submission. Repositories get the time limits of cloning, installing
+	// the dependencies and running the tests, plus a minute for waiting on the sandbox and storing the results.
+	// Installing may take twice, when building an entry of the dependency cache fails and the repository installs them.
+	repoJudgeTimeout = (util.REPO_CLONE_TIME_LIMIT+2*util.REPO_SETUP_TIME_LIMIT+util.REPO_TEST_TIME_LIMIT)*time.Millisecond + time.Minute
+
+	// Code submissions get the longest their judging can take, see codeJudgeTimeout, plus codeJudgeSlack for waiting
+	// on sandbox slots, asking the model for the entry point and storing the results
+	codeJudgeSlack      = 2 * time.Minute
+	maxCodeJudgeTimeout = repoJudgeTimeout
+
+	// A lease has to outlive the longest judging run, otherwise another worker would take the job over
+	judgeLeaseDuration = max(repoJudgeTimeout, maxCodeJudgeTimeout) + time.Minute
+
+	// Time for loading what judging a submission needs, before its own timeout applies
+	judgeLoadTimeout = 10 * time.Second
+
+	// How often idle workers look for new or expired jobs in the database
+	judgePollInterval = 2 * time.Second
+
+	judgeMaxAttempts  = 3
+	judgeRetryBackoff = 15 * time.Second
+)
+
+// permanentJudgeError marks failures that judging the submission again can't fix
+type permanentJudgeError struct {
+	error
+}
+
+func (e permanentJudgeError) Unwrap() error {
+	return e.error
+}
+
+// JudgeService runs the pool of workers draining the durable judge_jobs queue
+type JudgeService struct {
+	SubmissionService *SubmissionService
+	JudgeJobService   *JudgeJobService
+	UserService       *UserService
+	Events            *JudgeEventBroker
+	Sandbox           util.Sandbox
+	workers           int
+	instanceID        string
+	wake              chan struct{}
+}
+
+func NewJudgeService(db *gorm.DB, workers int, sandbox util.Sandbox) *JudgeService {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "judge"
+	}
+	// Pods and containers may share a hostname, the boot ID at least tells machines apart
+	instanceID := hostname
+	if bootID, err := os.ReadFile("/proc/sys/kernel/random/boot_id"); err == nil {
+		instanceID += ":" + strings.TrimSpace(string(bootID))
+	}
+
+	return &JudgeService{
+		SubmissionService: NewSubmissionService(db),
+		JudgeJobService:   NewJudgeJobService(db),
+		UserService:       NewUserService(db),
+		Events:            NewJudgeEventBroker(),
+		Sandbox:           sandbox,
+		workers:           workers,
+		instanceID:        instanceID,
+		wake:              make(chan struct{}, workers),
+	}
+}
+
+// Start recovers jobs orphaned by a previous run and launches the worker pool
+func (s *JudgeService) Start() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	released, err := s.JudgeJobService.ExpireOrphanedLeases(ctx, s.instanceID+":", s.isOrphanedWorker)
+	if err != nil {
+		log.Printf("Error recovering orphaned judge jobs: %v", err)
+	} else if released > 0 {
+		log.Printf("Recovered %d judge jobs orphaned by a previous run", released)
+	}
+
+	for i := 0; i < s.workers; i++ {
+		go s.worker(fmt.Sprintf("%s:%d:%d", s.instanceID, os.Getpid(), i+1))
+	}
+	log.Printf("Judge queue started with %d workers", s.workers)
+}
+
+// isOrphanedWorker reports whether the process of a worker of this instance is gone. Worker IDs are
+// "<instance>:<pid>:<n>"; a lease of a process that is still running, e.g. another backend sharing the hostname,
+// is left alone and only expires with its lease. It is only called from Start, before any worker of this process
+// has leased a job, so a lease carrying this PID was left by an earlier run, e.g. PID 1 of a restarted container.
+func (s *JudgeService) isOrphanedWorker(workerID string) bool {
+	parts := strings.Split(strings.TrimPrefix(workerID, s.instanceID+":"), ":")
+	if len(parts) != 2 {
+		return false
+	}
+	pid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	if pid == os.Getpid() {
+		return true
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return true
+	}
+	// Signal 0 only checks whether the process exists
+	return errors.Is(process.Signal(syscall.Signal(0)), os.ErrProcessDone)
+}
+
+// Submit stores the submission as queued and wakes up an idle worker
+func (s *JudgeService) Submit(ctx context.Context, submission *models.Submission) (*models.Submission, error) {
+	submission.JudgeStatus = models.SubmissionStatusQueued
+	if err := s.JudgeJobService.EnqueueSubmission(ctx, submission, judgeMaxAttempts); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+		// All workers are busy or already woken up
+	}
+	return submission, nil
+}
+
+func (s *JudgeService) worker(workerID string) {
+	ticker := time.NewTicker(judgePollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.drainQueue(workerID)
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainQueue keeps leasing and judging jobs until the queue is empty
+func (s *JudgeService) drainQueue(workerID string) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		deadLettered, err := s.JudgeJobService.DeadLetterExpiredJobs(ctx)
+		if err != nil {
+			log.Printf("Judge worker %s: error dead-lettering expired jobs: %v", workerID, err)
+		}
+		for _, submissionID := range deadLettered {
+			// Ends the streams of the submissions and drops their history
+			s.Events.Publish(submissionID, JudgeEvent{Type: JudgeEventSummary, Data: JudgeSummary{
+				SubmissionID: submissionID,
+				JudgeStatus:  models.SubmissionStatusFailed,
+				JudgeError:   judgeInterruptedError,
+			}})
+		}
+		job, err := s.JudgeJobService.LeaseNextJob(ctx, workerID, judgeLeaseDuration)
+		cancel()
+
+		if err != nil {
+			log.Printf("Judge worker %s: error leasing job: %v", workerID, err)
+			return
+		}
+		if job == nil {
+			return
+		}
+
+		log.Printf("Judge worker %s picked up submission %s (attempt %d/%d)", workerID, job.SubmissionID, job.Attempts, job.MaxAttempts)
+		s.processJob(job)
+	}
+}
+
+func (s *JudgeService) processJob(job *models.JudgeJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if judgeErr := s.judge(job.SubmissionID); judgeErr != nil {
+		log.Printf("Judging submission %s failed: %v", job.SubmissionID, judgeErr)
+		var permanent permanentJudgeError
+		retryable := !errors.As(judgeErr, &permanent)
+		deadLettered, err := s.JudgeJobService.FailJob(ctx, job, judgeErr, time.Duration(job.Attempts)*judgeRetryBackoff, retryable)
+		if err != nil {
+			log.Printf("Error updating failed judge job %s: %v", job.ID, err)
+			return
+		}
+
+		if deadLettered {
+			log.Printf("Judge job %s dead-lettered after %d attempts (retryable: %v)", job.ID, job.Attempts, retryable)
+			s.Events.Publish(job.SubmissionID, JudgeEvent{Type: JudgeEventSummary, Data: JudgeSummary{
+				SubmissionID: job.SubmissionID,
+				JudgeStatus:  models.SubmissionStatusFailed,
+				JudgeError:   judgeErr.Error(),
+			}})
+		} else {
+			s.Events.Publish(job.SubmissionID, JudgeEvent{Type: JudgeEventStatus, Data: JudgeStatusUpdate{
+				JudgeStatus: models.SubmissionStatusQueued,
+				JudgeError:  judgeErr.Error(),
+			}})
+		}
+		return
+	}
+
+	if err := s.JudgeJobService.CompleteJob(ctx, job); err != nil {
+		log.Printf("Error completing judge job %s: %v", job.ID, err)
+	}
+}
+
+// codeJudgeTimeout returns the time a worker may spend judging a code submission in the language, at most
+// maxCodeJudgeTimeout. Judging that runs out of it fails the job instead of grading the submission.
+func codeJudgeTimeout(contest *models.Contest, language string) time.Duration {
+	return min(operations.MaxJudgeDuration(contest, language)+codeJudgeSlack, maxCodeJudgeTimeout)
+}
+
+// judge runs all test cases for a queued submission and stores the results
+func (s *JudgeService) judge(submissionID string) error {
+	submission, err := s.SubmissionService.GetSubmissionByID(submissionID)
+	if err != nil {
+		return err
+	}
+
+	// The contest decides how long judging may take
+	loadCtx, cancelLoad := context.WithTimeout(context.Background(), judgeLoadTimeout)
+	contest, err := s.SubmissionService.GetContestForJudging(loadCtx, submission.ContestID)
+	cancelLoad()
+	if err != nil {
+		return fmt.Errorf("error fetching contest: %w", err)
+	}
+
+	timeout := repoJudgeTimeout
+	if !submission.IsRepo {
+		timeout = codeJudgeTimeout(contest, submission.Language)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.SubmissionService.UpdateJudgeStatus(ctx, submission.ID, models.SubmissionStatusRunning, ""); err != nil {
+		return fmt.Errorf("failed to mark submission as running: %w", err)
+	}
+	s.Events.Publish(submission.ID, JudgeEvent{Type: JudgeEventStatus, Data: JudgeStatusUpdate{JudgeStatus: models.SubmissionStatusRunning}})
+
+	if submission.IsRepo {
+		err = s.judgeRepoSubmission(ctx, submission, contest)
+	} else {
+		err = s.judgeCodeSubmission(ctx, submission, contest)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Judged submission - ID: %s, ContestID: %s, Score: %.0f, Passed: %v\n",
+		submission.ID, submission.ContestID, submission.Score, submission.Status)
+
+	if err := s.SubmissionService.SaveJudgeResult(ctx, submission); err != nil {
+		return err
+	}
+
+	submission.JudgeStatus = models.SubmissionStatusJudged
+	submission.JudgeError = ""
+	s.Events.Publish(submission.ID, JudgeEvent{Type: JudgeEventSummary, Data: NewJudgeSummary(submission)})
+	return nil
+}
+
+func (s *JudgeService) judgeRepoSubmission(ctx context.Context, submission *models.Submission, contest *models.Contest) error {
+	// The job only stores the submission, so the owner's GitHub token is looked up when cloning
+	owner, err := s.UserService.FindUserByID(ctx, submission.OwnerID)
+	if err != nil {
+		return fmt.Errorf("error fetching submission owner: %w", err)
+	}
+
+	if contest.TestFiles == nil {
+		return fmt.Errorf("no test files available for this contest")
+	}
+
+	runResult, err := operations.RunRepoTestCases(ctx, s.Sandbox, submission.Code, contest.Framework(), *contest.TestFiles, owner.GitHubAccessToken)
+	if err != nil {
+		return fmt.Errorf("error running repository tests: %w", err)
+	}
+
+	// The highest usage of the setup and test phases
+	var maxCPUUsage float64
+	var maxMemoryUsage uint64
+	for _, stats := range runResult.Stats {
+		if stats.CPUPercent > maxCPUUsage {
+			maxCPUUsage = stats.CPUPercent
+		}
+		if stats.MemoryUsage > maxMemoryUsage {
+			maxMemoryUsage = stats.MemoryUsage
+		}
+	}
+
+	submission.TestCasesResults = runResult.Results
+	submission.MaxCPUUsage = maxCPUUsage
+	submission.MaxMemoryUsage = int(maxMemoryUsage)
+	submission.Status = runResult.PassedAll
+	submission.Verdict = models.VerdictWrongAnswer
+	if runResult.PassedAll {
+		submission.Verdict = models.VerdictAccepted
+	}
+	submission.Score = float64(runResult.Score)
+	submission.PassedTestCases = runResult.PassedTestCases
+	submission.TotalTestCases = runResult.TotalTestCases
+	return nil
+}
+
+func (s *JudgeService) judgeCodeSubmission(ctx context.Context, submission *models.Submission, contest *models.Contest) error {
+	// Checked on submission too, but the contest may have changed while the submission was queued
+	if !contest.AllowsLanguage(submission.Language) {
+		return permanentJudgeError{fmt.Errorf("language %q is not allowed in this contest", submission.Language)}
+	}
+
+	runResult, err := operations.RunCodeTestCasesWithStats(ctx, s.Sandbox, submission.Language, submission.Code, contest,
+		func(progress operations.TestCaseProgress) {
+			s.Events.Publish(submission.ID, JudgeEvent{Type: JudgeEventTestCase, Data: progress})
+		})
+	if err != nil {
+		return fmt.Errorf("error running test cases: %w", err)
+	}
+	submission.TestCasesResults = runResult.Results
+
+	// Find max CPU and memory usage
+	var maxCPUUsage float64
+	var maxMemoryUsage int64
+
+	for _, result := range runResult.ExecResults {
+		if result.CPUUsage > maxCPUUsage {
+			maxCPUUsage = result.CPUUsage
+		}
+		if result.MemUsage > maxMemoryUsage {
+			maxMemoryUsage = result.MemUsage
+		}
+	}
+
+	submission.MaxCPUUsage = maxCPUUsage
+	submission.MaxMemoryUsage = int(maxMemoryUsage)
+	submission.Status = runResult.PassedAll
+	submission.Verdict = runResult.Verdict
+	submission.Score = float64(runResult.Score)
+	submission.PassedTestCases = runResult.PassedTestCases
+	submission.TotalTestCases = runResult.TotalTestCases
+	return nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"backend/models"
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestIsOrphanedWorker(t *testing.T) {
+	s := &JudgeService{instanceID: "judge-0:boot"}
+
+	// A process that has exited and been reaped
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot start a process: %v", err)
+	}
+	deadPID := cmd.Process.Pid
+
+	tests := []struct {
+		name     string
+		workerID string
+		want     bool
+	}{
+		{"earlier run with this PID", fmt.Sprintf("judge-0:boot:%d:1", os.Getpid()), true},
+		{"running process", fmt.Sprintf("judge-0:boot:%d:1", os.Getppid()), false},
+		{"exited process", fmt.Sprintf("judge-0:boot:%d:2", deadPID), true},
+		{"malformed", "judge-0:boot:worker", false},
+		{"missing worker number", fmt.Sprintf("judge-0:boot:%d", deadPID), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.isOrphanedWorker(tt.workerID); got != tt.want {
+				t.Errorf("isOrphanedWorker(%q) = %v, want %v", tt.workerID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeJudgeTimeout(t *testing.T) {
+	t.Setenv("JUDGE_TEST_PARALLELISM", "4")
+
+	small := &models.Contest{TestCases: []models.TestCase{{TimeLimit: 1000}, {TimeLimit: 1000}}}
+	if got := codeJudgeTimeout(small, "C++"); got <= codeJudgeSlack || got >= maxCodeJudgeTimeout {
+		t.Errorf("codeJudgeTimeout() of two short test cases = %v, want more than the slack and less than the cap", got)
+	}
+
+	huge := &models.Contest{}
+	for i := 0; i < 1000; i++ {
+		huge.TestCases = append(huge.TestCases, models.TestCase{TimeLimit: 10000})
+	}
+	if got := codeJudgeTimeout(huge, "Python"); got != maxCodeJudgeTimeout {
+		t.Errorf("codeJudgeTimeout() of 1000 slow test cases = %v, want the cap %v", got, maxCodeJudgeTimeout)
+	}
+	if judgeLeaseDuration <= maxCodeJudgeTimeout || judgeLeaseDuration <= repoJudgeTimeout {
+		t.Errorf("judgeLeaseDuration %v doesn't outlive the judge timeouts", judgeLeaseDuration)
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"backend/models"
+	"sync"
+)
+
+const (
+	JudgeEventStatus   = "status"   // The submission moved to another judging status
+	JudgeEventTestCase = "testcase" // A public test case finished
+	JudgeEventSummary  = "summary"  // Judging is over, no more events follow
+)
+
+// subscriberBufferSize is large enough to hold every event of a typical submission
+const subscriberBufferSize = 256
+
+// JudgeEvent is a single progress update for a submission
+type JudgeEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// JudgeStatusUpdate is the payload of a status event
+type JudgeStatusUpdate struct {
+	JudgeStatus models.SubmissionStatus `json:"judgeStatus"`
+	JudgeError  string                  `json:"judgeError,omitempty"`
+}
+
+// JudgeSummary is the payload of the final summary event
+type JudgeSummary struct {
+	SubmissionID    string                  `json:"submissionId"`
+	JudgeStatus     models.SubmissionStatus `json:"judgeStatus"`
+	JudgeError      string                  `json:"judgeError,omitempty"`
+	Status          bool                    `json:"status"`
+	Verdict         models.Verdict          `json:"verdict,omitempty"`
+	Score           float64                 `json:"score"`
+	PassedTestCases int                     `json:"passedTestCases"`
+	TotalTestCases  int                     `json:"totalTestCases"`
+}
+
+func NewJudgeSummary(submission *models.Submission) JudgeSummary {
+	return JudgeSummary{
+		SubmissionID:    submission.ID,
+		JudgeStatus:     submission.JudgeStatus,
+		JudgeError:      submission.JudgeError,
+		Status:          submission.Status,
+		Verdict:         submission.Verdict,
+		Score:           submission.Score,
+		PassedTestCases: submission.PassedTestCases,
+		TotalTestCases:  submission.TotalTestCases,
+	}
+}
+
+type judgeStream struct {
+	history     []JudgeEvent
+	subscribers map[chan JudgeEvent]struct{}
+}
+
+// JudgeEventBroker fans out progress events of submissions that are being judged in this process.
+// Events are kept until the summary is published so that late subscribers can catch up.
+type JudgeEventBroker struct {
+	mu      sync.Mutex
+	streams map[string]*judgeStream
+}
+
+func NewJudgeEventBroker() *JudgeEventBroker {
+	return &JudgeEventBroker{
+		streams: make(map[string]*judgeStream),
+	}
+}
+
+func (b *JudgeEventBroker) stream(submissionID string) *judgeStream {
+	stream, ok := b.streams[submissionID]
+	if !ok {
+		stream = &judgeStream{subscribers: make(map[chan JudgeEvent]struct{})}
+		b.streams[submissionID] = stream
+	}
+	return stream
+}
+
+// Publish sends an event to all subscribers of the submission.
+// A summary event ends the stream and closes the subscriber channels.
+func (b *JudgeEventBroker) Publish(submissionID string, event JudgeEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream := b.stream(submissionID)
+	stream.history = append(stream.history, event)
+
+	for ch := range stream.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Slow subscriber, drop the event rather than block judging
+		}
+	}
+
+	if event.Type == JudgeEventSummary {
+		for ch := range stream.subscribers {
+			close(ch)
+		}
+		delete(b.streams, submissionID)
+	}
+}
+
+// Subscribe returns the events published so far and a channel with the ones that follow.
+// The channel is closed after the summary event; call cancel to stop listening earlier.
+func (b *JudgeEventBroker) Subscribe(submissionID string) ([]JudgeEvent, <-chan JudgeEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream := b.stream(submissionID)
+	history := append([]JudgeEvent(nil), stream.history...)
+	ch := make(chan JudgeEvent, subscriberBufferSize)
+	stream.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		current, ok := b.streams[submissionID]
+		if !ok || current != stream {
+			return // Already closed by the summary event
+		}
+		if _, ok := current.subscribers[ch]; ok {
+			delete(current.subscribers, ch)
+			close(ch)
+		}
+		// Nothing is being judged for this submission, don't keep an empty stream around
+		if len(current.subscribers) == 0 && len(current.history) == 0 {
+			delete(b.streams, submissionID)
+		}
+	}
+
+	return history, ch, cancel
+}
+
+// Close ends the stream of a submission that reached a final state without a summary being published here,
+// e.g. because another instance judged it, and drops its history
+func (b *JudgeEventBroker) Close(submissionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream, ok := b.streams[submissionID]
+	if !ok {
+		return
+	}
+	for ch := range stream.subscribers {
+		close(ch)
+	}
+	delete(b.streams, submissionID)
+}
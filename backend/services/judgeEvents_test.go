@@ -0,0 +1,44 @@
+package services
+
+import (
+	"backend/models"
+	"testing"
+)
+
+func TestJudgeEventBrokerPrunesFinishedStreams(t *testing.T) {
+	tests := []struct {
+		name   string
+		finish func(b *JudgeEventBroker, submissionID string)
+	}{
+		{"summary", func(b *JudgeEventBroker, submissionID string) {
+			b.Publish(submissionID, JudgeEvent{Type: JudgeEventSummary, Data: JudgeSummary{SubmissionID: submissionID}})
+		}},
+		{"close", func(b *JudgeEventBroker, submissionID string) {
+			b.Close(submissionID)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewJudgeEventBroker()
+			b.Publish("s1", JudgeEvent{Type: JudgeEventStatus, Data: JudgeStatusUpdate{JudgeStatus: models.SubmissionStatusRunning}})
+			_, events, cancel := b.Subscribe("s1")
+			defer cancel()
+
+			tt.finish(b, "s1")
+
+			for range events {
+				// Drained until the channel is closed
+			}
+			if len(b.streams) != 0 {
+				t.Fatalf("streams = %d, want the finished stream to be dropped", len(b.streams))
+			}
+
+			history, _, cancel := b.Subscribe("s1")
+			defer cancel()
+			if len(history) != 0 {
+				t.Fatalf("history = %v, want none after the stream finished", history)
+			}
+		})
+	}
+}
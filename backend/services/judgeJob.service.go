@@ -0,0 +1,205 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// judgeInterruptedError is stored on submissions whose job kept losing its lease
+const judgeInterruptedError = "judging was interrupted too many times"
+
+type JudgeJobService struct {
+	DB *gorm.DB
+}
+
+func NewJudgeJobService(db *gorm.DB) *JudgeJobService {
+	return &JudgeJobService{
+		DB: db,
+	}
+}
+
+// EnqueueSubmission stores a queued submission together with its judge job in one transaction
+func (s *JudgeJobService) EnqueueSubmission(ctx context.Context, submission *models.Submission, maxAttempts int) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(submission).Error; err != nil {
+			return err
+		}
+
+		job := models.JudgeJob{
+			SubmissionID: submission.ID,
+			Status:       models.JudgeJobStatusPending,
+			MaxAttempts:  maxAttempts,
+			AvailableAt:  time.Now(),
+		}
+		return tx.Create(&job).Error
+	})
+}
+
+// LeaseNextJob claims the oldest available job for the given worker.
+// Pending jobs and jobs whose lease has expired are both eligible. Rows locked by
+// other workers are skipped, so several workers (or backend instances) can poll concurrently.
+// Returns nil when there is nothing to do.
+func (s *JudgeJobService) LeaseNextJob(ctx context.Context, workerID string, leaseDuration time.Duration) (*models.JudgeJob, error) {
+	var leased *models.JudgeJob
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var job models.JudgeJob
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("(status = ? AND available_at <= ?) OR (status = ? AND lease_expires_at < ? AND attempts < max_attempts)",
+				models.JudgeJobStatusPending, now, models.JudgeJobStatusLeased, now).
+			Order("available_at").
+			Limit(1).
+			Find(&job)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		expiresAt := now.Add(leaseDuration)
+		job.Status = models.JudgeJobStatusLeased
+		job.LeasedBy = workerID
+		job.LeaseExpiresAt = &expiresAt
+		job.Attempts++
+
+		if err := tx.Model(&job).Updates(map[string]interface{}{
+			"status":           job.Status,
+			"leased_by":        job.LeasedBy,
+			"lease_expires_at": job.LeaseExpiresAt,
+			"attempts":         job.Attempts,
+		}).Error; err != nil {
+			return err
+		}
+
+		leased = &job
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return leased, nil
+}
+
+// CompleteJob marks a job as done, provided the worker still holds its lease
+func (s *JudgeJobService) CompleteJob(ctx context.Context, job *models.JudgeJob) error {
+	return s.DB.WithContext(ctx).Model(&models.JudgeJob{}).
+		Where("id = ? AND leased_by = ?", job.ID, job.LeasedBy).
+		Updates(map[string]interface{}{
+			"status":           models.JudgeJobStatusDone,
+			"lease_expires_at": nil,
+			"last_error":       "",
+		}).Error
+}
+
+// FailJob puts a job back in the queue with a back-off, or dead-letters it once it ran out of attempts or the
+// error can't be fixed by retrying. It returns true when the job was dead-lettered.
+func (s *JudgeJobService) FailJob(ctx context.Context, job *models.JudgeJob, jobErr error, backoff time.Duration, retryable bool) (bool, error) {
+	deadLettered := !retryable || job.Attempts >= job.MaxAttempts
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"status":           models.JudgeJobStatusPending,
+			"lease_expires_at": nil,
+			"leased_by":        "",
+			"last_error":       jobErr.Error(),
+			"available_at":     time.Now().Add(backoff),
+		}
+		submissionStatus := models.SubmissionStatusQueued
+		if deadLettered {
+			updates["status"] = models.JudgeJobStatusDead
+			submissionStatus = models.SubmissionStatusFailed
+		}
+
+		if err := tx.Model(&models.JudgeJob{}).
+			Where("id = ? AND leased_by = ?", job.ID, job.LeasedBy).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Submission{}).Where("id = ?", job.SubmissionID).Updates(map[string]interface{}{
+			"judge_status": submissionStatus,
+			"judge_error":  jobErr.Error(),
+		}).Error
+	})
+	return deadLettered, err
+}
+
+// DeadLetterExpiredJobs dead-letters jobs whose lease expired on their last attempt,
+// e.g. because the worker crashed every time it picked them up. It returns the IDs of their submissions.
+func (s *JudgeJobService) DeadLetterExpiredJobs(ctx context.Context) ([]string, error) {
+	var submissionIDs []string
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.JudgeJob{}).
+			Where("status = ? AND lease_expires_at < ? AND attempts >= max_attempts", models.JudgeJobStatusLeased, time.Now()).
+			Pluck("submission_id", &submissionIDs).Error; err != nil {
+			return err
+		}
+		if len(submissionIDs) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&models.JudgeJob{}).
+			Where("submission_id IN ?", submissionIDs).
+			Updates(map[string]interface{}{
+				"status":           models.JudgeJobStatusDead,
+				"lease_expires_at": nil,
+				"last_error":       "lease expired on the final attempt",
+			}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Submission{}).Where("id IN ?", submissionIDs).Updates(map[string]interface{}{
+			"judge_status": models.SubmissionStatusFailed,
+			"judge_error":  judgeInterruptedError,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return submissionIDs, nil
+}
+
+// ExpireOrphanedLeases expires the leases held by a previous run of this backend instance.
+// Leases are tagged with the instance prefix, and only the jobs of workers isOrphaned confirms to be gone are touched.
+// The expired jobs are then picked up again (or dead-lettered) through the normal leasing path.
+func (s *JudgeJobService) ExpireOrphanedLeases(ctx context.Context, instancePrefix string, isOrphaned func(workerID string) bool) (int64, error) {
+	var count int64
+
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var leases []models.JudgeJob
+		if err := tx.Select("submission_id", "leased_by").
+			Where("status = ? AND leased_by LIKE ?", models.JudgeJobStatusLeased, instancePrefix+"%").
+			Find(&leases).Error; err != nil {
+			return err
+		}
+		var submissionIDs []string
+		for _, lease := range leases {
+			if isOrphaned(lease.LeasedBy) {
+				submissionIDs = append(submissionIDs, lease.SubmissionID)
+			}
+		}
+		if len(submissionIDs) == 0 {
+			return nil
+		}
+
+		result := tx.Model(&models.JudgeJob{}).
+			Where("submission_id IN ?", submissionIDs).
+			Update("lease_expires_at", time.Now().Add(-time.Second))
+		if result.Error != nil {
+			return result.Error
+		}
+		count = result.RowsAffected
+
+		return tx.Model(&models.Submission{}).Where("id IN ?", submissionIDs).
+			Update("judge_status", models.SubmissionStatusQueued).Error
+	})
+	return count, err
+}
@@ -1,9 +1,11 @@
 package services
 
 import (
+	"backend/config"
 	"backend/models"
 	"context"
 	"sort"
+	"strings"
 
 	"gorm.io/gorm"
 )
@@ -19,13 +21,54 @@ func NewLeaderboardService(db *gorm.DB) *LeaderboardService {
 }
 
 type LeaderboardEntry struct {
-	UserID               string  `json:"userId"`
-	Username             string  `json:"username"`
-	TotalScore           float64 `json:"totalScore"`
-	ContestsParticipated int     `json:"contestsParticipated"`
+	UserID               string             `json:"userId"`
+	Username             string             `json:"username"`
+	TotalScore           float64            `json:"totalScore"`
+	ContestsParticipated int                `json:"contestsParticipated"`
+	ScoreByLanguage      map[string]float64 `json:"scoreByLanguage"`
 }
 
-func (s *LeaderboardService) GetLeaderboard(ctx context.Context) ([]LeaderboardEntry, error) {
+// StandingsEntry is the best submission of a participant in a contest
+type StandingsEntry struct {
+	Rank         int            `json:"rank"`
+	UserID       string         `json:"userId"`
+	Username     string         `json:"username"`
+	BestScore    float64        `json:"bestScore"`
+	Language     string         `json:"language"` // Language of the best submission
+	Verdict      models.Verdict `json:"verdict"`
+	Submissions  int            `json:"submissions"`
+	SubmissionID string         `json:"submissionId"`
+}
+
+// LanguageStats summarizes the submissions to a contest in one language
+type LanguageStats struct {
+	Language     string  `json:"language"`
+	Submissions  int     `json:"submissions"`
+	Accepted     int     `json:"accepted"`
+	Participants int     `json:"participants"`
+	AverageScore float64 `json:"averageScore"`
+	BestScore    float64 `json:"bestScore"`
+}
+
+// ContestStats summarizes the submissions to a contest, in total and by language
+type ContestStats struct {
+	ContestID    string          `json:"contestId"`
+	Submissions  int             `json:"submissions"`
+	Accepted     int             `json:"accepted"`
+	Participants int             `json:"participants"`
+	Languages    []LanguageStats `json:"languages"`
+}
+
+// languageName returns the registry name of a language so that "python" and "Python" are counted together
+func languageName(language string) string {
+	if lang, ok := config.Languages.Get(language); ok {
+		return lang.Name
+	}
+	return strings.TrimSpace(language)
+}
+
+// GetLeaderboard sums the scores of every user, only over submissions in language if it isn't empty
+func (s *LeaderboardService) GetLeaderboard(ctx context.Context, language string) ([]LeaderboardEntry, error) {
 	// Query all submissions with preloaded users
 	var submissions []models.Submission
 	if err := s.DB.Find(&submissions).Error; err != nil {
@@ -47,8 +90,14 @@ func (s *LeaderboardService) GetLeaderboard(ctx context.Context) ([]LeaderboardE
 	// Calculate scores per user
 	userScores := make(map[string]float64)
 	userContestCounts := make(map[string]map[string]bool)
+	userLanguageScores := make(map[string]map[string]float64)
 
 	for _, submission := range submissions {
+		submissionLanguage := languageName(submission.Language)
+		if language != "" && !strings.EqualFold(submissionLanguage, languageName(language)) {
+			continue
+		}
+
 		// Initialize user contest map if needed
 		if userContestCounts[submission.OwnerID] == nil {
 			userContestCounts[submission.OwnerID] = make(map[string]bool)
@@ -59,6 +108,11 @@ func (s *LeaderboardService) GetLeaderboard(ctx context.Context) ([]LeaderboardE
 
 		// Add to the user's total score
 		userScores[submission.OwnerID] += submission.Score
+
+		if userLanguageScores[submission.OwnerID] == nil {
+			userLanguageScores[submission.OwnerID] = make(map[string]float64)
+		}
+		userLanguageScores[submission.OwnerID][submissionLanguage] += submission.Score
 	}
 
 	// Create leaderboard entries
@@ -69,6 +123,7 @@ func (s *LeaderboardService) GetLeaderboard(ctx context.Context) ([]LeaderboardE
 			Username:             userMap[userID],
 			TotalScore:           totalScore,
 			ContestsParticipated: len(userContestCounts[userID]),
+			ScoreByLanguage:      userLanguageScores[userID],
 		})
 	}
 
@@ -79,3 +134,113 @@ func (s *LeaderboardService) GetLeaderboard(ctx context.Context) ([]LeaderboardE
 
 	return leaderboard, nil
 }
+
+// GetContestStandings ranks the participants of a contest by their best judged submission, only over submissions
+// in language if it isn't empty. Ties go to whoever reached the score first.
+func (s *LeaderboardService) GetContestStandings(ctx context.Context, contestID string, language string) ([]StandingsEntry, error) {
+	var submissions []models.Submission
+	err := s.DB.WithContext(ctx).
+		Select("id", "owner_id", "owner_name", "score", "verdict", "language", "created_at").
+		Where("contest_id = ? AND judge_status = ?", contestID, models.SubmissionStatusJudged).
+		Order("created_at").
+		Find(&submissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	best := make(map[string]*StandingsEntry)
+	var standings []*StandingsEntry
+	for _, submission := range submissions {
+		submissionLanguage := languageName(submission.Language)
+		if language != "" && !strings.EqualFold(submissionLanguage, languageName(language)) {
+			continue
+		}
+
+		entry, ok := best[submission.OwnerID]
+		if !ok {
+			entry = &StandingsEntry{UserID: submission.OwnerID, Username: submission.OwnerName, BestScore: -1}
+			best[submission.OwnerID] = entry
+			standings = append(standings, entry)
+		}
+		entry.Submissions++
+		if submission.Score > entry.BestScore {
+			entry.BestScore = submission.Score
+			entry.Language = submissionLanguage
+			entry.Verdict = submission.Verdict
+			entry.SubmissionID = submission.ID
+		}
+	}
+
+	// Submissions come oldest first and a later one only counts if it scores higher, so the first to reach a score wins ties
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].BestScore > standings[j].BestScore
+	})
+
+	result := make([]StandingsEntry, len(standings))
+	for i, entry := range standings {
+		entry.Rank = i + 1
+		if i > 0 && entry.BestScore == standings[i-1].BestScore {
+			entry.Rank = result[i-1].Rank
+		}
+		result[i] = *entry
+	}
+	return result, nil
+}
+
+// GetContestStats counts the judged submissions of a contest, in total and by language
+func (s *LeaderboardService) GetContestStats(ctx context.Context, contestID string) (*ContestStats, error) {
+	var submissions []models.Submission
+	err := s.DB.WithContext(ctx).
+		Select("owner_id", "score", "verdict", "language").
+		Where("contest_id = ? AND judge_status = ?", contestID, models.SubmissionStatusJudged).
+		Find(&submissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ContestStats{ContestID: contestID, Languages: []LanguageStats{}}
+	participants := make(map[string]bool)
+	byLanguage := make(map[string]*LanguageStats)
+	languageParticipants := make(map[string]map[string]bool)
+	scoreSums := make(map[string]float64)
+
+	for _, submission := range submissions {
+		language := languageName(submission.Language)
+		languageStats, ok := byLanguage[language]
+		if !ok {
+			languageStats = &LanguageStats{Language: language}
+			byLanguage[language] = languageStats
+			languageParticipants[language] = make(map[string]bool)
+		}
+
+		accepted := submission.Verdict == models.VerdictAccepted
+		stats.Submissions++
+		languageStats.Submissions++
+		if accepted {
+			stats.Accepted++
+			languageStats.Accepted++
+		}
+		participants[submission.OwnerID] = true
+		languageParticipants[language][submission.OwnerID] = true
+		scoreSums[language] += submission.Score
+		if submission.Score > languageStats.BestScore {
+			languageStats.BestScore = submission.Score
+		}
+	}
+
+	stats.Participants = len(participants)
+	for language, languageStats := range byLanguage {
+		languageStats.Participants = len(languageParticipants[language])
+		languageStats.AverageScore = scoreSums[language] / float64(languageStats.Submissions)
+		stats.Languages = append(stats.Languages, *languageStats)
+	}
+
+	// Most used languages first
+	sort.Slice(stats.Languages, func(i, j int) bool {
+		if stats.Languages[i].Submissions != stats.Languages[j].Submissions {
+			return stats.Languages[i].Submissions > stats.Languages[j].Submissions
+		}
+		return stats.Languages[i].Language < stats.Languages[j].Language
+	})
+	return stats, nil
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type LLMUsageService struct {
+	DB *gorm.DB
+}
+
+func NewLLMUsageService(db *gorm.DB) *LLMUsageService {
+	return &LLMUsageService{
+		DB: db,
+	}
+}
+
+// RecordUsage stores one model call, see util.SetLLMUsageRecorder
+func (s *LLMUsageService) RecordUsage(usage models.LLMUsage) error {
+	return s.DB.Create(&usage).Error
+}
+
+// GetContestUsage adds up the model calls made for a contest
+func (s *LLMUsageService) GetContestUsage(ctx context.Context, contestID string) (*models.LLMUsageSummary, error) {
+	summary := models.LLMUsageSummary{ContestID: contestID}
+	err := s.DB.WithContext(ctx).Model(&models.LLMUsage{}).
+		Select(`COUNT(*) AS calls,
+			COUNT(*) FILTER (WHERE error <> '') AS failed_calls,
+			COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+			COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+			COALESCE(SUM(cost_usd), 0) AS cost_usd`).
+		Where("contest_id = ?", contestID).
+		Scan(&summary).Error
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// GetContestUsageRecords returns the latest model calls made for a contest, newest first
+func (s *LLMUsageService) GetContestUsageRecords(ctx context.Context, contestID string, limit int) ([]models.LLMUsage, error) {
+	var records []models.LLMUsage
+	err := s.DB.WithContext(ctx).Where("contest_id = ?", contestID).Order("created_at DESC").Limit(limit).Find(&records).Error
+	return records, err
+}
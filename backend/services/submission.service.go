@@ -42,9 +42,14 @@ func (s *SubmissionService) FindSubmissionByID(ctx context.Context, id string) (
 	return &submission, nil
 }
 
-func (s *SubmissionService) GetSubmissionsByContestID(ctx context.Context, contestID string) ([]models.Submission, error) {
+// GetSubmissionsByContestID returns the submissions of a contest, optionally only those with the given overall verdict
+func (s *SubmissionService) GetSubmissionsByContestID(ctx context.Context, contestID string, verdict models.Verdict) ([]models.Submission, error) {
 	var submissions []models.Submission
-	result := s.DB.Preload("TestCasesResults").Where("contest_id = ?", contestID).Find(&submissions)
+	query := s.DB.Preload("TestCasesResults").Where("contest_id = ?", contestID)
+	if verdict != "" {
+		query = query.Where("verdict = ?", verdict)
+	}
+	result := query.Find(&submissions)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -129,3 +134,68 @@ func (s *SubmissionService) GetContestTestFiles(ctx context.Context, contestID s
 	}
 	return *contest.TestFiles, nil
 }
+
+// GetContestLanguages returns the languages submissions to the contest may use
+func (s *SubmissionService) GetContestLanguages(ctx context.Context, contestID string) (models.LanguageList, error) {
+	var contest models.Contest
+	result := s.DB.Select("language", "allowed_languages").First(&contest, "id = ?", contestID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return contest.Languages(), nil
+}
+
+// GetContestForJudging loads a contest with its test cases without any access check.
+// It is only meant for the judge workers, which act on behalf of an already authorized submission.
+func (s *SubmissionService) GetContestForJudging(ctx context.Context, contestID string) (*models.Contest, error) {
+	var contest models.Contest
+	result := s.DB.Preload("TestCases").First(&contest, "id = ?", contestID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("contest not found")
+		}
+		return nil, result.Error
+	}
+	return &contest, nil
+}
+
+// UpdateJudgeStatus moves a submission to the given judging status
+func (s *SubmissionService) UpdateJudgeStatus(ctx context.Context, id string, status models.SubmissionStatus, judgeError string) error {
+	return s.DB.WithContext(ctx).Model(&models.Submission{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"judge_status": status,
+		"judge_error":  judgeError,
+	}).Error
+}
+
+// SaveJudgeResult stores the outcome of judging together with the test case results
+func (s *SubmissionService) SaveJudgeResult(ctx context.Context, submission *models.Submission) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Submission{}).Where("id = ?", submission.ID).Updates(map[string]interface{}{
+			"status":            submission.Status,
+			"verdict":           submission.Verdict,
+			"score":             submission.Score,
+			"total_test_cases":  submission.TotalTestCases,
+			"passed_test_cases": submission.PassedTestCases,
+			"max_cpu_usage":     submission.MaxCPUUsage,
+			"max_memory_usage":  submission.MaxMemoryUsage,
+			"judge_status":      models.SubmissionStatusJudged,
+			"judge_error":       "",
+		}).Error; err != nil {
+			return err
+		}
+
+		// A retried job may have stored results before it was interrupted
+		if err := tx.Where("submission_id = ?", submission.ID).Delete(&models.TestCaseResult{}).Error; err != nil {
+			return err
+		}
+
+		if len(submission.TestCasesResults) == 0 {
+			return nil
+		}
+
+		for i := range submission.TestCasesResults {
+			submission.TestCasesResults[i].SubmissionID = submission.ID
+		}
+		return tx.Create(&submission.TestCasesResults).Error
+	})
+}
@@ -0,0 +1,176 @@
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// cgroupPollInterval controls how often the memory high-water mark of a running container is read
+const cgroupPollInterval = 20 * time.Millisecond
+
+// cgroupRoot returns the mount point of the cgroup hierarchy, overridable with CGROUP_ROOT
+func cgroupRoot() string {
+	if root := os.Getenv("CGROUP_ROOT"); root != "" {
+		return root
+	}
+	return "/sys/fs/cgroup"
+}
+
+// cgroupV2Dirs lists the cgroup v2 directories of a container with the systemd and cgroupfs drivers
+func cgroupV2Dirs(containerID string) []string {
+	root := cgroupRoot()
+	return []string{
+		filepath.Join(root, "system.slice", "docker-"+containerID+".scope"),
+		filepath.Join(root, "docker", containerID),
+	}
+}
+
+// cgroupPeakMemoryFiles lists the files holding the memory high-water mark of a container
+// for the common cgroup v2 / v1 layouts with the systemd and cgroupfs drivers
+func cgroupPeakMemoryFiles(containerID string) []string {
+	root := cgroupRoot()
+	var files []string
+	for _, dir := range cgroupV2Dirs(containerID) {
+		files = append(files, filepath.Join(dir, "memory.peak"))
+	}
+	return append(files,
+		filepath.Join(root, "memory", "system.slice", "docker-"+containerID+".scope", "memory.max_usage_in_bytes"),
+		filepath.Join(root, "memory", "docker", containerID, "memory.max_usage_in_bytes"),
+	)
+}
+
+// readCgroupPeakMemory reads the peak memory usage in bytes that the kernel accounted for the container
+func readCgroupPeakMemory(containerID string) (uint64, bool) {
+	for _, file := range cgroupPeakMemoryFiles(containerID) {
+		if peak, ok := readUintFile(file); ok {
+			return peak, true
+		}
+	}
+	return 0, false
+}
+
+// readCgroupCurrentMemory reads the memory the container uses right now (cgroup v2 only)
+func readCgroupCurrentMemory(containerID string) (uint64, bool) {
+	for _, dir := range cgroupV2Dirs(containerID) {
+		if current, ok := readUintFile(filepath.Join(dir, "memory.current")); ok {
+			return current, true
+		}
+	}
+	return 0, false
+}
+
+// readCgroupOOMKills reads how many processes of the container the kernel killed for exceeding its memory limit (cgroup v2 only)
+func readCgroupOOMKills(containerID string) (uint64, bool) {
+	for _, dir := range cgroupV2Dirs(containerID) {
+		if count, ok := readKeyedFile(filepath.Join(dir, "memory.events"), "oom_kill"); ok {
+			return count, true
+		}
+	}
+	return 0, false
+}
+
+// readCgroupCPUUsage reads the CPU time in microseconds the container has used so far (cgroup v2 only)
+func readCgroupCPUUsage(containerID string) (uint64, bool) {
+	for _, dir := range cgroupV2Dirs(containerID) {
+		if usage, ok := readKeyedFile(filepath.Join(dir, "cpu.stat"), "usage_usec"); ok {
+			return usage, true
+		}
+	}
+	return 0, false
+}
+
+// readUintFile reads a cgroup file holding a single number
+func readUintFile(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// readKeyedFile reads one entry of a cgroup file with "key value" lines such as memory.events
+func readKeyedFile(path string, key string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			value, err := strconv.ParseUint(fields[1], 10, 64)
+			return value, err == nil
+		}
+	}
+	return 0, false
+}
+
+// peakMemoryTracker follows the cgroup memory high-water mark of a container while it runs.
+// The cgroup disappears together with the container process, so the value is read periodically
+// instead of once after exit. Since the kernel counter only grows, the last successful read is the peak.
+type peakMemoryTracker struct {
+	peak atomic.Uint64
+	read func() (uint64, bool)
+}
+
+func trackPeakMemory(ctx context.Context, containerID string) *peakMemoryTracker {
+	return trackMemory(ctx, func() (uint64, bool) { return readCgroupPeakMemory(containerID) })
+}
+
+// trackCurrentMemory samples the current usage instead, for runs that share a container with earlier runs
+// and so can't use its high-water mark. Short spikes between two samples are missed.
+func trackCurrentMemory(ctx context.Context, containerID string) *peakMemoryTracker {
+	return trackMemory(ctx, func() (uint64, bool) { return readCgroupCurrentMemory(containerID) })
+}
+
+// trackOOMKills follows the oom_kill counter of a container, which also only grows and goes away with the cgroup
+func trackOOMKills(ctx context.Context, containerID string) *peakMemoryTracker {
+	return trackMemory(ctx, func() (uint64, bool) { return readCgroupOOMKills(containerID) })
+}
+
+func trackMemory(ctx context.Context, read func() (uint64, bool)) *peakMemoryTracker {
+	tracker := &peakMemoryTracker{read: read}
+
+	go func() {
+		ticker := time.NewTicker(cgroupPollInterval)
+		defer ticker.Stop()
+
+		for {
+			tracker.sample()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return tracker
+}
+
+func (t *peakMemoryTracker) sample() {
+	peak, ok := t.read()
+	if !ok {
+		return
+	}
+	for {
+		current := t.peak.Load()
+		if peak <= current || t.peak.CompareAndSwap(current, peak) {
+			return
+		}
+	}
+}
+
+// Peak takes a last sample and returns the highest memory usage seen, 0 if the cgroup was never readable
+func (t *peakMemoryTracker) Peak() uint64 {
+	t.sample()
+	return t.peak.Load()
+}
@@ -13,4 +13,73 @@ const (
 
 	// Maximum memory limit in MB (512 MB)
 	MAX_MEMORY_LIMIT = 512
+
+	// Time limit for compiling a submission once, in milliseconds (30 seconds)
+	COMPILE_TIME_LIMIT = 30000
+
+	// Memory limit for the compiler in MB (1 GB)
+	COMPILE_MEMORY_LIMIT = 1024
+
+	// Default limit for stdout and stderr of a single run in KB (64 KB), overridable with JUDGE_OUTPUT_LIMIT_KB
+	DEFAULT_OUTPUT_LIMIT = 64
+
+	// Size of the Docker log file kept per container, the output is read from the attached streams anyway
+	CONTAINER_LOG_MAX_SIZE = "1m"
+
+	// Time limit for a custom checker on a single test case, in milliseconds (10 seconds)
+	CHECKER_TIME_LIMIT = 10000
+
+	// Memory limit for a custom checker in MB (256 MB)
+	CHECKER_MEMORY_LIMIT = 256
+
+	// Absolute tolerance of the float checker when the contest doesn't set one
+	DEFAULT_FLOAT_EPSILON = 1e-6
+
+	// Largest time multiplier a contest can set for a language
+	MAX_TIME_MULTIPLIER = 10
+
+	// Largest time limit of a test case after the time multiplier of its language, in milliseconds (30 seconds)
+	MAX_SCALED_TIME_LIMIT = 30000
+
+	// Largest extra memory in MB a contest can give a language (512 MB)
+	MAX_EXTRA_MEMORY = 512
+
+	// Default number of test cases of a submission that run at once, overridable with JUDGE_TEST_PARALLELISM
+	DEFAULT_TEST_PARALLELISM = 4
+
+	// Number of entry points of submitted code that are remembered, keyed by the hash of the code
+	ENTRY_POINT_CACHE_SIZE = 1024
+
+	// Default time limit for a single request to the language model in milliseconds (30 seconds), overridable with LLM_TIMEOUT_MS
+	DEFAULT_LLM_TIMEOUT = 30000
+
+	// Default number of times a failed request to the language model is retried, overridable with LLM_MAX_RETRIES
+	DEFAULT_LLM_MAX_RETRIES = 2
+
+	// Purpose of the model calls that identify the entry point of a submission, see LLMUsage
+	LLM_PURPOSE_ENTRY_POINT = "entry_point"
+
+	// Number of the latest model calls returned with the model usage of a contest
+	LLM_USAGE_RECORDS_LIMIT = 100
+
+	// Delay before the first retry of a request to the language model in milliseconds, doubled for every further retry
+	LLM_RETRY_BACKOFF = 500
+
+	// Time limit for cloning a repository submission, in milliseconds (2 minutes)
+	REPO_CLONE_TIME_LIMIT = 120000
+
+	// Time limit for installing the dependencies of a repository submission, in milliseconds (5 minutes)
+	REPO_SETUP_TIME_LIMIT = 300000
+
+	// Time limit for running the tests of a contest against a repository submission, in milliseconds (2 minutes)
+	REPO_TEST_TIME_LIMIT = 120000
+
+	// Memory limit for the setup and tests of a repository submission in MB (1 GB)
+	REPO_MEMORY_LIMIT = 1024
+
+	// Key of the sandbox policy for the setup and tests of repository submissions, see SandboxPolicyFor
+	REPO_SANDBOX_POLICY = "repo"
+
+	// Default size limit of the dependency cache of repository submissions in MB (2 GB), overridable with JUDGE_DEPENDENCY_CACHE_MB
+	DEFAULT_DEPENDENCY_CACHE_SIZE = 2048
 )
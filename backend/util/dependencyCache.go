@@ -0,0 +1,326 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DependencyCache keeps the installed dependencies of repository submissions on disk, keyed by the hash of their
+// lockfiles, so that submissions with the same dependencies skip installing them. Entries are evicted least recently
+// used first once the cache grows over its size limit; entries in use are never evicted.
+type DependencyCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*dependencyCacheEntry
+	size    int64
+}
+
+type dependencyCacheEntry struct {
+	size     int64
+	lastUsed time.Time
+	users    int
+}
+
+// DependencyCacheStats describes the contents of the cache
+type DependencyCacheStats struct {
+	Dir       string `json:"dir"`
+	Entries   int    `json:"entries"`
+	SizeBytes int64  `json:"sizeBytes"`
+	MaxBytes  int64  `json:"maxBytes"`
+	InUse     int    `json:"inUse"`
+}
+
+// NewDependencyCache opens the cache in dir, creating it if needed, and indexes the entries already there
+func NewDependencyCache(dir string, maxBytes int64) (*DependencyCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dependency cache: %w", err)
+	}
+	cache := &DependencyCache{dir: dir, maxBytes: maxBytes, entries: make(map[string]*dependencyCacheEntry)}
+
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dependency cache: %w", err)
+	}
+	for _, item := range items {
+		path := filepath.Join(dir, item.Name())
+		// Leftovers of entries that were being stored when the judge stopped
+		if strings.HasPrefix(item.Name(), ".") {
+			os.RemoveAll(path)
+			continue
+		}
+		info, err := item.Info()
+		if err != nil || !item.IsDir() {
+			continue
+		}
+		size, err := directorySize(path)
+		if err != nil {
+			continue
+		}
+		cache.entries[item.Name()] = &dependencyCacheEntry{size: size, lastUsed: info.ModTime()}
+		cache.size += size
+	}
+	cache.mu.Lock()
+	cache.evict()
+	cache.mu.Unlock()
+	return cache, nil
+}
+
+var (
+	dependencyCache     *DependencyCache
+	dependencyCacheOnce sync.Once
+)
+
+// GetDependencyCache returns the cache configured by JUDGE_DEPENDENCY_CACHE_DIR and JUDGE_DEPENDENCY_CACHE_MB,
+// or nil if it is disabled with a size of 0 or can't be opened
+func GetDependencyCache() *DependencyCache {
+	dependencyCacheOnce.Do(func() {
+		maxMB := DEFAULT_DEPENDENCY_CACHE_SIZE
+		if value := os.Getenv("JUDGE_DEPENDENCY_CACHE_MB"); value != "" {
+			if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+				maxMB = parsed
+			} else {
+				log.Printf("Ignoring invalid JUDGE_DEPENDENCY_CACHE_MB: %s", value)
+			}
+		}
+		if maxMB == 0 {
+			return
+		}
+
+		dir := os.Getenv("JUDGE_DEPENDENCY_CACHE_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "contestify-dependency-cache")
+		}
+		cache, err := NewDependencyCache(dir, int64(maxMB)*1024*1024)
+		if err != nil {
+			log.Printf("Dependency cache disabled: %v", err)
+			return
+		}
+		dependencyCache = cache
+	})
+	return dependencyCache
+}
+
+// Acquire returns the directory of the entry for the key. The entry is kept until release is called.
+func (c *DependencyCache) Acquire(key string) (string, func(), bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", nil, false
+	}
+	entry.users++
+	entry.lastUsed = time.Now()
+	path := filepath.Join(c.dir, key)
+	// The modification time orders the entries again after a restart
+	os.Chtimes(path, entry.lastUsed, entry.lastUsed)
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			entry.users--
+			c.evict()
+		})
+	}
+	return path, release, true
+}
+
+// Store copies the directory into the entry for the key, under its own name. Entries larger than the whole cache
+// are not stored.
+func (c *DependencyCache) Store(key string, source string) error {
+	c.mu.Lock()
+	_, exists := c.entries[key]
+	c.mu.Unlock()
+	if exists {
+		return nil
+	}
+
+	// Copied next to the entries first, so that an entry is never seen half written
+	staging, err := os.MkdirTemp(c.dir, ".store-")
+	if err != nil {
+		return fmt.Errorf("failed to store dependencies: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	if err := os.Chmod(staging, 0755); err != nil {
+		return fmt.Errorf("failed to store dependencies: %w", err)
+	}
+
+	size, err := copyTree(source, filepath.Join(staging, filepath.Base(source)), c.maxBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store dependencies: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; exists {
+		return nil // Stored by another submission in the meantime
+	}
+	if err := os.Rename(staging, filepath.Join(c.dir, key)); err != nil {
+		return fmt.Errorf("failed to store dependencies: %w", err)
+	}
+	c.entries[key] = &dependencyCacheEntry{size: size, lastUsed: time.Now()}
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// Purge removes every entry that is not in use and returns how many entries and bytes were removed
+func (c *DependencyCache) Purge() (int, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	var freed int64
+	for key, entry := range c.entries {
+		if entry.users > 0 {
+			continue
+		}
+		if err := c.remove(key); err != nil {
+			return removed, freed, err
+		}
+		removed++
+		freed += entry.size
+	}
+	return removed, freed, nil
+}
+
+// Stats returns the size and number of entries of the cache
+func (c *DependencyCache) Stats() DependencyCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := DependencyCacheStats{Dir: c.dir, Entries: len(c.entries), SizeBytes: c.size, MaxBytes: c.maxBytes}
+	for _, entry := range c.entries {
+		if entry.users > 0 {
+			stats.InUse++
+		}
+	}
+	return stats
+}
+
+// evict removes the least recently used entries that are not in use until the cache fits its size limit.
+// c.mu must be held.
+func (c *DependencyCache) evict() {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastUsed.Before(c.entries[keys[j]].lastUsed)
+	})
+
+	for _, key := range keys {
+		if c.size <= c.maxBytes {
+			return
+		}
+		if c.entries[key].users > 0 {
+			continue
+		}
+		if err := c.remove(key); err != nil {
+			log.Printf("Failed to evict dependency cache entry %s: %v", key, err)
+		}
+	}
+}
+
+// remove deletes an entry from disk and from the index. c.mu must be held.
+func (c *DependencyCache) remove(key string) error {
+	if err := os.RemoveAll(filepath.Join(c.dir, key)); err != nil {
+		return err
+	}
+	c.size -= c.entries[key].size
+	delete(c.entries, key)
+	return nil
+}
+
+// copyTree copies a directory with its symlinks, readable by every user since the sandbox runs as nobody.
+// It gives up once more than limit bytes were copied.
+func copyTree(source string, target string, limit int64) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		destination := filepath.Join(target, relative)
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, destination)
+		case entry.IsDir():
+			return os.MkdirAll(destination, 0755)
+		case !entry.Type().IsRegular():
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if size += info.Size(); size > limit {
+			return fmt.Errorf("dependencies are larger than the cache")
+		}
+		return copyFile(path, destination, info.Mode().Perm()|0444)
+	})
+	return size, err
+}
+
+func copyFile(source string, target string, mode fs.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// directorySize returns the total size of the regular files under dir
+func directorySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
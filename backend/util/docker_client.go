@@ -1,14 +1,18 @@
 package util
 
 import (
+	"backend/config"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,10 +23,12 @@ import (
 	"github.com/docker/docker/pkg/stdcopy"
 )
 
+var _ Sandbox = (*DockerClient)(nil)
+
 // DockerClient provides methods for interacting with Docker containers
 type DockerClient struct {
 	client *client.Client
-	pool   chan struct{}
+	pool   *slotPool
 }
 
 // NewDockerClient creates a new Docker client with connection pooling
@@ -32,15 +38,9 @@ func NewDockerClient(maxContainers int) (*DockerClient, error) {
 		return nil, fmt.Errorf("failed to create Docker client: %w", err)
 	}
 
-	// Create a semaphore to limit concurrent container executions
-	pool := make(chan struct{}, maxContainers)
-	for i := 0; i < maxContainers; i++ {
-		pool <- struct{}{}
-	}
-
 	return &DockerClient{
 		client: cli,
-		pool:   pool,
+		pool:   newSlotPool(maxContainers), // Limits concurrent container executions
 	}, nil
 }
 
@@ -55,48 +55,90 @@ type StatsResult struct {
 	MemoryUsage   uint64  `json:"memory_usage"`
 	MemoryPercent float64 `json:"memory_percent"`
 	Duration      int64   `json:"duration_ms"`
+	ExitCode      int     `json:"exit_code"`
+	OOMKilled     bool    `json:"oom_killed"`
 }
 
-// ExecuteContainer runs code in a Docker container with resource monitoring
-func (d *DockerClient) ExecuteContainer(ctx context.Context, image, codeFile, inputString string, timeoutMs int, memoryLimitMB int) (string, *StatsResult, error) {
-	// Acquire a token from the pool
-	select {
-	case <-d.pool:
-		// Got a token, proceed
-		defer func() {
-			// Return the token when done
-			d.pool <- struct{}{}
-		}()
-	case <-ctx.Done():
-		// Context cancelled before we could acquire a token
-		return "", nil, ctx.Err()
+// ContainerWorkDir is where the solution workspace is mounted inside the container
+const ContainerWorkDir = "/app"
+
+// containerEnv keeps toolchains from writing outside the workspace and /tmp
+var containerEnv = []string{
+	"HOME=/tmp",
+	"DOTNET_CLI_HOME=/tmp",
+	"DOTNET_NOLOGO=1",
+	"DOTNET_SKIP_FIRST_TIME_EXPERIENCE=1",
+	"DOTNET_CLI_TELEMETRY_OPTOUT=1",
+}
+
+// Prepare pulls the image if it is not available locally
+func (d *DockerClient) Prepare(ctx context.Context, image string, sourceFile string) error {
+	if _, _, err := d.client.ImageInspectWithRaw(ctx, image); err == nil {
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to inspect image %s: %w", image, err)
 	}
+	return pullImage(image)
+}
 
-	// Prepare absolute path for volume mount
-	absPath, err := filepath.Abs(codeFile)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to get absolute path: %w", err)
+// WorkspacePath returns where a file of the workspace is mounted inside the container
+func (d *DockerClient) WorkspacePath(workDir string, name string) string {
+	return filepath.Join(ContainerWorkDir, name)
+}
+
+// pullImage pulls an image using the docker command line
+func pullImage(image string) error {
+	log.Printf("Image %s not found, attempting to pull...", image)
+
+	cmd := exec.Command("docker", "pull", image)
+	var outBuf bytes.Buffer
+	var errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	if err := cmd.Run(); err != nil {
+		log.Printf("Docker pull output: %s", outBuf.String())
+		log.Printf("Docker pull error: %s", errBuf.String())
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
 	}
 
-	// Create a container configuration depending on the file type
-	extension := filepath.Ext(codeFile)
-	filename := filepath.Base(codeFile)
-	containerPath := "/app/" + filename
+	log.Printf("Successfully pulled image %s", image)
+	return nil
+}
 
-	// For Java files, always use Main.java as the container path
-	if extension == ".java" {
-		containerPath = "/app/Main.java"
+// createContainer creates a container, pulling the image first if it is not available locally
+func (d *DockerClient) createContainer(ctx context.Context, image string, config *container.Config, hostConfig *container.HostConfig) (string, error) {
+	resp, err := d.client.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err == nil {
+		return resp.ID, nil
 	}
 
-	// Create a container configuration
-	config := &container.Config{
-		Image: image,
-		Cmd:   getContainerCommand(extension, containerPath, inputString),
-		Tty:   false,
+	// Check if the error is because the image doesn't exist
+	if !strings.Contains(err.Error(), "No such image") {
+		return "", fmt.Errorf("failed to create container: %w", err)
 	}
 
-	// Host configuration with resource limits
-	hostConfig := &container.HostConfig{
+	if err := pullImage(image); err != nil {
+		return "", err
+	}
+
+	// Try to create the container again
+	resp, err = d.client.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create container after pulling image: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// workspaceHostConfig returns the resource limits and the workspace mount shared by compile and run containers
+func workspaceHostConfig(workDir string, memoryLimitMB int, readOnly bool) (*container.HostConfig, error) {
+	// Prepare absolute path for volume mount
+	absPath, err := filepath.Abs(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	return &container.HostConfig{
 		Resources: container.Resources{
 			Memory:     int64(memoryLimitMB) * 1024 * 1024, // Convert MB to bytes
 			MemorySwap: -1,                                 // Disable swap
@@ -105,58 +147,224 @@ func (d *DockerClient) ExecuteContainer(ctx context.Context, image, codeFile, in
 		},
 		Mounts: []mount.Mount{
 			{
-				Type:   mount.TypeBind,
-				Source: absPath,
-				Target: containerPath,
+				Type:     mount.TypeBind,
+				Source:   absPath,
+				Target:   ContainerWorkDir,
+				ReadOnly: readOnly,
 			},
 		},
 		NetworkMode: "none", // Disable network
+		// Unbounded logs of a program flooding stdout would fill the Docker host's disk
+		LogConfig: container.LogConfig{
+			Type:   "json-file",
+			Config: map[string]string{"max-size": CONTAINER_LOG_MAX_SIZE, "max-file": "1"},
+		},
+	}, nil
+}
+
+// Compile compiles the source file in workDir once in a container, see Sandbox
+func (d *DockerClient) Compile(ctx context.Context, image, workDir, sourceFile string, flags []string, timeoutMs int, memoryLimitMB int) (string, bool, error) {
+	cmd := getCompileCommand(filepath.Ext(sourceFile), ContainerWorkDir, sourceFile, flags)
+	if cmd == nil {
+		return "", true, nil // Interpreted language, nothing to compile
 	}
 
-	// Create the container
-	resp, err := d.client.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err := d.pool.acquire(ctx); err != nil {
+		return "", false, err
+	}
+	defer d.pool.release()
+
+	config := &container.Config{
+		Image:      image,
+		Cmd:        cmd,
+		Env:        containerEnv,
+		WorkingDir: ContainerWorkDir,
+		Tty:        false,
+	}
+
+	// The compiler writes its output into the workspace
+	hostConfig, err := workspaceHostConfig(workDir, memoryLimitMB, false)
 	if err != nil {
-		// Check if the error is because the image doesn't exist
-		if strings.Contains(err.Error(), "No such image") {
-			log.Printf("Image %s not found, attempting to pull...", image)
-
-			// Pull the image using docker command line
-			cmd := exec.Command("docker", "pull", image)
-			var outBuf bytes.Buffer
-			var errBuf bytes.Buffer
-			cmd.Stdout = &outBuf
-			cmd.Stderr = &errBuf
-
-			pullErr := cmd.Run()
-			if pullErr != nil {
-				log.Printf("Docker pull output: %s", outBuf.String())
-				log.Printf("Docker pull error: %s", errBuf.String())
-				return "", nil, fmt.Errorf("failed to pull image %s: %w", image, pullErr)
-			}
+		return "", false, err
+	}
+	SandboxPolicyFor(filepath.Ext(sourceFile)).apply(config, hostConfig)
 
-			log.Printf("Successfully pulled image %s", image)
+	containerID, err := d.createContainer(ctx, image, config, hostConfig)
+	if err != nil {
+		return "", false, err
+	}
+	defer cleanupContainer(d.client, containerID)
 
-			// Try to create the container again
-			resp, err = d.client.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
-			if err != nil {
-				return "", nil, fmt.Errorf("failed to create container after pulling image: %w", err)
-			}
-		} else {
-			return "", nil, fmt.Errorf("failed to create container: %w", err)
+	if err := d.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		return "", false, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	compileCtx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+
+	statusCh, errCh := d.client.ContainerWait(compileCtx, containerID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if ctx.Err() == nil && compileCtx.Err() != nil {
+			return fmt.Sprintf("Compilation timed out after %d ms", timeoutMs), false, nil
+		}
+		return "", false, fmt.Errorf("container wait failed: %w", err)
+
+	case <-compileCtx.Done():
+		if ctx.Err() != nil {
+			return "", false, ctx.Err()
+		}
+		return fmt.Sprintf("Compilation timed out after %d ms", timeoutMs), false, nil
+
+	case status := <-statusCh:
+		logs, err := getContainerLogs(ctx, d.client, containerID, OutputLimitBytes())
+		if err != nil {
+			return "", false, fmt.Errorf("failed to get container logs: %w", err)
 		}
+		// Compilers disagree on which stream they report errors to
+		return logs.Stdout + logs.Stderr, status.StatusCode == 0, nil
+	}
+}
+
+// createRunContainer creates a container that runs the workspace, with stdin open so that it can be attached to
+func (d *DockerClient) createRunContainer(ctx context.Context, image, workDir, sourceFile string, memoryLimitMB int, args []string) (string, error) {
+	config := &container.Config{
+		Image:       image,
+		Cmd:         append(getContainerCommand(filepath.Ext(sourceFile), ContainerWorkDir, sourceFile), args...),
+		Env:         containerEnv,
+		WorkingDir:  ContainerWorkDir,
+		Tty:         false,
+		AttachStdin: true,
+		OpenStdin:   true,
+		StdinOnce:   true, // Close stdin once the attached writer is done
+	}
+
+	// Host configuration with resource limits
+	hostConfig, err := workspaceHostConfig(workDir, memoryLimitMB, true)
+	if err != nil {
+		return "", err
 	}
+	SandboxPolicyFor(filepath.Ext(sourceFile)).apply(config, hostConfig)
 
-	containerID := resp.ID
+	return d.createContainer(ctx, image, config, hostConfig)
+}
+
+// Run runs a prepared (and, if needed, compiled) workspace in a Docker container with resource monitoring.
+// workDir is mounted read-only; sourceFile is the name of the solution file inside it. args are passed to the program.
+func (d *DockerClient) Run(ctx context.Context, image, workDir, sourceFile, inputString string, timeoutMs int, memoryLimitMB int, args ...string) (ContainerOutput, *StatsResult, error) {
+	// Acquire a token from the pool
+	if err := d.pool.acquire(ctx); err != nil {
+		// Context cancelled before we could acquire a token
+		return ContainerOutput{}, nil, err
+	}
+	defer d.pool.release()
+
+	// Create the container
+	containerID, err := d.createRunContainer(ctx, image, workDir, sourceFile, memoryLimitMB, args)
+	if err != nil {
+		return ContainerOutput{}, nil, err
+	}
 	defer cleanupContainer(d.client, containerID)
 
+	// Attach to stdin before starting, so that no input is lost
+	stdin, err := d.client.ContainerAttach(ctx, containerID, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+	})
+	if err != nil {
+		return ContainerOutput{}, nil, fmt.Errorf("failed to attach to container: %w", err)
+	}
+	defer stdin.Close()
+
 	// Start timer for execution duration
 	startTime := time.Now()
 
 	// Start the container
 	if err := d.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
-		return "", nil, fmt.Errorf("failed to start container: %w", err)
+		return ContainerOutput{}, nil, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	// Write the input in the background, the program may exit without reading all of it
+	go writeStdin(stdin, inputString)
+
+	stats, exited, runErr := d.waitForContainer(ctx, containerID, startTime, timeoutMs, memoryLimitMB)
+	if !exited {
+		return ContainerOutput{}, stats, runErr
+	}
+
+	// Read container logs
+	out, err := getContainerLogs(ctx, d.client, containerID, OutputLimitBytes())
+	if err != nil {
+		return ContainerOutput{}, stats, fmt.Errorf("failed to get container logs: %w", err)
+	}
+
+	return out, stats, runErr
+}
+
+// RunCommand runs a command in a container with the workspace mounted writable, see Sandbox.
+// The container has no network unless the run asks for it.
+func (d *DockerClient) RunCommand(ctx context.Context, run CommandRun) (ContainerOutput, *StatsResult, error) {
+	if err := d.pool.acquire(ctx); err != nil {
+		return ContainerOutput{}, nil, err
+	}
+	defer d.pool.release()
+
+	config := &container.Config{
+		Image:      run.Image,
+		Cmd:        run.Command,
+		Env:        containerEnv,
+		WorkingDir: ContainerWorkDir,
+		Tty:        false,
+	}
+
+	hostConfig, err := workspaceHostConfig(run.WorkDir, run.MemoryLimitMB, false)
+	if err != nil {
+		return ContainerOutput{}, nil, err
+	}
+	SandboxPolicyFor(run.Policy).apply(config, hostConfig)
+	if run.Network {
+		hostConfig.NetworkMode = "bridge"
+	}
+	for _, extra := range run.Mounts {
+		source, err := filepath.Abs(extra.Source)
+		if err != nil {
+			return ContainerOutput{}, nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   source,
+			Target:   path.Join(ContainerWorkDir, filepath.ToSlash(extra.Target)),
+			ReadOnly: true,
+		})
+	}
+
+	containerID, err := d.createContainer(ctx, run.Image, config, hostConfig)
+	if err != nil {
+		return ContainerOutput{}, nil, err
+	}
+	defer cleanupContainer(d.client, containerID)
+
+	startTime := time.Now()
+	if err := d.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		return ContainerOutput{}, nil, fmt.Errorf("failed to start container: %w", err)
 	}
 
+	stats, exited, runErr := d.waitForContainer(ctx, containerID, startTime, run.TimeoutMs, run.MemoryLimitMB)
+	if !exited {
+		return ContainerOutput{}, stats, runErr
+	}
+
+	out, err := getContainerLogs(ctx, d.client, containerID, OutputLimitBytes())
+	if err != nil {
+		return ContainerOutput{}, stats, fmt.Errorf("failed to get container logs: %w", err)
+	}
+	return out, stats, runErr
+}
+
+// waitForContainer waits for a started container to exit within timeoutMs while tracking its resource usage.
+// exited is false if the container was still running when waiting stopped, e.g. on a timeout.
+// A program that was OOM-killed or exited with a non-zero status is reported through the error.
+func (d *DockerClient) waitForContainer(ctx context.Context, containerID string, startTime time.Time, timeoutMs int, memoryLimitMB int) (*StatsResult, bool, error) {
 	// Create a context with timeout
 	execCtx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMs)*time.Millisecond)
 	defer cancel()
@@ -178,10 +386,22 @@ func (d *DockerClient) ExecuteContainer(ctx context.Context, image, codeFile, in
 		collectStats(execCtx, d.client, containerID, statsCh)
 	}()
 
+	// The memory high-water mark comes from cgroup accounting, the stats stream is only a fallback
+	memTracker := trackPeakMemory(execCtx, containerID)
+	oomKills := trackOOMKills(execCtx, containerID)
+
 	// Variables to keep track of max usage
 	var maxMemoryUsage uint64
 	var maxCPUPercent float64
 
+	// peakMemory prefers the kernel's accounting over the sampled stats
+	peakMemory := func() uint64 {
+		if peak := memTracker.Peak(); peak > 0 {
+			return peak
+		}
+		return maxMemoryUsage
+	}
+
 	// Monitor stats while waiting for container to exit
 	statsProcessor := func() {
 		ticker := time.NewTicker(50 * time.Millisecond)
@@ -215,6 +435,10 @@ func (d *DockerClient) ExecuteContainer(ctx context.Context, image, codeFile, in
 				if stats.MemoryStats.Usage > 0 && stats.MemoryStats.Usage > maxMemoryUsage {
 					maxMemoryUsage = stats.MemoryStats.Usage
 				}
+				// cgroup v1 reports the high-water mark directly
+				if stats.MemoryStats.MaxUsage > maxMemoryUsage {
+					maxMemoryUsage = stats.MemoryStats.MaxUsage
+				}
 			case <-ticker.C:
 				// Just a tick to check if we should exit
 			case <-execCtx.Done():
@@ -231,42 +455,78 @@ func (d *DockerClient) ExecuteContainer(ctx context.Context, image, codeFile, in
 	case err := <-errCh:
 		// Container wait failed
 		cancel() // Cancel stats collection
-		return "", &result, fmt.Errorf("container wait failed: %w", err)
+		return &result, false, fmt.Errorf("container wait failed: %w", err)
 
 	case <-execCtx.Done():
 		// Timeout occurred
 		result.Duration = int64(timeoutMs)
 		result.CPUPercent = maxCPUPercent
-		result.MemoryUsage = maxMemoryUsage
+		result.MemoryUsage = peakMemory()
 		result.MemoryPercent = float64(maxMemoryUsage) / float64(memoryLimitMB*1024*1024) * 100.0
-		return "", &result, fmt.Errorf("execution timed out after %d ms", timeoutMs)
+		return &result, false, fmt.Errorf("execution timed out after %d ms", timeoutMs)
 
 	case status := <-statusCh:
 		// Container exited
 		duration := time.Since(startTime).Milliseconds()
 		result.Duration = duration
 
-		// Read container logs
-		out, err := getContainerLogs(ctx, d.client, containerID)
-		if err != nil {
-			result.CPUPercent = maxCPUPercent
-			result.MemoryUsage = maxMemoryUsage
-			result.MemoryPercent = float64(maxMemoryUsage) / float64(memoryLimitMB*1024*1024) * 100.0
-			return "", &result, fmt.Errorf("failed to get container logs: %w", err)
-		}
-
 		// Make sure we use the stats that were collected
 		result.CPUPercent = maxCPUPercent
-		result.MemoryUsage = maxMemoryUsage
-		result.MemoryPercent = float64(maxMemoryUsage) / float64(memoryLimitMB*1024*1024) * 100.0
+		result.MemoryUsage = peakMemory()
+		result.ExitCode = int(status.StatusCode)
+
+		// Check whether the kernel killed the program for exceeding its memory limit
+		result.OOMKilled = oomKills.Peak() > 0 || d.wasOOMKilled(ctx, containerID)
+		memoryLimitBytes := uint64(memoryLimitMB) * 1024 * 1024
+		if result.OOMKilled && result.MemoryUsage < memoryLimitBytes {
+			// The last sample may predate the allocation that hit the limit
+			result.MemoryUsage = memoryLimitBytes
+		}
+		result.MemoryPercent = float64(result.MemoryUsage) / float64(memoryLimitBytes) * 100.0
+
+		if result.OOMKilled {
+			return &result, true, fmt.Errorf("memory limit of %d MB exceeded", memoryLimitMB)
+		}
 
 		// Check exit code
 		if status.StatusCode != 0 {
-			return out, &result, fmt.Errorf("container exited with non-zero status: %d", status.StatusCode)
+			return &result, true, fmt.Errorf("container exited with non-zero status: %d", status.StatusCode)
 		}
 
-		return out, &result, nil
+		return &result, true, nil
+	}
+}
+
+// writeStdin streams the test input to the attached container and closes its stdin
+func writeStdin(stdin types.HijackedResponse, input string) {
+	if _, err := io.Copy(stdin.Conn, strings.NewReader(stdinPayload(input))); err != nil {
+		log.Printf("Failed to write input to container: %v", err)
+	}
+	if err := stdin.CloseWrite(); err != nil {
+		log.Printf("Failed to close container stdin: %v", err)
+	}
+}
+
+// stdinPayload makes the input end with a newline, like input typed in a terminal
+func stdinPayload(input string) string {
+	if input != "" && !strings.HasSuffix(input, "\n") {
+		input += "\n"
 	}
+	return input
+}
+
+// wasOOMKilled inspects an exited container to find out whether it was killed by the OOM killer.
+// Docker only sets the flag when the main process was killed, the cgroup oom_kill counter also covers its children.
+func (d *DockerClient) wasOOMKilled(ctx context.Context, containerID string) bool {
+	inspectCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	info, err := d.client.ContainerInspect(inspectCtx, containerID)
+	if err != nil {
+		log.Printf("Failed to inspect container %s: %v", containerID, err)
+		return false
+	}
+	return info.State != nil && info.State.OOMKilled
 }
 
 // collectStats continuously collects stats from the container
@@ -415,8 +675,42 @@ func calculateCPUPercentUnix(stats *types.StatsJSON) float64 {
 	return cpuPercent
 }
 
-// getContainerLogs retrieves logs from the container
-func getContainerLogs(ctx context.Context, cli *client.Client, containerID string) (string, error) {
+// ContainerOutput holds what a program wrote to stdout and stderr
+type ContainerOutput struct {
+	Stdout    string
+	Stderr    string
+	Truncated bool // One of the streams exceeded the output limit and was cut off
+}
+
+// OutputLimitBytes returns the maximum size kept of each output stream, configurable with JUDGE_OUTPUT_LIMIT_KB
+func OutputLimitBytes() int {
+	limitKB, err := strconv.Atoi(os.Getenv("JUDGE_OUTPUT_LIMIT_KB"))
+	if err != nil || limitKB <= 0 {
+		limitKB = DEFAULT_OUTPUT_LIMIT
+	}
+	return limitKB * 1024
+}
+
+// limitedBuffer keeps the first limit bytes written to it and silently drops the rest
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); len(p) > remaining {
+		b.truncated = true
+		b.buf.Write(p[:max(remaining, 0)])
+	} else {
+		b.buf.Write(p)
+	}
+	// Report everything as written so the rest of the stream is still drained
+	return len(p), nil
+}
+
+// getContainerLogs retrieves stdout and stderr of the container separately, each capped at limit bytes
+func getContainerLogs(ctx context.Context, cli *client.Client, containerID string, limit int) (ContainerOutput, error) {
 	// Use a short timeout for log retrieval
 	logCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
@@ -428,23 +722,23 @@ func getContainerLogs(ctx context.Context, cli *client.Client, containerID strin
 
 	logs, err := cli.ContainerLogs(logCtx, containerID, options)
 	if err != nil {
-		return "", err
+		return ContainerOutput{}, err
 	}
 	defer logs.Close()
 
 	// Docker multiplexes stdout and stderr in the same stream with headers
 	// We need to demultiplex them
-	var stdout, stderr bytes.Buffer
-	_, err = stdcopy.StdCopy(&stdout, &stderr, logs)
-	if err != nil {
-		return "", err
+	stdout := &limitedBuffer{limit: limit}
+	stderr := &limitedBuffer{limit: limit}
+	if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil {
+		return ContainerOutput{}, err
 	}
 
-	// Combine stdout and stderr
-	if stderr.Len() > 0 {
-		return stderr.String(), nil
-	}
-	return stdout.String(), nil
+	return ContainerOutput{
+		Stdout:    stdout.buf.String(),
+		Stderr:    stderr.buf.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}, nil
 }
 
 // cleanupContainer removes a container
@@ -464,35 +758,22 @@ func cleanupContainer(cli *client.Client, containerID string) {
 	}
 }
 
-// getContainerCommand returns the appropriate command for the given file extension
-func getContainerCommand(extension, containerPath, inputString string) []string {
-	switch extension {
-	case ".py":
-		return []string{"python3", containerPath, inputString}
-	case ".js":
-		// Properly escape the input string for JavaScript
-		escapedInput := strings.ReplaceAll(inputString, "'", "\\'")
-		escapedInput = strings.ReplaceAll(escapedInput, "\"", "\\\"")
-
-		// Use a more reliable way to pass input to Node.js
-		return []string{"/bin/sh", "-c", fmt.Sprintf("node %s '%s' 2>&1", containerPath, escapedInput)}
-	case ".java":
-		dir := filepath.Dir(containerPath)
-		// Pipe the input string to stdin using echo
-		return []string{"/bin/sh", "-c", fmt.Sprintf("javac %s && cd %s && echo '%s' | java Main",
-			containerPath, dir, strings.ReplaceAll(inputString, "'", "'\\''"))}
-	case ".cpp":
-		dir := filepath.Dir(containerPath)
-		executable := filepath.Join(dir, "a.out")
-		// Pipe the input string to stdin using echo
-		return []string{"/bin/sh", "-c", fmt.Sprintf("g++ %s -o %s && echo '%s' | %s",
-			containerPath, executable, strings.ReplaceAll(inputString, "'", "'\\''"), executable)}
-	case ".cs":
-		dir := filepath.Dir(containerPath)
-		// Pipe the input string to stdin using echo
-		return []string{"/bin/sh", "-c", fmt.Sprintf("cd %s && dotnet run --project . <<< '%s'",
-			dir, strings.ReplaceAll(inputString, "'", "'\\''"))}
-	default:
-		return []string{"/bin/sh", "-c", fmt.Sprintf("cat %s", containerPath)}
+// getCompileCommand returns the command that compiles the source file once per submission with the given flags,
+// or the default ones, or nil for interpreted languages
+func getCompileCommand(extension, dir, sourceFile string, flags []string) []string {
+	language, ok := config.Languages.ByExtension(extension)
+	if !ok {
+		return nil
+	}
+	return language.CompileArgs(dir, sourceFile, flags)
+}
+
+// getContainerCommand returns the command that runs the (compiled) solution for a single test case.
+// The test input is not part of the command, it is written to stdin.
+func getContainerCommand(extension, dir, sourceFile string) []string {
+	language, ok := config.Languages.ByExtension(extension)
+	if !ok {
+		return []string{"cat", filepath.Join(dir, sourceFile)}
 	}
+	return language.RunArgs(dir, sourceFile)
 }
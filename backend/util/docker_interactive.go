@@ -0,0 +1,116 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ContainerRun describes one of the programs of an interactive run
+type ContainerRun struct {
+	Image         string
+	WorkDir       string // Mounted read-only, like in Run
+	SourceFile    string
+	TimeoutMs     int
+	MemoryLimitMB int
+	Args          []string
+}
+
+// RunResult is what Sandbox.Run returns, for one of the programs of an interactive run
+type RunResult struct {
+	Output ContainerOutput
+	Stats  *StatsResult
+	Err    error
+}
+
+// RunInteractive runs the solution and the interactor in two containers, see Sandbox.
+// Both programs run under their own time and memory limits.
+func (d *DockerClient) RunInteractive(ctx context.Context, solution ContainerRun, interactor ContainerRun) (RunResult, RunResult, error) {
+	if err := d.pool.acquirePair(ctx); err != nil {
+		return RunResult{}, RunResult{}, err
+	}
+	defer d.pool.release()
+	defer d.pool.release()
+
+	runs := []ContainerRun{solution, interactor}
+	containerIDs := make([]string, len(runs))
+	streams := make([]types.HijackedResponse, len(runs))
+
+	for i, run := range runs {
+		containerID, err := d.createRunContainer(ctx, run.Image, run.WorkDir, run.SourceFile, run.MemoryLimitMB, run.Args)
+		if err != nil {
+			return RunResult{}, RunResult{}, err
+		}
+		defer cleanupContainer(d.client, containerID)
+		containerIDs[i] = containerID
+
+		// Attach before starting, so that nothing written by the other side is lost
+		stream, err := d.client.ContainerAttach(ctx, containerID, container.AttachOptions{
+			Stream: true,
+			Stdin:  true,
+			Stdout: true,
+		})
+		if err != nil {
+			return RunResult{}, RunResult{}, fmt.Errorf("failed to attach to container: %w", err)
+		}
+		defer stream.Close()
+		streams[i] = stream
+	}
+
+	go pipeStdout(streams[0], streams[1])
+	go pipeStdout(streams[1], streams[0])
+
+	// The interactor is started first, it usually speaks first
+	startTimes := make([]time.Time, len(runs))
+	for _, i := range []int{1, 0} {
+		startTimes[i] = time.Now()
+		if err := d.client.ContainerStart(ctx, containerIDs[i], container.StartOptions{}); err != nil {
+			return RunResult{}, RunResult{}, fmt.Errorf("failed to start container: %w", err)
+		}
+	}
+
+	results := make([]RunResult, len(runs))
+	var wg sync.WaitGroup
+	for i, run := range runs {
+		wg.Add(1)
+		go func(i int, run ContainerRun) {
+			defer wg.Done()
+
+			stats, exited, runErr := d.waitForContainer(ctx, containerIDs[i], startTimes[i], run.TimeoutMs, run.MemoryLimitMB)
+			results[i] = RunResult{Stats: stats, Err: runErr}
+			if !exited {
+				return
+			}
+
+			// The logs hold a copy of everything that was piped to the other side
+			out, err := getContainerLogs(ctx, d.client, containerIDs[i], OutputLimitBytes())
+			if err != nil {
+				results[i].Err = fmt.Errorf("failed to get container logs: %w", err)
+				return
+			}
+			results[i].Output = out
+		}(i, run)
+	}
+	wg.Wait()
+
+	return results[0], results[1], nil
+}
+
+// pipeStdout copies the stdout of one attached container into the stdin of the other.
+// When the source exits, the stdin of the destination is closed so that it sees EOF.
+func pipeStdout(from types.HijackedResponse, to types.HijackedResponse) {
+	if _, err := stdcopy.StdCopy(to.Conn, io.Discard, from.Reader); err != nil {
+		// The other side is gone, keep draining so that the source never blocks on a full pipe
+		io.Copy(io.Discard, from.Reader)
+	}
+	if err := to.CloseWrite(); err != nil {
+		log.Printf("Failed to close container stdin: %v", err)
+	}
+}
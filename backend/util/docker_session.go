@@ -0,0 +1,258 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+var _ SessionSandbox = (*DockerClient)(nil)
+
+// sessionWorkDir is the working directory of every run in a session
+const sessionWorkDir = "/tmp/run"
+
+// sessionScratchDirs are the writable directories of a session container, the root filesystem is read-only
+const sessionScratchDirs = "/tmp /dev/shm"
+
+// sessionRunScript starts every run of a session from a clean state: processes left behind by the previous run are
+// killed (kill -1 spares PID 1, the container's sleep), every file they left in the writable directories is removed,
+// and the program starts in an empty working directory, which also serves as HOME.
+const sessionRunScript = `kill -9 -1 2>/dev/null; for dir in ` + sessionScratchDirs + `; do rm -rf "$dir"/* "$dir"/.[!.]* "$dir"/..?*; done 2>/dev/null; ` +
+	`mkdir ` + sessionWorkDir + ` && cd ` + sessionWorkDir + ` && export HOME=` + sessionWorkDir + ` && exec "$@"`
+
+// dockerSession keeps one idle container per submission and runs every test case in it with docker exec,
+// which avoids creating, starting and removing a container per test case
+type dockerSession struct {
+	d             *DockerClient
+	image         string
+	workDir       string
+	sourceFile    string
+	containerID   string // Empty after the container was killed, the next run starts a new one
+	memoryLimitMB int    // Current memory limit of the container
+}
+
+// StartSession starts an idle container for the compiled workspace, see SessionSandbox.
+// The idle container doesn't count against the pool, each run takes a slot while it executes.
+func (d *DockerClient) StartSession(ctx context.Context, image, workDir, sourceFile string, memoryLimitMB int) (SandboxSession, error) {
+	session := &dockerSession{
+		d:          d,
+		image:      image,
+		workDir:    workDir,
+		sourceFile: sourceFile,
+	}
+	if err := session.start(ctx, memoryLimitMB); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// start creates and starts the idle container with the sandbox policy of the language
+func (s *dockerSession) start(ctx context.Context, memoryLimitMB int) error {
+	config := &container.Config{
+		Image:      s.image,
+		Cmd:        []string{"sleep", "infinity"},
+		Env:        containerEnv,
+		WorkingDir: ContainerWorkDir,
+		Tty:        false,
+	}
+
+	hostConfig, err := workspaceHostConfig(s.workDir, memoryLimitMB, true)
+	if err != nil {
+		return err
+	}
+	SandboxPolicyFor(filepath.Ext(s.sourceFile)).apply(config, hostConfig)
+
+	containerID, err := s.d.createContainer(ctx, s.image, config, hostConfig)
+	if err != nil {
+		return err
+	}
+	if err := s.d.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		cleanupContainer(s.d.client, containerID)
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	s.containerID = containerID
+	s.memoryLimitMB = memoryLimitMB
+	return nil
+}
+
+// kill removes the container, e.g. because a run timed out and may still be running
+func (s *dockerSession) kill() {
+	if s.containerID != "" {
+		cleanupContainer(s.d.client, s.containerID)
+		s.containerID = ""
+	}
+}
+
+// Close removes the container
+func (s *dockerSession) Close() {
+	s.kill()
+}
+
+// setMemoryLimit changes the memory limit of the running container for the next run. If the container can't be
+// updated, e.g. because it uses more than the new limit, a fresh container is started instead.
+func (s *dockerSession) setMemoryLimit(ctx context.Context, memoryLimitMB int) error {
+	if s.containerID != "" && memoryLimitMB == s.memoryLimitMB {
+		return nil
+	}
+
+	if s.containerID != "" {
+		_, err := s.d.client.ContainerUpdate(ctx, s.containerID, container.UpdateConfig{
+			Resources: container.Resources{
+				Memory:     int64(memoryLimitMB) * 1024 * 1024,
+				MemorySwap: -1,
+			},
+		})
+		if err == nil {
+			s.memoryLimitMB = memoryLimitMB
+			return nil
+		}
+		log.Printf("Failed to update memory limit of container %s, starting a new one: %v", s.containerID, err)
+		s.kill()
+	}
+	return s.start(ctx, memoryLimitMB)
+}
+
+// Run executes the workspace once in the session's container, see SandboxSession
+func (s *dockerSession) Run(ctx context.Context, inputString string, timeoutMs int, memoryLimitMB int, args ...string) (ContainerOutput, *StatsResult, error) {
+	// Acquire a token from the pool
+	if err := s.d.pool.acquire(ctx); err != nil {
+		return ContainerOutput{}, nil, err
+	}
+	defer s.d.pool.release()
+
+	if err := s.setMemoryLimit(ctx, memoryLimitMB); err != nil {
+		return ContainerOutput{}, nil, err
+	}
+
+	command := append(getContainerCommand(filepath.Ext(s.sourceFile), ContainerWorkDir, s.sourceFile), args...)
+	exec, err := s.d.client.ContainerExecCreate(ctx, s.containerID, container.ExecOptions{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          append([]string{"sh", "-c", sessionRunScript, "sh"}, command...),
+	})
+	if err != nil {
+		// The container may have died, e.g. when the OOM killer picked its sleep
+		s.kill()
+		return ContainerOutput{}, nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	// Counters of the container are shared with earlier runs, so only their change is attributed to this run
+	oomKillsBefore, oomReadable := readCgroupOOMKills(s.containerID)
+	cpuBefore, cpuReadable := readCgroupCPUUsage(s.containerID)
+	memoryBefore, _ := readCgroupCurrentMemory(s.containerID)
+
+	execCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	memTracker := trackCurrentMemory(execCtx, s.containerID)
+
+	// Start timer for execution duration
+	startTime := time.Now()
+
+	// Attaching starts the exec
+	stream, err := s.d.client.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		s.kill()
+		return ContainerOutput{}, nil, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer stream.Close()
+
+	// Write the input in the background, the program may exit without reading all of it
+	go writeStdin(stream, inputString)
+
+	stdout := &limitedBuffer{limit: OutputLimitBytes()}
+	stderr := &limitedBuffer{limit: OutputLimitBytes()}
+	outputDone := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(stdout, stderr, stream.Reader)
+		outputDone <- err
+	}()
+
+	timer := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
+	defer timer.Stop()
+
+	result := &StatsResult{}
+	peakMemory := func() uint64 {
+		if peak := memTracker.Peak(); peak > memoryBefore {
+			return peak - memoryBefore
+		}
+		return 0
+	}
+
+	select {
+	case err := <-outputDone:
+		if err != nil {
+			s.kill()
+			return ContainerOutput{}, nil, fmt.Errorf("failed to read exec output: %w", err)
+		}
+	case <-timer.C:
+		// An exec can't be killed on its own, the container goes with it
+		result.Duration = int64(timeoutMs)
+		result.MemoryUsage = peakMemory()
+		s.kill()
+		return ContainerOutput{}, result, fmt.Errorf("execution timed out after %d ms", timeoutMs)
+	case <-ctx.Done():
+		s.kill()
+		return ContainerOutput{}, nil, ctx.Err()
+	}
+
+	duration := time.Since(startTime)
+	result.Duration = duration.Milliseconds()
+	result.MemoryUsage = peakMemory()
+	result.MemoryPercent = float64(result.MemoryUsage) / float64(int64(memoryLimitMB)*1024*1024) * 100.0
+	if cpuAfter, ok := readCgroupCPUUsage(s.containerID); ok && cpuReadable && duration > 0 {
+		result.CPUPercent = float64(cpuAfter-cpuBefore) / float64(duration.Microseconds()) * 100.0
+	}
+
+	exitCode, err := s.exitCode(ctx, exec.ID)
+	if err != nil {
+		s.kill()
+		return ContainerOutput{}, result, err
+	}
+	result.ExitCode = exitCode
+
+	output := ContainerOutput{
+		Stdout:    stdout.buf.String(),
+		Stderr:    stderr.buf.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+
+	// Without cgroup v2 counters only a kill of the container's main process is reported by Docker
+	if oomKillsAfter, ok := readCgroupOOMKills(s.containerID); ok && oomReadable {
+		result.OOMKilled = oomKillsAfter > oomKillsBefore
+	} else {
+		result.OOMKilled = s.d.wasOOMKilled(ctx, s.containerID)
+	}
+	if result.OOMKilled {
+		if limit := uint64(memoryLimitMB) * 1024 * 1024; result.MemoryUsage < limit {
+			result.MemoryUsage = limit
+		}
+		return output, result, fmt.Errorf("memory limit of %d MB exceeded", memoryLimitMB)
+	}
+
+	if exitCode != 0 {
+		return output, result, fmt.Errorf("container exited with non-zero status: %d", exitCode)
+	}
+	return output, result, nil
+}
+
+// exitCode waits for Docker to record the exit of an exec whose output stream has ended
+func (s *dockerSession) exitCode(ctx context.Context, execID string) (int, error) {
+	for attempt := 0; attempt < 50; attempt++ {
+		inspect, err := s.d.client.ContainerExecInspect(ctx, execID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect exec: %w", err)
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return 0, fmt.Errorf("exec %s still running after its output ended", execID)
+}
@@ -0,0 +1,228 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// functionSpan is a top-level function of the submitted code and the part of the code that defines it
+type functionSpan struct {
+	name       string
+	start, end int
+}
+
+// entryPointCandidates returns the top-level functions of the code and those of them the rest of the code never
+// refers to, which are the ones that may be the entry point. ok is false for languages without an analyzer.
+func entryPointCandidates(language string, code string) (functions []string, roots []string, ok bool) {
+	var spans []functionSpan
+	var stripped string
+	switch language {
+	case "Python":
+		stripped = stripPython(code)
+		spans = pythonFunctions(stripped)
+	case "JavaScript", "TypeScript":
+		stripped = stripJavaScript(code)
+		spans = javaScriptFunctions(stripped)
+	default:
+		return nil, nil, false
+	}
+
+	for _, span := range spans {
+		functions = append(functions, span.name)
+		// Helpers are called by the entry point, and a function the code calls itself is no entry point either
+		reference := regexp.MustCompile(`(^|[^\w$])` + regexp.QuoteMeta(span.name) + `([^\w$]|$)`)
+		referenced := false
+		for _, match := range reference.FindAllStringSubmatchIndex(stripped, -1) {
+			// The name is between the characters around it. References in its own body are recursive calls.
+			if start, end := match[3], match[4]; start < span.start || end > span.end {
+				referenced = true
+				break
+			}
+		}
+		if !referenced {
+			roots = append(roots, span.name)
+		}
+	}
+	return functions, roots, true
+}
+
+var (
+	pythonFunctionPattern = regexp.MustCompile(`^(?:async\s+)?def\s+([A-Za-z_]\w*)\s*\(|^([A-Za-z_]\w*)\s*=\s*lambda\b`)
+	pythonTopLevelPattern = regexp.MustCompile(`(?m)^[^\s#]`)
+)
+
+// pythonFunctions finds the functions defined at the top level of Python code without strings and comments.
+// A function ends where the next top-level statement starts.
+func pythonFunctions(code string) []functionSpan {
+	var spans []functionSpan
+	starts := pythonTopLevelPattern.FindAllStringIndex(code, -1)
+	for i, start := range starts {
+		end := len(code)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		match := pythonFunctionPattern.FindStringSubmatch(code[start[0]:end])
+		if match == nil {
+			continue
+		}
+		name := match[1]
+		if name == "" {
+			name = match[2]
+		}
+		spans = append(spans, functionSpan{name: name, start: start[0], end: end})
+	}
+	return spans
+}
+
+var javaScriptFunctionPattern = regexp.MustCompile(`^(?:export\s+(?:default\s+)?)?(?:` +
+	`(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)\s*[(<]` +
+	`|(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|(?:<[^>]*>\s*)?\([^)]*\)\s*(?::[^=]+)?=>|[A-Za-z_$][\w$]*\s*=>))`)
+
+// javaScriptFunctions finds the functions declared, or assigned to variables, at the top level of JavaScript or
+// TypeScript code without strings and comments. A function ends with the statement that declares it.
+func javaScriptFunctions(code string) []functionSpan {
+	var spans []functionSpan
+	depth := 0
+	atStatement := true
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		if depth == 0 && atStatement && !isSpace(c) {
+			if match := javaScriptFunctionPattern.FindStringSubmatch(code[i:]); match != nil {
+				name := match[1]
+				if name == "" {
+					name = match[2]
+				}
+				// Arrow functions continue after the arrow, other declarations are scanned from their start
+				arrow := strings.HasSuffix(match[0], "=>")
+				from := i
+				if arrow {
+					from += len(match[0])
+				}
+				end := javaScriptStatementEnd(code, from, arrow)
+				spans = append(spans, functionSpan{name: name, start: i, end: end})
+				i = end - 1
+				atStatement = true
+				continue
+			}
+		}
+
+		switch c {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+		}
+		if depth == 0 {
+			atStatement = c == ';' || c == '}' || c == '\n' || (atStatement && isSpace(c))
+		}
+	}
+	return spans
+}
+
+// javaScriptStatementEnd returns where the declaration at i, or the arrow function body at i, ends. Function bodies end with their
+// closing brace, the expression bodies of arrow functions with a semicolon or line break at the top level.
+func javaScriptStatementEnd(code string, i int, arrow bool) int {
+	for arrow && i < len(code) && isSpace(code[i]) {
+		i++
+	}
+	block := !arrow || (i < len(code) && code[i] == '{')
+
+	depth := 0
+	for ; i < len(code); i++ {
+		switch code[i] {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+			if block && depth == 0 && code[i] == '}' {
+				return i + 1
+			}
+		case ';', '\n':
+			if !block && depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(code)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// stripPython blanks out the comments and the contents of the string literals of Python code, keeping line breaks
+// and offsets, so that the analyzer only sees code
+func stripPython(code string) string {
+	out := []byte(code)
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '#':
+			for ; i < len(code) && code[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '"' || c == '\'':
+			quote := code[i : i+1]
+			if strings.HasPrefix(code[i:], strings.Repeat(quote, 3)) {
+				quote = strings.Repeat(quote, 3)
+			}
+			i = blankString(code, out, i, quote, len(quote) == 1)
+		}
+	}
+	return string(out)
+}
+
+// stripJavaScript blanks out the comments and the contents of the string and template literals of JavaScript code,
+// keeping line breaks and offsets. Regular expression literals are not recognized.
+func stripJavaScript(code string) string {
+	out := []byte(code)
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case strings.HasPrefix(code[i:], "//"):
+			for ; i < len(code) && code[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case strings.HasPrefix(code[i:], "/*"):
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				end = len(code)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if code[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			i--
+		case c == '"' || c == '\'':
+			i = blankString(code, out, i, code[i:i+1], true)
+		case c == '`':
+			i = blankString(code, out, i, "`", false)
+		}
+	}
+	return string(out)
+}
+
+// blankString blanks out the string literal that starts with quote at i and returns the offset of its last quote.
+// Single-line strings also end at a line break.
+func blankString(code string, out []byte, i int, quote string, singleLine bool) int {
+	for j := i + len(quote); j < len(code); j++ {
+		switch {
+		case code[j] == '\\':
+			out[j] = ' '
+			if j+1 < len(code) && code[j+1] != '\n' {
+				out[j+1] = ' '
+			}
+			j++
+		case strings.HasPrefix(code[j:], quote):
+			return j + len(quote) - 1
+		case code[j] == '\n':
+			if singleLine {
+				return j - 1
+			}
+		default:
+			out[j] = ' '
+		}
+	}
+	return len(code) - 1
+}
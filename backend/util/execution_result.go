@@ -13,12 +13,17 @@ const (
 
 // ExecutionResult contains the result of code execution
 type ExecutionResult struct {
-	Output   string
-	Duration int64
-	MemUsage int64
-	CPUUsage float64
-	Error    error
-	TimedOut bool
+	Output              string // stdout
+	Stderr              string
+	Duration            int64
+	MemUsage            int64
+	CPUUsage            float64
+	Error               error
+	TimedOut            bool
+	ExitCode            int  // Exit code of the submitted program, 0 when it finished normally
+	OOMKilled           bool // The kernel killed the program for exceeding its memory limit
+	CompileError        bool // The program could not be compiled, Output holds the diagnostics
+	OutputLimitExceeded bool // Output or Stderr was truncated at the output limit
 }
 
 // MarshalToJSON marshals the given object to JSON
@@ -2,7 +2,7 @@ package util
 
 import (
 	"bytes"
-	// "context"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,7 +19,8 @@ type RepoCreationResponse struct {
 	CloneURL string `json:"clone_url"`
 }
 
-func CloneRepository(repoURL string, githubAccessToken string) (string, error) {
+// CloneRepository clones the repository into a new temporary directory, giving up when ctx is done
+func CloneRepository(ctx context.Context, repoURL string, githubAccessToken string) (string, error) {
 	// Create a temporary directory
 	tempDir, err := CreateTempDir()
 	if err != nil {
@@ -27,7 +28,7 @@ func CloneRepository(repoURL string, githubAccessToken string) (string, error) {
 	}
 
 	// Clone the repository
-	_, err = git.PlainClone(tempDir, false, &git.CloneOptions{
+	_, err = git.PlainCloneContext(ctx, tempDir, false, &git.CloneOptions{
 		URL:      repoURL,
 		Progress: os.Stdout,
 		Auth: &githttp.BasicAuth{
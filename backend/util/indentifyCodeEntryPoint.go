@@ -1,39 +1,123 @@
 package util
 
 import (
+	"backend/config"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"os"
+	"log"
+	"regexp"
+	"slices"
 	"strings"
-
-	openai "github.com/sashabaranov/go-openai"
+	"sync"
 )
 
-func IdentifyCodeEntryPoint(code string) (string, error) {
-	promptTemplate := "Given the following code:\n\n%s\n\nReturn ONLY the name of the function that serves as the entry point of the code. Return only the name, no extra text."
-	prompt := fmt.Sprintf(promptTemplate, code)
+// IdentifyCodeEntryPoint returns the name of the function the harness of the language calls with the test input.
+// Python, JavaScript and TypeScript code is analyzed statically: a top-level function named main, the only top-level
+// function, or the only one the rest of the code doesn't call is the entry point. The model is only asked when that
+// leaves several candidates, or for languages without an analyzer, and its usage is recorded for the contest.
+// Languages whose harness ignores the entry point, such as C++, C# and Java, and code without any top-level function
+// get main without analysis. Entry points are cached by the hash of the code.
+func IdentifyCodeEntryPoint(ctx context.Context, contestID string, language string, code string) (string, error) {
+	if lang, ok := config.Languages.Get(language); ok {
+		if !lang.UsesEntryPoint() {
+			return "main", nil
+		}
+		language = lang.Name
+	}
 
-	openAIKey := os.Getenv("OPENAI_API_KEY")
-	if openAIKey == "" {
-		return "main", fmt.Errorf("OpenAI API key not found in environment variables")
+	key := entryPointCacheKey(language, code)
+	if entryPoint, ok := entryPoints.get(key); ok {
+		return entryPoint, nil
 	}
 
-	client := openai.NewClient(openAIKey)
-	ctx := context.Background()
+	entryPoint, err := findEntryPoint(ctx, contestID, language, code)
+	if err != nil {
+		return "", err
+	}
+	entryPoints.put(key, entryPoint)
+	return entryPoint, nil
+}
+
+func findEntryPoint(ctx context.Context, contestID string, language string, code string) (string, error) {
+	functions, roots, ok := entryPointCandidates(language, code)
+	if !ok {
+		return askEntryPoint(ctx, contestID, code, nil)
+	}
+
+	switch {
+	case len(functions) == 0, slices.Contains(functions, "main"):
+		// Without functions the harness calling main fails the submission like any other broken code
+		return "main", nil
+	case len(functions) == 1:
+		return functions[0], nil
+	case len(roots) == 1:
+		return roots[0], nil
+	case len(roots) == 0:
+		// Every function is called by another one, e.g. mutual recursion, so any of them may be the entry point
+		roots = functions
+	}
+	log.Printf("Entry point is ambiguous between %s, asking the model", strings.Join(roots, ", "))
+	return askEntryPoint(ctx, contestID, code, roots)
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+
+// askEntryPoint asks the model for the entry point of the code. The answer must be one of the candidates, or any
+// identifier when there are none.
+func askEntryPoint(ctx context.Context, contestID string, code string, candidates []string) (string, error) {
+	prompt := fmt.Sprintf("Given the following code:\n\n%s\n\nReturn ONLY the name of the function that serves as the entry point of the code. Return only the name, no extra text.", code)
+	if len(candidates) > 0 {
+		prompt += fmt.Sprintf(" It is one of: %s.", strings.Join(candidates, ", "))
+	}
 
-	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model: openai.GPT4,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
-	})
+	answer, err := CompleteLLM(ctx, contestID, LLM_PURPOSE_ENTRY_POINT, prompt)
 	if err != nil {
-		return "main", err
+		return "", fmt.Errorf("failed to ask the model for the entry point: %w", err)
 	}
 
-	output := strings.TrimSpace(resp.Choices[0].Message.Content)
-	return output, nil
+	entryPoint := strings.Trim(strings.TrimSpace(answer), "`\"'")
+	if len(candidates) > 0 && !slices.Contains(candidates, entryPoint) {
+		return "", fmt.Errorf("the model answered %q, which is none of the functions %s", entryPoint, strings.Join(candidates, ", "))
+	}
+	if !identifierPattern.MatchString(entryPoint) {
+		return "", fmt.Errorf("the model answered %q, which is not a function name", entryPoint)
+	}
+	return entryPoint, nil
+}
+
+func entryPointCacheKey(language string, code string) string {
+	hash := sha256.Sum256([]byte(language + "\x00" + code))
+	return hex.EncodeToString(hash[:])
+}
+
+// entryPointCache remembers the entry points of code that was seen before, forgetting the oldest when it is full
+type entryPointCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+	order   []string
+}
+
+var entryPoints = &entryPointCache{entries: make(map[string]string)}
+
+func (c *entryPointCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entryPoint, ok := c.entries[key]
+	return entryPoint, ok
+}
+
+func (c *entryPointCache) put(key string, entryPoint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	if len(c.order) >= ENTRY_POINT_CACHE_SIZE {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[key] = entryPoint
+	c.order = append(c.order, key)
 }
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"backend/models"
+	"context"
+	"testing"
+)
+
+func TestIdentifyCodeEntryPoint(t *testing.T) {
+	previous, _ := GetLLMProvider()
+	t.Cleanup(func() {
+		SetLLMProvider(previous)
+		SetLLMUsageRecorder(nil)
+	})
+	SetLLMProvider(&FakeLLMProvider{Response: "solve"})
+	var calls int
+	SetLLMUsageRecorder(func(models.LLMUsage) error {
+		calls++
+		return nil
+	})
+
+	tests := []struct {
+		name      string
+		language  string
+		code      string
+		want      string
+		wantCalls int
+	}{
+		{"no function", "Python", "print(input()[::-1])\n", "main", 0},
+		{"main", "Python", "def helper(s):\n    return s\n\ndef main(s):\n    return helper(s)\n", "main", 0},
+		{"only function", "JavaScript", "function reverse(s) {\n    return s.split('').reverse().join('');\n}\n", "reverse", 0},
+		{"harness ignores the entry point", "C++", "int solve() { return 0; }\nint other() { return 1; }\n", "main", 0},
+		{"ambiguous", "Python", "def solve(s):\n    return s\n\ndef other(s):\n    return s\n", "solve", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			got, err := IdentifyCodeEntryPoint(context.Background(), "contest", tt.language, tt.code)
+			if err != nil {
+				t.Fatalf("IdentifyCodeEntryPoint() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IdentifyCodeEntryPoint() = %q, want %q", got, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("the model was asked %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package util
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// LLMProvider sends prompts to a language model.
+// OpenAIProvider talks to any OpenAI-compatible API, FakeLLMProvider answers deterministically without a network.
+type LLMProvider interface {
+	// Complete returns the answer of the model to the prompt. Providers retry failed requests themselves.
+	Complete(ctx context.Context, prompt string) (LLMCompletion, error)
+
+	// Name identifies the provider in usage records, e.g. "openai"
+	Name() string
+
+	// Model returns the name of the model the provider asks
+	Model() string
+}
+
+// LLMCompletion is the answer of the model with the tokens it took
+type LLMCompletion struct {
+	Content          string
+	PromptTokens     int
+	CompletionTokens int
+	Attempts         int // Requests sent, including retries
+}
+
+// LLMConfig configures the OpenAI-compatible provider
+type LLMConfig struct {
+	BaseURL    string // Empty uses the OpenAI API
+	APIKey     string // May be empty for self-hosted models
+	Model      string
+	Timeout    time.Duration // Per request
+	MaxRetries int           // For rate limits, server errors and network errors
+	Backoff    time.Duration // Before the first retry, doubled for every further one
+
+	// Prices in USD per 1000 tokens, used for the cost in usage records
+	PromptCostPer1K     float64
+	CompletionCostPer1K float64
+}
+
+// LLMConfigFromEnv reads the provider configuration from LLM_BASE_URL, LLM_API_KEY (OPENAI_API_KEY if unset),
+// LLM_MODEL, LLM_TIMEOUT_MS, LLM_MAX_RETRIES, LLM_PROMPT_COST_PER_1K and LLM_COMPLETION_COST_PER_1K
+func LLMConfigFromEnv() LLMConfig {
+	config := LLMConfig{
+		BaseURL:    strings.TrimSpace(os.Getenv("LLM_BASE_URL")),
+		APIKey:     os.Getenv("LLM_API_KEY"),
+		Model:      strings.TrimSpace(os.Getenv("LLM_MODEL")),
+		Timeout:    DEFAULT_LLM_TIMEOUT * time.Millisecond,
+		MaxRetries: DEFAULT_LLM_MAX_RETRIES,
+		Backoff:    LLM_RETRY_BACKOFF * time.Millisecond,
+	}
+	if config.APIKey == "" {
+		config.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if config.Model == "" {
+		config.Model = openai.GPT4
+	}
+	if timeoutMs, err := strconv.Atoi(os.Getenv("LLM_TIMEOUT_MS")); err == nil && timeoutMs > 0 {
+		config.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	if retries, err := strconv.Atoi(os.Getenv("LLM_MAX_RETRIES")); err == nil && retries >= 0 {
+		config.MaxRetries = retries
+	}
+	if cost, err := strconv.ParseFloat(os.Getenv("LLM_PROMPT_COST_PER_1K"), 64); err == nil && cost >= 0 {
+		config.PromptCostPer1K = cost
+	}
+	if cost, err := strconv.ParseFloat(os.Getenv("LLM_COMPLETION_COST_PER_1K"), 64); err == nil && cost >= 0 {
+		config.CompletionCostPer1K = cost
+	}
+	return config
+}
+
+// Cost returns the price of a completion in USD
+func (c LLMConfig) Cost(completion LLMCompletion) float64 {
+	return float64(completion.PromptTokens)/1000*c.PromptCostPer1K + float64(completion.CompletionTokens)/1000*c.CompletionCostPer1K
+}
+
+// OpenAIProvider asks a model behind an OpenAI-compatible chat completions API
+type OpenAIProvider struct {
+	client *openai.Client
+	config LLMConfig
+}
+
+// NewOpenAIProvider creates a provider for the API at config.BaseURL. An API key is required for the OpenAI API.
+func NewOpenAIProvider(config LLMConfig) (*OpenAIProvider, error) {
+	if config.APIKey == "" && config.BaseURL == "" {
+		return nil, fmt.Errorf("no API key for the OpenAI API, set LLM_API_KEY or OPENAI_API_KEY")
+	}
+	clientConfig := openai.DefaultConfig(config.APIKey)
+	if config.BaseURL != "" {
+		clientConfig.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	}
+	clientConfig.HTTPClient = &http.Client{Timeout: config.Timeout}
+	return &OpenAIProvider{client: openai.NewClientWithConfig(clientConfig), config: config}, nil
+}
+
+func (p *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+func (p *OpenAIProvider) Model() string {
+	return p.config.Model
+}
+
+// Complete sends the prompt, retrying rate limits, server errors and network errors with exponential backoff
+func (p *OpenAIProvider) Complete(ctx context.Context, prompt string) (LLMCompletion, error) {
+	request := openai.ChatCompletionRequest{
+		Model: p.config.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: prompt,
+			},
+		},
+	}
+
+	backoff := p.config.Backoff
+	if backoff <= 0 {
+		backoff = LLM_RETRY_BACKOFF * time.Millisecond
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := p.client.CreateChatCompletion(ctx, request)
+		if err == nil {
+			if len(resp.Choices) == 0 {
+				return LLMCompletion{Attempts: attempt}, fmt.Errorf("the model returned no answer")
+			}
+			return LLMCompletion{
+				Content:          resp.Choices[0].Message.Content,
+				PromptTokens:     resp.Usage.PromptTokens,
+				CompletionTokens: resp.Usage.CompletionTokens,
+				Attempts:         attempt,
+			}, nil
+		}
+
+		if attempt > p.config.MaxRetries || !retryableLLMError(err) || ctx.Err() != nil {
+			return LLMCompletion{Attempts: attempt}, err
+		}
+		log.Printf("Request to the model failed (attempt %d/%d), retrying in %v: %v", attempt, p.config.MaxRetries+1, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return LLMCompletion{Attempts: attempt}, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// retryableLLMError reports whether a failed request may succeed when it is sent again
+func retryableLLMError(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests || apiErr.HTTPStatusCode >= 500
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode == http.StatusTooManyRequests || requestErr.HTTPStatusCode >= 500
+	}
+	// Anything else didn't get an answer from the server, e.g. a timeout or a refused connection
+	return true
+}
+
+// FakeLLMProvider answers every prompt with the same response, for tests and development without a model.
+// Token counts are derived from the lengths of the prompt and the response.
+type FakeLLMProvider struct {
+	Response string
+}
+
+func (p *FakeLLMProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeLLMProvider) Model() string {
+	return "fake"
+}
+
+func (p *FakeLLMProvider) Complete(ctx context.Context, prompt string) (LLMCompletion, error) {
+	if err := ctx.Err(); err != nil {
+		return LLMCompletion{}, err
+	}
+	return LLMCompletion{
+		Content:          p.Response,
+		PromptTokens:     (len(prompt) + 3) / 4,
+		CompletionTokens: (len(p.Response) + 3) / 4,
+		Attempts:         1,
+	}, nil
+}
+
+var (
+	llmProviderMu   sync.RWMutex // Guards llmProvider and llmProviderErr, which SetLLMProvider replaces
+	llmProvider     LLMProvider
+	llmConfig       LLMConfig
+	llmProviderOnce sync.Once
+	llmProviderErr  error
+
+	llmUsageMu       sync.RWMutex
+	llmUsageRecorder func(models.LLMUsage) error
+)
+
+// GetLLMProvider returns the provider configured by the environment. LLM_PROVIDER=fake answers every prompt with
+// LLM_FAKE_RESPONSE ("main" by default), otherwise the OpenAI-compatible provider of LLMConfigFromEnv is used.
+func GetLLMProvider() (LLMProvider, error) {
+	llmProviderOnce.Do(func() {
+		llmConfig = LLMConfigFromEnv()
+		switch provider := strings.ToLower(strings.TrimSpace(os.Getenv("LLM_PROVIDER"))); provider {
+		case "fake":
+			response := os.Getenv("LLM_FAKE_RESPONSE")
+			if response == "" {
+				response = "main"
+			}
+			llmProvider = &FakeLLMProvider{Response: response}
+		case "", "openai":
+			llmProvider, llmProviderErr = NewOpenAIProvider(llmConfig)
+		default:
+			llmProviderErr = fmt.Errorf("unknown LLM_PROVIDER: %s", provider)
+		}
+	})
+
+	llmProviderMu.RLock()
+	defer llmProviderMu.RUnlock()
+	return llmProvider, llmProviderErr
+}
+
+// SetLLMProvider replaces the provider configured by the environment, e.g. with a FakeLLMProvider in tests.
+// Token prices are still read from the environment.
+func SetLLMProvider(provider LLMProvider) {
+	llmProviderOnce.Do(func() {
+		llmConfig = LLMConfigFromEnv()
+	})
+
+	llmProviderMu.Lock()
+	defer llmProviderMu.Unlock()
+	llmProvider, llmProviderErr = provider, nil
+}
+
+// SetLLMUsageRecorder sets the function that stores the usage of every model call, e.g. in the database.
+// Without one usage is only logged.
+func SetLLMUsageRecorder(record func(models.LLMUsage) error) {
+	llmUsageMu.Lock()
+	defer llmUsageMu.Unlock()
+	llmUsageRecorder = record
+}
+
+// CompleteLLM asks the configured model on behalf of a contest and records the usage and cost of the call
+func CompleteLLM(ctx context.Context, contestID string, purpose string, prompt string) (string, error) {
+	provider, err := GetLLMProvider()
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	completion, err := provider.Complete(ctx, prompt)
+	usage := models.LLMUsage{
+		ContestID:        contestID,
+		Purpose:          purpose,
+		Provider:         provider.Name(),
+		Model:            provider.Model(),
+		PromptTokens:     completion.PromptTokens,
+		CompletionTokens: completion.CompletionTokens,
+		CostUSD:          llmConfig.Cost(completion),
+		DurationMs:       time.Since(start).Milliseconds(),
+		Attempts:         completion.Attempts,
+	}
+	if err != nil {
+		usage.Error = err.Error()
+	}
+	recordLLMUsage(usage)
+	if err != nil {
+		return "", fmt.Errorf("request to the model failed: %w", err)
+	}
+	return completion.Content, nil
+}
+
+func recordLLMUsage(usage models.LLMUsage) {
+	log.Printf("Model call for %s of contest %s: %s/%s, %d+%d tokens, $%.6f, %d ms",
+		usage.Purpose, usage.ContestID, usage.Provider, usage.Model, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD, usage.DurationMs)
+
+	llmUsageMu.RLock()
+	record := llmUsageRecorder
+	llmUsageMu.RUnlock()
+	if record == nil || usage.ContestID == "" {
+		return
+	}
+	// Usage is bookkeeping, failing to store it doesn't fail the call
+	if err := record(usage); err != nil {
+		log.Printf("Failed to record model usage: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package util
+
+import (
+	"backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newModelServer answers chat completions with the given status codes in turn, succeeding after the last one
+func newModelServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		w.Header().Set("Content-Type", "application/json")
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			w.Write([]byte(`{"error": {"message": "try again", "type": "server_error"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": "solve"}}},
+			"usage":   map[string]int{"prompt_tokens": 1200, "completion_tokens": 300},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestOpenAIProvider(t *testing.T, baseURL string, maxRetries int) *OpenAIProvider {
+	t.Helper()
+	provider, err := NewOpenAIProvider(LLMConfig{
+		BaseURL:    baseURL,
+		Model:      "test",
+		Timeout:    5 * time.Second,
+		MaxRetries: maxRetries,
+		Backoff:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestOpenAIProviderRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"first try", nil, 2, false, 1},
+		{"rate limit and server error", []int{http.StatusTooManyRequests, http.StatusBadGateway}, 2, false, 3},
+		{"out of retries", []int{500, 500, 500}, 2, true, 3},
+		{"client error is not retried", []int{http.StatusBadRequest}, 2, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newModelServer(t, tt.statuses...)
+			completion, err := newTestOpenAIProvider(t, server.URL, tt.maxRetries).Complete(context.Background(), "prompt")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Complete() error = %v, want an error: %v", err, tt.wantErr)
+			}
+			if completion.Attempts != tt.wantAttempts || int(requests.Load()) != tt.wantAttempts {
+				t.Errorf("Attempts = %d after %d requests, want %d", completion.Attempts, requests.Load(), tt.wantAttempts)
+			}
+			if !tt.wantErr && (completion.Content != "solve" || completion.PromptTokens != 1200 || completion.CompletionTokens != 300) {
+				t.Errorf("completion = %+v", completion)
+			}
+		})
+	}
+}
+
+func TestOpenAIProviderStopsRetryingWhenCanceled(t *testing.T) {
+	server, requests := newModelServer(t, 500, 500, 500)
+	provider := newTestOpenAIProvider(t, server.URL, 2)
+	provider.config.Backoff = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := provider.Complete(ctx, "prompt"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Complete() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("sent %d requests, want none after the context was done", requests.Load())
+	}
+}
+
+func TestLLMConfigCost(t *testing.T) {
+	config := LLMConfig{PromptCostPer1K: 0.01, CompletionCostPer1K: 0.03}
+	cost := config.Cost(LLMCompletion{PromptTokens: 1200, CompletionTokens: 300})
+	if want := 0.012 + 0.009; math.Abs(cost-want) > 1e-12 {
+		t.Errorf("Cost() = %v, want %v", cost, want)
+	}
+}
+
+func TestCompleteLLMRecordsUsage(t *testing.T) {
+	server, _ := newModelServer(t, http.StatusServiceUnavailable)
+	previous, _ := GetLLMProvider()
+	previousConfig := llmConfig
+	t.Cleanup(func() {
+		SetLLMProvider(previous)
+		SetLLMUsageRecorder(nil)
+		llmConfig = previousConfig
+	})
+	SetLLMProvider(newTestOpenAIProvider(t, server.URL, 1))
+	llmConfig = LLMConfig{PromptCostPer1K: 0.01, CompletionCostPer1K: 0.03}
+
+	var usages []models.LLMUsage
+	SetLLMUsageRecorder(func(usage models.LLMUsage) error {
+		usages = append(usages, usage)
+		return nil
+	})
+
+	answer, err := CompleteLLM(context.Background(), "contest", LLM_PURPOSE_ENTRY_POINT, "prompt")
+	if err != nil || answer != "solve" {
+		t.Fatalf("CompleteLLM() = %q, %v", answer, err)
+	}
+	if len(usages) != 1 {
+		t.Fatalf("recorded %d usages, want 1", len(usages))
+	}
+	usage := usages[0]
+	if usage.ContestID != "contest" || usage.Purpose != LLM_PURPOSE_ENTRY_POINT || usage.Provider != "openai" || usage.Model != "test" {
+		t.Errorf("usage = %+v", usage)
+	}
+	if usage.PromptTokens != 1200 || usage.CompletionTokens != 300 || usage.Attempts != 2 || usage.Error != "" {
+		t.Errorf("usage = %+v, want the tokens of the answer after 2 attempts", usage)
+	}
+	if math.Abs(usage.CostUSD-0.021) > 1e-12 {
+		t.Errorf("CostUSD = %v, want 0.021", usage.CostUSD)
+	}
+
+	// Failed calls are recorded too, with the reason
+	usages = nil
+	failing, _ := newModelServer(t, http.StatusBadRequest)
+	SetLLMProvider(newTestOpenAIProvider(t, failing.URL, 0))
+	if _, err := CompleteLLM(context.Background(), "contest", LLM_PURPOSE_ENTRY_POINT, "prompt"); err == nil {
+		t.Fatal("CompleteLLM() = nil error for a rejected request")
+	}
+	if len(usages) != 1 || !strings.Contains(usages[0].Error, "try again") {
+		t.Errorf("usages = %+v, want the failed call with its error", usages)
+	}
+}
+
+func TestSetLLMProviderWhileCompleting(t *testing.T) {
+	previous, _ := GetLLMProvider()
+	t.Cleanup(func() { SetLLMProvider(previous) })
+	SetLLMProvider(&FakeLLMProvider{Response: "main"})
+
+	// Meant for go test -race, which reports replacing the provider while calls read it
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetLLMProvider(&FakeLLMProvider{Response: "main"})
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := CompleteLLM(context.Background(), "", LLM_PURPOSE_ENTRY_POINT, "prompt"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,446 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var _ Sandbox = (*LocalSandbox)(nil)
+
+// LocalSandbox runs programs as plain processes with the toolchains installed on the host.
+// It is meant for development machines and CI, it does not isolate the program from the host.
+//
+// Limits are applied with rlimits through a `ulimit` shell wrapper. If JUDGE_LOCAL_CGROUP names a cgroup v2
+// directory the judge may write to, every run gets its own child cgroup with memory.max and pids.max,
+// which also makes peak memory and OOM kills exact. Without it, memory is limited with `ulimit -d`,
+// so a program over the limit fails to allocate and ends with a runtime error instead of MLE.
+type LocalSandbox struct {
+	pool         *slotPool
+	cgroupParent string
+}
+
+// NewLocalSandbox creates a local sandbox running at most maxProcesses programs at once
+func NewLocalSandbox(maxProcesses int) (*LocalSandbox, error) {
+	cgroupParent := os.Getenv("JUDGE_LOCAL_CGROUP")
+	if cgroupParent != "" {
+		if _, err := os.Stat(filepath.Join(cgroupParent, "cgroup.procs")); err != nil {
+			return nil, fmt.Errorf("JUDGE_LOCAL_CGROUP is not a cgroup v2 directory: %w", err)
+		}
+	}
+
+	return &LocalSandbox{
+		pool:         newSlotPool(maxProcesses),
+		cgroupParent: cgroupParent,
+	}, nil
+}
+
+// Prepare checks that the program running the source file is installed
+func (s *LocalSandbox) Prepare(ctx context.Context, image string, sourceFile string) error {
+	extension := filepath.Ext(sourceFile)
+	commands := [][]string{getContainerCommand(extension, "/", sourceFile)}
+	if compile := getCompileCommand(extension, "/", sourceFile, nil); compile != nil {
+		commands = append(commands, compile)
+	}
+
+	for _, command := range commands {
+		// Compiled C++ solutions run the binary from the workspace
+		if filepath.IsAbs(command[0]) {
+			continue
+		}
+		if _, err := exec.LookPath(command[0]); err != nil {
+			return fmt.Errorf("%s is required to run %s files locally: %w", command[0], extension, err)
+		}
+	}
+	return nil
+}
+
+// WorkspacePath returns the path of a file of the workspace on the host
+func (s *LocalSandbox) WorkspacePath(workDir string, name string) string {
+	return filepath.Join(workDir, name)
+}
+
+// Compile compiles the source file in workDir once, see Sandbox
+func (s *LocalSandbox) Compile(ctx context.Context, image, workDir, sourceFile string, flags []string, timeoutMs int, memoryLimitMB int) (string, bool, error) {
+	command := getCompileCommand(filepath.Ext(sourceFile), workDir, sourceFile, flags)
+	if command == nil {
+		return "", true, nil // Interpreted language, nothing to compile
+	}
+
+	if err := s.pool.acquire(ctx); err != nil {
+		return "", false, err
+	}
+	defer s.pool.release()
+
+	stdout := &limitedBuffer{limit: OutputLimitBytes()}
+	stderr := &limitedBuffer{limit: OutputLimitBytes()}
+	process, err := s.start(command, workDir, memoryLimitMB, SandboxPolicyFor(filepath.Ext(sourceFile)), nil, stdout, stderr)
+	if err != nil {
+		return "", false, err
+	}
+
+	_, exited, err := process.wait(ctx, timeoutMs, memoryLimitMB)
+	if !exited {
+		if ctx.Err() != nil {
+			return "", false, ctx.Err()
+		}
+		return fmt.Sprintf("Compilation timed out after %d ms", timeoutMs), false, nil
+	}
+	// Compilers disagree on which stream they report errors to
+	return stdout.buf.String() + stderr.buf.String(), err == nil, nil
+}
+
+// Run executes the workspace as a local process, see Sandbox
+func (s *LocalSandbox) Run(ctx context.Context, image, workDir, sourceFile, inputString string, timeoutMs int, memoryLimitMB int, args ...string) (ContainerOutput, *StatsResult, error) {
+	if err := s.pool.acquire(ctx); err != nil {
+		return ContainerOutput{}, nil, err
+	}
+	defer s.pool.release()
+
+	command := append(getContainerCommand(filepath.Ext(sourceFile), workDir, sourceFile), args...)
+	stdout := &limitedBuffer{limit: OutputLimitBytes()}
+	stderr := &limitedBuffer{limit: OutputLimitBytes()}
+	process, err := s.start(command, workDir, memoryLimitMB, SandboxPolicyFor(filepath.Ext(sourceFile)), strings.NewReader(stdinPayload(inputString)), stdout, stderr)
+	if err != nil {
+		return ContainerOutput{}, nil, err
+	}
+
+	stats, exited, err := process.wait(ctx, timeoutMs, memoryLimitMB)
+	if !exited {
+		return ContainerOutput{}, stats, err
+	}
+	return ContainerOutput{
+		Stdout:    stdout.buf.String(),
+		Stderr:    stderr.buf.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}, stats, err
+}
+
+// RunCommand runs a command as a local process in the workspace, see Sandbox.
+// The process always has the network of the host.
+func (s *LocalSandbox) RunCommand(ctx context.Context, run CommandRun) (ContainerOutput, *StatsResult, error) {
+	if err := s.pool.acquire(ctx); err != nil {
+		return ContainerOutput{}, nil, err
+	}
+	defer s.pool.release()
+
+	for _, extra := range run.Mounts {
+		target := filepath.Join(run.WorkDir, extra.Target)
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return ContainerOutput{}, nil, err
+		}
+		os.RemoveAll(target)
+		if err := os.Symlink(extra.Source, target); err != nil {
+			return ContainerOutput{}, nil, fmt.Errorf("failed to link %s into the workspace: %w", extra.Target, err)
+		}
+	}
+
+	stdout := &limitedBuffer{limit: OutputLimitBytes()}
+	stderr := &limitedBuffer{limit: OutputLimitBytes()}
+	process, err := s.start(run.Command, run.WorkDir, run.MemoryLimitMB, SandboxPolicyFor(run.Policy), nil, stdout, stderr)
+	if err != nil {
+		return ContainerOutput{}, nil, err
+	}
+
+	stats, exited, err := process.wait(ctx, run.TimeoutMs, run.MemoryLimitMB)
+	if !exited {
+		return ContainerOutput{}, stats, err
+	}
+	return ContainerOutput{
+		Stdout:    stdout.buf.String(),
+		Stderr:    stderr.buf.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+	}, stats, err
+}
+
+// RunInteractive runs the solution and the interactor as two local processes connected by pipes, see Sandbox
+func (s *LocalSandbox) RunInteractive(ctx context.Context, solution ContainerRun, interactor ContainerRun) (RunResult, RunResult, error) {
+	if err := s.pool.acquirePair(ctx); err != nil {
+		return RunResult{}, RunResult{}, err
+	}
+	defer s.pool.release()
+	defer s.pool.release()
+
+	// toInteractor carries the solution's stdout, toSolution the interactor's
+	toInteractorReader, toInteractorWriter, err := os.Pipe()
+	if err != nil {
+		return RunResult{}, RunResult{}, err
+	}
+	toSolutionReader, toSolutionWriter, err := os.Pipe()
+	if err != nil {
+		toInteractorReader.Close()
+		toInteractorWriter.Close()
+		return RunResult{}, RunResult{}, err
+	}
+
+	runs := []ContainerRun{solution, interactor}
+	stdins := []*os.File{toSolutionReader, toInteractorReader}
+	pipes := []*os.File{toInteractorWriter, toSolutionWriter}
+	stdouts := make([]*limitedBuffer, len(runs))
+	stderrs := make([]*limitedBuffer, len(runs))
+	processes := make([]*localProcess, len(runs))
+
+	for i, run := range runs {
+		stdouts[i] = &limitedBuffer{limit: OutputLimitBytes()}
+		stderrs[i] = &limitedBuffer{limit: OutputLimitBytes()}
+		// A copy of everything piped to the other side is kept as the program's output
+		stdout := io.MultiWriter(stdouts[i], ignoreWriteErrors{pipes[i]})
+		command := append(getContainerCommand(filepath.Ext(run.SourceFile), run.WorkDir, run.SourceFile), run.Args...)
+
+		processes[i], err = s.start(command, run.WorkDir, run.MemoryLimitMB, SandboxPolicyFor(filepath.Ext(run.SourceFile)), stdins[i], stdout, stderrs[i])
+		if err != nil {
+			for _, process := range processes[:i] {
+				process.kill()
+				process.wait(ctx, 0, 0)
+			}
+			for _, file := range append(stdins, pipes...) {
+				file.Close()
+			}
+			return RunResult{}, RunResult{}, err
+		}
+	}
+	// The children hold their own copies of the read ends
+	toSolutionReader.Close()
+	toInteractorReader.Close()
+
+	results := make([]RunResult, len(runs))
+	var wg sync.WaitGroup
+	for i, run := range runs {
+		wg.Add(1)
+		go func(i int, run ContainerRun) {
+			defer wg.Done()
+
+			stats, exited, runErr := processes[i].wait(ctx, run.TimeoutMs, run.MemoryLimitMB)
+			// The other side sees EOF once this program is done
+			pipes[i].Close()
+
+			results[i] = RunResult{Stats: stats, Err: runErr}
+			if exited {
+				results[i].Output = ContainerOutput{
+					Stdout:    stdouts[i].buf.String(),
+					Stderr:    stderrs[i].buf.String(),
+					Truncated: stdouts[i].truncated || stderrs[i].truncated,
+				}
+			}
+		}(i, run)
+	}
+	wg.Wait()
+
+	return results[0], results[1], nil
+}
+
+// ignoreWriteErrors keeps copying output after the other side of an interactive run has exited
+type ignoreWriteErrors struct {
+	w io.Writer
+}
+
+func (w ignoreWriteErrors) Write(p []byte) (int, error) {
+	w.w.Write(p)
+	return len(p), nil
+}
+
+// localProcess is a started program together with its cgroup, if any
+type localProcess struct {
+	cmd       *exec.Cmd
+	cgroup    *localCgroup
+	startTime time.Time
+	done      chan error
+}
+
+// start launches the command with the rlimits of the policy and, if configured, in a fresh cgroup
+func (s *LocalSandbox) start(command []string, workDir string, memoryLimitMB int, policy SandboxPolicy, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*localProcess, error) {
+	limits := []string{}
+	if policy.FileSizeMB > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -f %d", policy.FileSizeMB*1024*2)) // In 512 byte blocks
+	}
+	if policy.OpenFiles > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -n %d", policy.OpenFiles))
+	}
+
+	var cgroup *localCgroup
+	if s.cgroupParent != "" {
+		var err error
+		cgroup, err = newLocalCgroup(s.cgroupParent, memoryLimitMB, policy.PidsLimit)
+		if err != nil {
+			return nil, err
+		}
+	} else if memoryLimitMB > 0 {
+		// RLIMIT_DATA counts writable memory only, unlike RLIMIT_AS it spares the address space V8 and the JVM reserve
+		limits = append(limits, fmt.Sprintf("ulimit -d %d", memoryLimitMB*1024)) // In KB
+	}
+
+	// The shell applies the limits and replaces itself with the program
+	script := strings.Join(append(limits, `exec "$@"`), " && ")
+	cmd := exec.Command("/bin/sh", append([]string{"-c", script, "sh"}, command...)...)
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(), "DOTNET_NOLOGO=1", "DOTNET_SKIP_FIRST_TIME_EXPERIENCE=1", "DOTNET_CLI_TELEMETRY_OPTOUT=1")
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Own process group, so that a timeout kills everything the program started
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if cgroup != nil {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(cgroup.dir.Fd())
+	}
+
+	process := &localProcess{cmd: cmd, cgroup: cgroup, done: make(chan error, 1)}
+	process.startTime = time.Now()
+	if err := cmd.Start(); err != nil {
+		if cgroup != nil {
+			cgroup.remove()
+		}
+		return nil, fmt.Errorf("failed to start %s: %w", command[0], err)
+	}
+
+	go func() {
+		process.done <- cmd.Wait()
+	}()
+	return process, nil
+}
+
+func (p *localProcess) kill() {
+	if p.cmd.Process != nil {
+		syscall.Kill(-p.cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// wait waits for the process like DockerClient.waitForContainer. A timeoutMs of 0 waits until ctx is done.
+func (p *localProcess) wait(ctx context.Context, timeoutMs int, memoryLimitMB int) (*StatsResult, bool, error) {
+	if p.cgroup != nil {
+		defer p.cgroup.remove()
+	}
+
+	var timeout <-chan time.Time
+	if timeoutMs > 0 {
+		timer := time.NewTimer(time.Duration(timeoutMs)*time.Millisecond - time.Since(p.startTime))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	result := &StatsResult{}
+	memoryLimitBytes := uint64(memoryLimitMB) * 1024 * 1024
+
+	var waitErr error
+	select {
+	case waitErr = <-p.done:
+	case <-timeout:
+		p.kill()
+		<-p.done
+		result.Duration = int64(timeoutMs)
+		result.MemoryUsage = p.peakMemory()
+		return result, false, fmt.Errorf("execution timed out after %d ms", timeoutMs)
+	case <-ctx.Done():
+		p.kill()
+		<-p.done
+		return result, false, ctx.Err()
+	}
+
+	duration := time.Since(p.startTime)
+	result.Duration = duration.Milliseconds()
+	result.MemoryUsage = p.peakMemory()
+	if memoryLimitBytes > 0 {
+		result.MemoryPercent = float64(result.MemoryUsage) / float64(memoryLimitBytes) * 100.0
+	}
+
+	state := p.cmd.ProcessState
+	if cpuTime := state.UserTime() + state.SystemTime(); duration > 0 {
+		result.CPUPercent = float64(cpuTime) / float64(duration) * 100.0
+	}
+
+	result.ExitCode = state.ExitCode()
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.ExitCode = 128 + int(status.Signal()) // Same as a shell or Docker would report
+	}
+
+	var exitErr *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) {
+		return result, true, fmt.Errorf("failed to wait for process: %w", waitErr)
+	}
+
+	if p.cgroup != nil && p.cgroup.oomKilled() {
+		result.OOMKilled = true
+		if result.MemoryUsage < memoryLimitBytes {
+			result.MemoryUsage = memoryLimitBytes
+		}
+		return result, true, fmt.Errorf("memory limit of %d MB exceeded", memoryLimitMB)
+	}
+
+	if result.ExitCode != 0 {
+		return result, true, fmt.Errorf("process exited with non-zero status: %d", result.ExitCode)
+	}
+	return result, true, nil
+}
+
+// peakMemory prefers the cgroup's accounting over the maximum resident set size reported by the kernel
+func (p *localProcess) peakMemory() uint64 {
+	if p.cgroup != nil {
+		if peak, ok := readUintFile(filepath.Join(p.cgroup.path, "memory.peak")); ok {
+			return peak
+		}
+	}
+	if p.cmd.ProcessState != nil {
+		if usage, ok := p.cmd.ProcessState.SysUsage().(*syscall.Rusage); ok {
+			return uint64(usage.Maxrss) * 1024 // Maxrss is in KB on Linux
+		}
+	}
+	return 0
+}
+
+// localCgroup is the cgroup v2 directory of a single run
+type localCgroup struct {
+	path string
+	dir  *os.File
+}
+
+func newLocalCgroup(parent string, memoryLimitMB int, pidsLimit int64) (*localCgroup, error) {
+	path, err := os.MkdirTemp(parent, "run-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+
+	settings := map[string]string{}
+	if memoryLimitMB > 0 {
+		settings["memory.max"] = strconv.Itoa(memoryLimitMB * 1024 * 1024)
+		settings["memory.swap.max"] = "0"
+	}
+	if pidsLimit > 0 {
+		settings["pids.max"] = strconv.FormatInt(pidsLimit, 10)
+	}
+	for file, value := range settings {
+		if err := os.WriteFile(filepath.Join(path, file), []byte(value), 0644); err != nil {
+			os.Remove(path)
+			return nil, fmt.Errorf("failed to set %s: %w", file, err)
+		}
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+	return &localCgroup{path: path, dir: dir}, nil
+}
+
+// oomKilled reports whether the kernel killed a process of the cgroup for exceeding memory.max
+func (c *localCgroup) oomKilled() bool {
+	count, _ := readKeyedFile(filepath.Join(c.path, "memory.events"), "oom_kill")
+	return count > 0
+}
+
+// remove deletes the cgroup, which only works once all of its processes are gone
+func (c *localCgroup) remove() {
+	c.dir.Close()
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Failed to remove cgroup %s: %v\n", c.path, err)
+	}
+}
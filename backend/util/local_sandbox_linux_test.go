@@ -0,0 +1,134 @@
+package util
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPythonWorkspace writes a Python program to a fresh workspace, skipping the test without python3
+func newPythonWorkspace(t *testing.T, source string) string {
+	t.Helper()
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "main.py"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return workDir
+}
+
+func TestLocalSandboxRun(t *testing.T) {
+	t.Setenv("JUDGE_LOCAL_CGROUP", "")
+	t.Setenv("JUDGE_OUTPUT_LIMIT_KB", "1")
+
+	tests := []struct {
+		name       string
+		source     string
+		input      string
+		timeoutMs  int
+		wantStdout string
+		wantStderr string
+		wantExit   int
+		wantErr    string
+		truncated  bool
+	}{
+		{
+			name:       "echoes input",
+			source:     "print(input()[::-1])",
+			input:      "abc",
+			timeoutMs:  5000,
+			wantStdout: "cba\n",
+		},
+		{
+			name:       "separates stderr",
+			source:     "import sys\nprint('out')\nprint('err', file=sys.stderr)",
+			timeoutMs:  5000,
+			wantStdout: "out\n",
+			wantStderr: "err\n",
+		},
+		{
+			name:      "non-zero exit",
+			source:    "raise SystemExit(3)",
+			timeoutMs: 5000,
+			wantExit:  3,
+			wantErr:   "non-zero status: 3",
+		},
+		{
+			name:      "time limit",
+			source:    "while True:\n    pass",
+			timeoutMs: 200,
+			wantErr:   "timed out",
+		},
+		{
+			name:       "output limit",
+			source:     "print('x' * 4096)",
+			timeoutMs:  5000,
+			wantStdout: strings.Repeat("x", 1024),
+			truncated:  true,
+		},
+	}
+
+	sandbox, err := NewLocalSandbox(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workDir := newPythonWorkspace(t, tt.source)
+
+			start := time.Now()
+			output, stats, err := sandbox.Run(context.Background(), "", workDir, "main.py", tt.input, tt.timeoutMs, 256)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+			if stats == nil {
+				t.Fatal("Run() returned no stats")
+			}
+			if tt.wantErr == "timed out" {
+				if elapsed := time.Since(start); elapsed > 2*time.Second {
+					t.Fatalf("Run() took %v, the program was not killed at its time limit", elapsed)
+				}
+				return
+			}
+
+			if output.Stdout != tt.wantStdout || output.Stderr != tt.wantStderr {
+				t.Errorf("output = %q / %q, want %q / %q", output.Stdout, output.Stderr, tt.wantStdout, tt.wantStderr)
+			}
+			if output.Truncated != tt.truncated {
+				t.Errorf("Truncated = %v, want %v", output.Truncated, tt.truncated)
+			}
+			if stats.ExitCode != tt.wantExit {
+				t.Errorf("ExitCode = %d, want %d", stats.ExitCode, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestLocalSandboxRunHonorsContext(t *testing.T) {
+	t.Setenv("JUDGE_LOCAL_CGROUP", "")
+	workDir := newPythonWorkspace(t, "import time\ntime.sleep(10)")
+
+	sandbox, err := NewLocalSandbox(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := sandbox.Run(ctx, "", workDir, "main.py", "", 10000, 256); err == nil {
+		t.Fatal("Run() error = nil, want the cancellation")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Run() took %v after the context was done", elapsed)
+	}
+}
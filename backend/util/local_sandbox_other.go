@@ -0,0 +1,42 @@
+//go:build !linux
+
+package util
+
+import (
+	"context"
+	"errors"
+)
+
+var _ Sandbox = (*LocalSandbox)(nil)
+
+// LocalSandbox relies on Linux process groups and cgroups, see local_sandbox_linux.go
+type LocalSandbox struct{}
+
+// NewLocalSandbox is only supported on Linux
+func NewLocalSandbox(maxProcesses int) (*LocalSandbox, error) {
+	return nil, errors.New("the local sandbox is only supported on Linux, use the Docker sandbox instead")
+}
+
+func (s *LocalSandbox) Prepare(ctx context.Context, image string, sourceFile string) error {
+	return errors.ErrUnsupported
+}
+
+func (s *LocalSandbox) WorkspacePath(workDir string, name string) string {
+	return name
+}
+
+func (s *LocalSandbox) Compile(ctx context.Context, image, workDir, sourceFile string, flags []string, timeoutMs int, memoryLimitMB int) (string, bool, error) {
+	return "", false, errors.ErrUnsupported
+}
+
+func (s *LocalSandbox) Run(ctx context.Context, image, workDir, sourceFile, inputString string, timeoutMs int, memoryLimitMB int, args ...string) (ContainerOutput, *StatsResult, error) {
+	return ContainerOutput{}, nil, errors.ErrUnsupported
+}
+
+func (s *LocalSandbox) RunInteractive(ctx context.Context, solution ContainerRun, interactor ContainerRun) (RunResult, RunResult, error) {
+	return RunResult{}, RunResult{}, errors.ErrUnsupported
+}
+
+func (s *LocalSandbox) RunCommand(ctx context.Context, run CommandRun) (ContainerOutput, *StatsResult, error) {
+	return ContainerOutput{}, nil, errors.ErrUnsupported
+}
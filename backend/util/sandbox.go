@@ -0,0 +1,118 @@
+package util
+
+import (
+	"context"
+	"sync"
+)
+
+// Sandbox compiles and runs untrusted code under time and memory limits.
+// DockerClient runs every program in its own container, LocalSandbox runs plain processes
+// for development machines and CI without a Docker daemon.
+type Sandbox interface {
+	// Prepare makes sure the toolchain for the image and source file is available, e.g. by pulling the image,
+	// so that the time it takes is not counted against a submission
+	Prepare(ctx context.Context, image string, sourceFile string) error
+
+	// Compile compiles the source file in workDir once, leaving the artifact next to it. Flags replace the default
+	// compiler flags of the language if there are any. It returns the compiler diagnostics and whether compilation
+	// succeeded. A non-nil error means the compiler could not be run at all.
+	Compile(ctx context.Context, image, workDir, sourceFile string, flags []string, timeoutMs int, memoryLimitMB int) (string, bool, error)
+
+	// Run executes a prepared (and, if needed, compiled) workspace with the input on stdin and collects its stats.
+	// An error is returned for timeouts, OOM kills and non-zero exit codes; the stats are set whenever the program ran.
+	Run(ctx context.Context, image, workDir, sourceFile, inputString string, timeoutMs int, memoryLimitMB int, args ...string) (ContainerOutput, *StatsResult, error)
+
+	// RunInteractive runs the solution and the interactor side by side with the stdout of each piped into the
+	// stdin of the other. The returned error is only set if the run could not be set up.
+	RunInteractive(ctx context.Context, solution ContainerRun, interactor ContainerRun) (RunResult, RunResult, error)
+
+	// RunCommand runs a command in a writable workspace, e.g. to install the dependencies of a repository submission
+	// and run its tests. Errors and stats are reported like in Run.
+	RunCommand(ctx context.Context, run CommandRun) (ContainerOutput, *StatsResult, error)
+
+	// WorkspacePath returns the path under which a program sees a file of its workspace
+	WorkspacePath(workDir string, name string) string
+}
+
+// SessionSandbox is implemented by sandboxes that can keep one environment alive for all test cases of a submission,
+// which saves setting up a new one for every test case
+type SessionSandbox interface {
+	Sandbox
+
+	// StartSession prepares an environment for the compiled workspace. memoryLimitMB is the highest limit any run of
+	// the session will ask for. The session must be closed by the caller.
+	StartSession(ctx context.Context, image, workDir, sourceFile string, memoryLimitMB int) (SandboxSession, error)
+}
+
+// SandboxSession runs the workspace of a submission once per test case
+type SandboxSession interface {
+	// Run behaves like Sandbox.Run. Runs of one session must not overlap. Every run starts in an empty working directory without processes or files left over from earlier runs.
+	Run(ctx context.Context, inputString string, timeoutMs int, memoryLimitMB int, args ...string) (ContainerOutput, *StatsResult, error)
+
+	// Close tears the environment down
+	Close()
+}
+
+// CommandRun describes a command that runs in a workspace instead of a submitted source file
+type CommandRun struct {
+	Image         string
+	WorkDir       string // Mounted writable, the command may change the workspace
+	Command       []string
+	Policy        string // Key of the sandbox policy, see SandboxPolicyFor
+	TimeoutMs     int
+	MemoryLimitMB int
+	Network       bool // Only for setup steps such as installing dependencies, the local sandbox can't disable it
+	Mounts        []CommandMount
+}
+
+// CommandMount makes a directory of the host available read-only inside the workspace of a CommandRun.
+// The local sandbox can't mount, it links the directory into the workspace instead.
+type CommandMount struct {
+	Source string // On the host
+	Target string // Relative to the workspace
+}
+
+// slotPool limits how many programs a sandbox runs at the same time
+type slotPool struct {
+	slots  chan struct{}
+	pairMu sync.Mutex // Serializes runs that need two slots at once, see acquirePair
+}
+
+func newSlotPool(size int) *slotPool {
+	pool := &slotPool{slots: make(chan struct{}, size)}
+	for i := 0; i < size; i++ {
+		pool.slots <- struct{}{}
+	}
+	return pool
+}
+
+// acquire takes a slot from the pool, blocking until one is free or ctx is done
+func (p *slotPool) acquire(ctx context.Context) error {
+	select {
+	case <-p.slots:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquirePair takes two slots for runs with two programs. Only one caller at a time may hold
+// a single slot while waiting for the second one, otherwise pairs could deadlock each other.
+func (p *slotPool) acquirePair(ctx context.Context) error {
+	p.pairMu.Lock()
+	defer p.pairMu.Unlock()
+
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	if err := p.acquire(ctx); err != nil {
+		p.release()
+		return err
+	}
+	return nil
+}
+
+// release returns a slot taken with acquire
+func (p *slotPool) release() {
+	p.slots <- struct{}{}
+}
@@ -0,0 +1,160 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// SandboxPolicy hardens the containers that compile and run untrusted code
+type SandboxPolicy struct {
+	ReadOnlyRootfs   bool   `json:"readOnlyRootfs"`
+	TmpfsSizeMB      int    `json:"tmpfsSizeMB"` // Size of the writable /tmp, used as HOME by the toolchains
+	PidsLimit        int64  `json:"pidsLimit"`   // Threads count towards this limit, so the JVM and .NET need more
+	User             string `json:"user"`        // uid:gid the program runs as, empty for the image default
+	DropCapabilities bool   `json:"dropCapabilities"`
+	NoNewPrivileges  bool   `json:"noNewPrivileges"`
+	FileSizeMB       int64  `json:"fileSizeMB"` // RLIMIT_FSIZE, the largest file the program may write
+	OpenFiles        int64  `json:"openFiles"`  // RLIMIT_NOFILE
+}
+
+// defaultSandboxPolicy applies to every language that doesn't override a setting
+var defaultSandboxPolicy = SandboxPolicy{
+	ReadOnlyRootfs:   true,
+	TmpfsSizeMB:      64,
+	PidsLimit:        64,
+	User:             "65534:65534", // nobody
+	DropCapabilities: true,
+	NoNewPrivileges:  true,
+	FileSizeMB:       64,
+	OpenFiles:        64,
+}
+
+// languageSandboxOverrides holds the built-in differences from the default policy, keyed by source file extension,
+// or REPO_SANDBOX_POLICY for the setup and tests of repository submissions
+var languageSandboxOverrides = map[string]SandboxPolicy{
+	"java": {PidsLimit: 256, OpenFiles: 1024},
+	"cs":   {PidsLimit: 256, OpenFiles: 1024, TmpfsSizeMB: 256},
+	"js":   {OpenFiles: 256},
+	"ts":   {OpenFiles: 256},
+	"go":   {PidsLimit: 256, TmpfsSizeMB: 256}, // The build cache of the standard library goes to /tmp
+	"rs":   {PidsLimit: 256},
+	// npm keeps its cache in /tmp and test runners start worker processes
+	REPO_SANDBOX_POLICY: {PidsLimit: 256, OpenFiles: 1024, TmpfsSizeMB: 512, FileSizeMB: 256},
+}
+
+var (
+	sandboxPoliciesOnce sync.Once
+	sandboxPolicies     map[string]SandboxPolicy
+	seccompProfile      string
+)
+
+// withOverrides returns the policy with every non-zero limit of override applied
+func (p SandboxPolicy) withOverrides(override SandboxPolicy) SandboxPolicy {
+	if override.TmpfsSizeMB > 0 {
+		p.TmpfsSizeMB = override.TmpfsSizeMB
+	}
+	if override.PidsLimit > 0 {
+		p.PidsLimit = override.PidsLimit
+	}
+	if override.User != "" {
+		p.User = override.User
+	}
+	if override.FileSizeMB > 0 {
+		p.FileSizeMB = override.FileSizeMB
+	}
+	if override.OpenFiles > 0 {
+		p.OpenFiles = override.OpenFiles
+	}
+	return p
+}
+
+// loadSandboxPolicies builds the policy of every language from the defaults, the built-in overrides and
+// JUDGE_SANDBOX_POLICIES, a JSON object keyed by extension (e.g. {"java": {"pidsLimit": 512}}) whose fields
+// replace the ones of the built-in policy. It also reads the seccomp profile from the file named by JUDGE_SECCOMP_PROFILE.
+func loadSandboxPolicies() {
+	sandboxPolicies = make(map[string]SandboxPolicy)
+	for extension, override := range languageSandboxOverrides {
+		sandboxPolicies[extension] = defaultSandboxPolicy.withOverrides(override)
+	}
+
+	if raw := os.Getenv("JUDGE_SANDBOX_POLICIES"); raw != "" {
+		var overrides map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+			log.Printf("Ignoring invalid JUDGE_SANDBOX_POLICIES: %v", err)
+		}
+		for extension, override := range overrides {
+			policy, ok := sandboxPolicies[extension]
+			if !ok {
+				policy = defaultSandboxPolicy
+			}
+			// Only the fields present in the JSON are replaced
+			if err := json.Unmarshal(override, &policy); err != nil {
+				log.Printf("Ignoring invalid sandbox policy for %s: %v", extension, err)
+				continue
+			}
+			sandboxPolicies[extension] = policy
+		}
+	}
+
+	if path := os.Getenv("JUDGE_SECCOMP_PROFILE"); path != "" {
+		profile, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Failed to read seccomp profile, using Docker's default: %v", err)
+		} else if !json.Valid(profile) {
+			log.Printf("Seccomp profile %s is not valid JSON, using Docker's default", path)
+		} else {
+			seccompProfile = string(profile)
+		}
+	}
+}
+
+// SandboxPolicyFor returns the policy for a source file extension such as "java" or ".java"
+func SandboxPolicyFor(extension string) SandboxPolicy {
+	sandboxPoliciesOnce.Do(loadSandboxPolicies)
+
+	if policy, ok := sandboxPolicies[strings.TrimPrefix(extension, ".")]; ok {
+		return policy
+	}
+	return defaultSandboxPolicy
+}
+
+// apply adds the restrictions of the policy to a container configuration
+func (p SandboxPolicy) apply(config *container.Config, hostConfig *container.HostConfig) {
+	config.User = p.User
+
+	hostConfig.ReadonlyRootfs = p.ReadOnlyRootfs
+	if p.TmpfsSizeMB > 0 {
+		hostConfig.Tmpfs = map[string]string{
+			"/tmp": fmt.Sprintf("rw,exec,nosuid,size=%dm,mode=1777", p.TmpfsSizeMB),
+		}
+	}
+
+	if p.PidsLimit > 0 {
+		pidsLimit := p.PidsLimit
+		hostConfig.Resources.PidsLimit = &pidsLimit
+	}
+
+	if p.DropCapabilities {
+		hostConfig.CapDrop = []string{"ALL"}
+	}
+	if p.NoNewPrivileges {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges")
+	}
+	if seccompProfile != "" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp="+seccompProfile)
+	}
+
+	if p.FileSizeMB > 0 {
+		fileSize := p.FileSizeMB * 1024 * 1024
+		hostConfig.Resources.Ulimits = append(hostConfig.Resources.Ulimits, &container.Ulimit{Name: "fsize", Soft: fileSize, Hard: fileSize})
+	}
+	if p.OpenFiles > 0 {
+		hostConfig.Resources.Ulimits = append(hostConfig.Resources.Ulimits, &container.Ulimit{Name: "nofile", Soft: p.OpenFiles, Hard: p.OpenFiles})
+	}
+}
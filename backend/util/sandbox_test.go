@@ -0,0 +1,112 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSlotPoolLimitsConcurrency(t *testing.T) {
+	const size = 3
+	pool := newSlotPool(size)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			defer pool.release()
+
+			current := running.Add(1)
+			for {
+				seen := peak.Load()
+				if current <= seen || peak.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > size {
+		t.Fatalf("%d programs ran at once, want at most %d", got, size)
+	}
+}
+
+func TestSlotPoolAcquireHonorsContext(t *testing.T) {
+	pool := newSlotPool(1)
+	if err := pool.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire() on a full pool = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	pool.release()
+	if err := pool.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() after release = %v", err)
+	}
+}
+
+func TestSlotPoolPairsDoNotDeadlock(t *testing.T) {
+	pool := newSlotPool(2)
+
+	// Pairs only ever get both slots or none, so they all finish even though each needs the whole pool
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.acquirePair(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+			pool.release()
+			pool.release()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pairs deadlocked")
+	}
+}
+
+func TestSlotPoolPairReleasesOnCancel(t *testing.T) {
+	pool := newSlotPool(2)
+	if err := pool.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.acquirePair(ctx); err == nil {
+		t.Fatal("acquirePair() = nil with only one free slot")
+	}
+
+	// The slot taken while waiting for the second one must be back
+	pool.release()
+	if err := pool.acquirePair(context.Background()); err != nil {
+		t.Fatalf("acquirePair() = %v, want both slots", err)
+	}
+}
@@ -22,9 +22,10 @@ type Props = {
     onSubmit: (solution: { language: string; code: string }) => Promise<void>;
     selectedRepo: { name: string; clone_url: string };
     contestLanguage: string;
+    allowedLanguages?: string[];
 };
 
-export default function SubmissionForm({ onSubmit, selectedRepo, contestLanguage }: Props) {
+export default function SubmissionForm({ onSubmit, selectedRepo, contestLanguage, allowedLanguages }: Props) {
     console.log(contestLanguage);
     const {t} = useTranslation();
     const [code, setCode] = useState(
@@ -38,14 +39,25 @@ export default function SubmissionForm({ onSubmit, selectedRepo, contestLanguage
         language: contestLanguage,
     });
 
-    const languages = useMemo(() => [
+    const allLanguages = useMemo(() => [
         { value: 'JavaScript', monacoValue: 'javascript', label: 'JavaScript' },
         { value: 'Python', monacoValue: 'python', label: 'Python' },
         { value: 'Java', monacoValue: 'Java', label: 'Java' },
         { value: 'C++', monacoValue: 'cpp', label: 'C++' },
         { value: 'C#', monacoValue: 'csharp', label: 'C#' },
+        { value: 'TypeScript', monacoValue: 'typescript', label: 'TypeScript' },
+        { value: 'Go', monacoValue: 'go', label: 'Go' },
+        { value: 'Rust', monacoValue: 'rust', label: 'Rust' },
     ], []);
 
+    // Only offer the languages the contest accepts, the backend rejects the others
+    const languages = useMemo(() => {
+        const allowed = (allowedLanguages?.length ? allowedLanguages : [contestLanguage])
+            .map(l => l.toLowerCase());
+        const filtered = allLanguages.filter(l => allowed.includes(l.value.toLowerCase()));
+        return filtered.length ? filtered : allLanguages;
+    }, [allLanguages, allowedLanguages, contestLanguage]);
+
     // Sync language state with contestLanguage prop, matching correct casing
     useEffect(() => {
         const match = languages.find(
@@ -195,6 +195,7 @@ export default function ContestPage() {
                                         : null
                                 }
                                 contestLanguage={contest.language}
+                                allowedLanguages={contest.allowedLanguages}
                             />
                         )}
                         <Button variant='outline' onClick={handleRefresh}>
@@ -46,12 +46,14 @@ const ContestScheme = z.object({
         from: z.date(),
         to: z.date(),
     }),
-    language: z.enum(['python', 'java', 'javascript', 'c++', 'c#']),
+    language: z.enum(['python', 'java', 'javascript', 'typescript', 'c++', 'c#', 'go', 'rust']),
     prize: z.string(),
     rulesFile: z.any().optional(),
     contestStructure: z.string().optional(),
     testFiles: z.any().optional(),
-    testFramework: z.enum(['jest', 'unittest', 'pytest']).optional(),
+    testFramework: z
+        .enum(['jest', 'unittest', 'pytest', 'maven', 'gradle', 'go'])
+        .optional(),
     isPublic: z.boolean().default(true),
     inviteOnly: z.boolean().default(false),
     enableAICodeEntryIdentification: z.boolean().default(false),
@@ -262,6 +264,15 @@ export default function CreateContest() {
                                             <SelectItem value='c#'>
                                                 C#
                                             </SelectItem>
+                                            <SelectItem value='typescript'>
+                                                TypeScript
+                                            </SelectItem>
+                                            <SelectItem value='go'>
+                                                Go
+                                            </SelectItem>
+                                            <SelectItem value='rust'>
+                                                Rust
+                                            </SelectItem>
                                         </SelectContent>
                                     </Select>
                                 )}
@@ -727,6 +738,15 @@ export default function CreateContest() {
                                                         <SelectItem value='pytest'>
                                                             Pytest
                                                         </SelectItem>
+                                                        <SelectItem value='maven'>
+                                                            JUnit (Maven)
+                                                        </SelectItem>
+                                                        <SelectItem value='gradle'>
+                                                            JUnit (Gradle)
+                                                        </SelectItem>
+                                                        <SelectItem value='go'>
+                                                            Go test
+                                                        </SelectItem>
                                                     </SelectContent>
                                                 </Select>
                                             )}
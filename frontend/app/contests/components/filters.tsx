@@ -49,6 +49,8 @@ export default function Filters({
                         <SelectItem value='c#'>c#</SelectItem>
                         <SelectItem value='java'>java</SelectItem>
                         <SelectItem value='go'>go</SelectItem>
+                        <SelectItem value='typescript'>typescript</SelectItem>
+                        <SelectItem value='rust'>rust</SelectItem>
                     </SelectContent>
                 </Select>
             </div>
@@ -41,7 +41,9 @@ export interface TestCaseWithResult extends TestCase {
 export interface TestCaseResult {
     // testCase: TestCase;
     id: string;
-    testCaseId?: string;
+    testCaseId?: string | null;
+    name?: string; // Spec of a repository submission
+    failureMessage?: string;
     input: string;
     passed: boolean;
     status?: boolean;
@@ -53,12 +55,20 @@ export interface TestCaseResult {
     timeLimit: number;
 }
 
+export interface FunctionSignature {
+    name: string;
+    parameters: { name: string; type: string }[];
+    returnType: string;
+}
+
 export interface Contest {
     id: string;
     title: string;
     description: string;
     // languages: string[];
     language: string;
+    allowedLanguages?: string[];
+    signature?: FunctionSignature;
     category: string;
     startDate: string;
     endDate: string;